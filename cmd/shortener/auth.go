@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/config"
+)
+
+// newKeyRing loads auth secrets from config.AuthKeysFile or config.AuthKeys.
+// Without them built-in config.AuthSecret seals cookies, which is refused when serving HTTPS
+// as the secret is public; nil ring is returned otherwise.
+// Cookies sealed with config.AuthSecret stay valid only if it is kept in the ring under auth.DefaultKeyID.
+func newKeyRing() (*auth.KeyRing, error) {
+	keys := config.AuthKeys
+	if config.AuthKeysFile != "" {
+		data, err := os.ReadFile(config.AuthKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read auth keys: %w", err)
+		}
+		keys = string(data)
+	}
+	if keys == "" {
+		if servesHTTPS() {
+			return nil, fmt.Errorf("auth keys must be given to serve HTTPS, built-in auth secret is public; "+
+				"add it as %s:%x to keep issued cookies valid", auth.DefaultKeyID, config.AuthSecret)
+		}
+		log.Printf("WARNING: auth cookies are sealed with built-in public secret, anyone can forge them; "+
+			"set -auth-keys or -auth-keys-file and add %s:%x to keep issued cookies valid", auth.DefaultKeyID, config.AuthSecret)
+		return nil, nil
+	}
+
+	ring, err := auth.ParseKeyRing(keys)
+	if err != nil {
+		return nil, fmt.Errorf("bad auth keys: %w", err)
+	}
+	return ring, nil
+}
+
+// authCookieName is a name of cookie carrying auth token
+const authCookieName = "auth"
+
+// session describes how auth cookies are issued
+type session struct {
+	codec  auth.Codec
+	maxAge time.Duration
+	// secure forces Secure attribute which is otherwise set for requests over TLS only
+	secure   bool
+	sameSite http.SameSite
+}
+
+// newSession creates session of auth tokens configured by config.AuthToken.
+// JWT codec keeps accepting cookie tokens to let clients switch over.
+func newSession() (s session, err error) {
+	if config.SessionMaxAge < 0 || config.SessionRefresh < 0 {
+		return s, errors.New("negative session age given")
+	}
+	cookies := auth.CookieCodec{MaxAge: config.SessionMaxAge, Refresh: config.SessionRefresh}
+	if config.LegacySessionsUntil != "" {
+		if cookies.LegacyUntil, err = time.Parse(time.RFC3339, config.LegacySessionsUntil); err != nil {
+			return s, fmt.Errorf("bad legacy sessions time: %w", err)
+		}
+	}
+
+	switch config.AuthToken {
+	case "cookie":
+		s.codec = cookies
+		s.maxAge = config.SessionMaxAge
+	case "jwt":
+		jwt, err := newJWTCodec()
+		if err != nil {
+			return s, err
+		}
+		s.codec = auth.NewTransitionCodec(jwt, cookies)
+		s.maxAge = config.JWTTTL
+	default:
+		return s, fmt.Errorf("unknown auth token format %q, expected cookie or jwt", config.AuthToken)
+	}
+
+	switch strings.ToLower(config.CookieSameSite) {
+	case "lax":
+		s.sameSite = http.SameSiteLaxMode
+	case "strict":
+		s.sameSite = http.SameSiteStrictMode
+	case "none":
+		// browsers drop SameSite=None cookies without Secure
+		s.sameSite = http.SameSiteNoneMode
+		s.secure = true
+	default:
+		return s, fmt.Errorf("unknown cookie SameSite %q, expected lax, strict or none", config.CookieSameSite)
+	}
+
+	if servesHTTPS() {
+		s.secure = true
+	}
+	return s, nil
+}
+
+// servesHTTPS reports whether service is reached over HTTPS,
+// TLS may be terminated by proxy in front of service
+func servesHTTPS() bool {
+	return config.TLSCertFile != "" || strings.HasPrefix(config.BaseURL, "https://")
+}
+
+// cookie returns auth cookie carrying token
+func (s session) cookie(r *http.Request, token string) *http.Cookie {
+	return &http.Cookie{
+		Name:     authCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(s.maxAge.Seconds()),
+		Secure:   s.secure || r.TLS != nil,
+		HttpOnly: true,
+		SameSite: s.sameSite,
+	}
+}
+
+// Issue sets auth cookie of signed in user
+func (s session) Issue(w http.ResponseWriter, r *http.Request, signedIn auth.Session) error {
+	value, err := s.codec.Encode(signedIn)
+	if err != nil {
+		return fmt.Errorf("cannot encode auth cookie: %w", err)
+	}
+	http.SetCookie(w, s.cookie(r, value))
+	return nil
+}
+
+// Clear removes auth cookie, so client gets new uid on next request
+func (s session) Clear(w http.ResponseWriter, r *http.Request) {
+	c := s.cookie(r, "")
+	c.MaxAge = -1
+	http.SetCookie(w, c)
+}
+
+func newJWTCodec() (*auth.JWTCodec, error) {
+	if config.JWTTTL <= 0 {
+		return nil, fmt.Errorf("non-positive JWT lifetime given: %s", config.JWTTTL)
+	}
+
+	opts := []auth.JWTOption{
+		auth.WithIssuer(config.JWTIssuer),
+		auth.WithRefresh(config.JWTRefresh),
+	}
+	if config.JWTScopes != "" {
+		opts = append(opts, auth.WithScopes(strings.Split(config.JWTScopes, ",")...))
+	}
+
+	switch config.JWTAlgorithm {
+	case auth.AlgHS256:
+		codec, err := auth.NewHS256Codec([]byte(config.JWTSecret), config.JWTTTL, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("bad JWT secret: %w", err)
+		}
+		return codec, nil
+	case auth.AlgEdDSA:
+		data, err := os.ReadFile(config.JWTKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read JWT key: %w", err)
+		}
+		key, err := auth.ParseEd25519Key(data)
+		if err != nil {
+			return nil, fmt.Errorf("bad JWT key: %w", err)
+		}
+		return auth.NewEdDSACodec(key, config.JWTTTL, opts...)
+	default:
+		return nil, fmt.Errorf("unknown JWT algorithm %q, expected %s or %s", config.JWTAlgorithm, auth.AlgHS256, auth.AlgEdDSA)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+)
+
+func Test_runCopy(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "src.gob")
+	dstPath := filepath.Join(dir, "dst.gob")
+	checkpointPath := filepath.Join(dir, "copy.checkpoint")
+
+	uid := uuid.Must(uuid.NewV4())
+	u1, _ := url.Parse("https://praktikum.yandex.ru/")
+	u2, _ := url.Parse("https://ya.ru/")
+
+	src, err := store.NewFileStore(srcPath)
+	require.NoError(t, err)
+	anonID, err := src.Save(ctx, u1)
+	require.NoError(t, err)
+	userIDs, err := src.SaveUserBatch(ctx, uid, []*url.URL{u1, u2})
+	require.NoError(t, err)
+	require.NoError(t, src.DeleteUsers(ctx, uid, userIDs[0]))
+	require.NoError(t, src.Close())
+
+	// pretend first record has been copied before interruption
+	require.NoError(t, os.WriteFile(checkpointPath, []byte(anonID+"\n"), 0666))
+
+	err = runCopy([]string{
+		"-from", "file://" + srcPath,
+		"-to", "file://" + dstPath,
+		"-checkpoint", checkpointPath,
+		"-verify=false",
+	})
+	require.NoError(t, err)
+
+	dst, err := store.NewFileStore(dstPath)
+	require.NoError(t, err)
+	defer dst.Close()
+
+	_, err = dst.Load(ctx, anonID)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	_, err = dst.Load(ctx, userIDs[0])
+	assert.ErrorIs(t, err, store.ErrDeleted)
+
+	u, err := dst.LoadUser(ctx, uid, userIDs[1])
+	require.NoError(t, err)
+	assert.Equal(t, u2.String(), u.String())
+
+	// IDs issued by destination must not collide with restored ones
+	id, err := dst.Save(ctx, u1)
+	require.NoError(t, err)
+	assert.NotContains(t, userIDs, id)
+
+	assert.NoFileExists(t, checkpointPath)
+
+	// source is never created or replaced
+	err = runCopy([]string{"-from", "file://" + filepath.Join(dir, "missing.gob"), "-to", "file://" + dstPath})
+	assert.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, "missing.gob"))
+
+	corrupt := filepath.Join(dir, "corrupt.gob")
+	require.NoError(t, os.WriteFile(corrupt, []byte("ololo"), 0666))
+	err = runCopy([]string{"-from", "file://" + corrupt, "-to", "file://" + dstPath})
+	assert.Error(t, err)
+	data, err := os.ReadFile(corrupt)
+	require.NoError(t, err)
+	assert.Equal(t, "ololo", string(data))
+}
+
+func Test_verifyRecords(t *testing.T) {
+	ctx := context.Background()
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+
+	src := store.NewInMemory()
+	_, err := src.SaveUser(ctx, uuid.Must(uuid.NewV4()), u)
+	require.NoError(t, err)
+
+	dst := store.NewInMemory()
+	checked, mismatches, err := verifyRecords(ctx, src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, 1, checked)
+	assert.Equal(t, 1, mismatches)
+
+	_, err = copyRecords(ctx, src, dst, "", 10, func(int, string) error { return nil })
+	require.NoError(t, err)
+
+	checked, mismatches, err = verifyRecords(ctx, src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, 1, checked)
+	assert.Equal(t, 0, mismatches)
+}
+
+func Test_copyUserState(t *testing.T) {
+	ctx := context.Background()
+	uid := uuid.Must(uuid.NewV4())
+	u1, _ := url.Parse("https://praktikum.yandex.ru/")
+	u2, _ := url.Parse("https://ya.ru/")
+
+	src := store.NewInMemory()
+	id, err := src.SaveUser(ctx, uid, u1)
+	require.NoError(t, err)
+	_, err = src.UpdateUser(ctx, uid, id, u2)
+	require.NoError(t, err)
+	require.NoError(t, src.SaveReport(ctx, store.Report{ID: id, Reason: "spam", CreatedAt: time.Now()}))
+	require.NoError(t, src.SaveUserSettings(ctx, uid, store.UserSettings{RedirectStatus: 301}))
+	require.NoError(t, src.SaveKey(ctx, store.APIKey{ID: "key", UserID: uid, Hash: []byte("hash"), CreatedAt: time.Now()}))
+	require.NoError(t, src.SaveAccount(ctx, store.Account{UserID: uid, Email: "user@example.com", PasswordHash: "hash"}))
+
+	dst, err := store.NewFileStore(filepath.Join(t.TempDir(), "dst.gob"))
+	require.NoError(t, err)
+	defer dst.Close()
+
+	_, err = copyRecords(ctx, src, dst, "", 10, func(int, string) error { return nil })
+	require.NoError(t, err)
+
+	// records alone leave users behind
+	checked, mismatches, err := verifyUsers(ctx, src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, 1, checked)
+	assert.Equal(t, 1, mismatches)
+
+	copied, err := copyUsers(ctx, src, dst, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, copied)
+
+	checked, mismatches, err = verifyRecords(ctx, src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, 1, checked)
+	assert.Equal(t, 0, mismatches)
+
+	checked, mismatches, err = verifyUsers(ctx, src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, 1, checked)
+	assert.Equal(t, 0, mismatches)
+
+	versions, err := dst.History(ctx, uid, id)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, u1.String(), versions[0].URL.String())
+
+	reports, err := dst.LoadReports(ctx, id)
+	require.NoError(t, err)
+	assert.Len(t, reports, 1)
+
+	account, err := dst.LoadAccount(ctx, "user@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, uid, account.UserID)
+}
@@ -24,6 +24,9 @@ import (
 
 func TestMain(m *testing.M) {
 	config.Parse()
+	// tests shorten more URLs from single client than default limits allow
+	config.RateShorten = ""
+	config.RateBatch = ""
 	go func() {
 		err := run()
 		if err != nil {
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies lists networks of reverse proxies allowed to tell client address,
+// forwarding headers of other peers are ignored as anyone may set them
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies parses comma separated IPs and CIDRs configured by config.TrustedProxies
+func parseTrustedProxies(s string) (proxies trustedProxies, err error) {
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("bad proxy address %q given", item)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("bad proxy network %q given", item)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// trusts reports whether address belongs to trusted proxy
+func (p trustedProxies) trusts(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// middleware replaces remote address of requests came through trusted proxies
+// by client address from X-Forwarded-For or X-Real-IP header.
+// X-Forwarded-For is read from the right skipping trusted hops, as hops to the left of them
+// are told by client and may be forged.
+func (p trustedProxies) middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !p.trusts(remoteIP(r)) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		client := ""
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(strings.Join(forwarded, ","), ",")
+			for n := len(hops) - 1; n >= 0; n-- {
+				hop := strings.TrimSpace(hops[n])
+				if net.ParseIP(hop) == nil {
+					break
+				}
+				client = hop
+				if !p.trusts(hop) {
+					break
+				}
+			}
+		} else if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(ip) != nil {
+			client = ip
+		}
+
+		if client != "" {
+			r.RemoteAddr = client
+		}
+		h.ServeHTTP(w, r)
+	})
+}
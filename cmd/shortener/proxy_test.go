@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_trustedProxies(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.1, 192.168.0.0/16")
+	require.NoError(t, err)
+
+	_, err = parseTrustedProxies("10.0.0")
+	assert.Error(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{name: "direct", remoteAddr: "1.2.3.4:1234", forwarded: "5.6.7.8", want: "1.2.3.4"},
+		{name: "proxy", remoteAddr: "10.0.0.1:1234", forwarded: "5.6.7.8", want: "5.6.7.8"},
+		{name: "forged_hop", remoteAddr: "10.0.0.1:1234", forwarded: "9.9.9.9, 5.6.7.8, 192.168.1.1", want: "5.6.7.8"},
+		{name: "real_ip", remoteAddr: "192.168.1.1:1234", realIP: "5.6.7.8", want: "5.6.7.8"},
+		{name: "bad_header", remoteAddr: "10.0.0.1:1234", forwarded: "ololo", want: "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			var got string
+			proxies.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = remoteIP(r)
+			})).ServeHTTP(httptest.NewRecorder(), r)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
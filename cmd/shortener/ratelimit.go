@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/config"
+)
+
+const (
+	// rateLimitSweepPeriod is a period of evicting idle buckets
+	rateLimitSweepPeriod = time.Minute
+	// ipv6PrefixBits is a prefix length IPv6 clients are limited by, as a single host usually owns whole /64
+	ipv6PrefixBits = 64
+)
+
+// routeLimits holds rate limiters of endpoint groups, nil limiter does not limit
+type routeLimits struct {
+	shorten  *rateLimiter
+	batch    *rateLimiter
+	redirect *rateLimiter
+	report   *rateLimiter
+	// edit limits changes of existing URLs and their transfers
+	edit *rateLimiter
+	// account limits sign up, sign in and credential changes
+	account *rateLimiter
+}
+
+// newRouteLimits creates rate limiters configured by config.RateShorten, config.RateBatch,
+// config.RateRedirect, config.RateReport, config.RateEdit and config.RateAccount
+func newRouteLimits() (limits routeLimits, err error) {
+	if limits.shorten, err = parseRateLimit(config.RateShorten); err != nil {
+		return limits, fmt.Errorf("bad shorten rate limit: %w", err)
+	}
+	if limits.batch, err = parseRateLimit(config.RateBatch); err != nil {
+		return limits, fmt.Errorf("bad batch rate limit: %w", err)
+	}
+	if limits.redirect, err = parseRateLimit(config.RateRedirect); err != nil {
+		return limits, fmt.Errorf("bad redirect rate limit: %w", err)
+	}
+	if limits.report, err = parseRateLimit(config.RateReport); err != nil {
+		return limits, fmt.Errorf("bad report rate limit: %w", err)
+	}
+	if limits.edit, err = parseRateLimit(config.RateEdit); err != nil {
+		return limits, fmt.Errorf("bad edit rate limit: %w", err)
+	}
+	if limits.account, err = parseRateLimit(config.RateAccount); err != nil {
+		return limits, fmt.Errorf("bad account rate limit: %w", err)
+	}
+	return limits, nil
+}
+
+// parseRateLimit parses limit formatted as number of requests per second, minute or hour
+// like "100/m", empty limit means no limit
+func parseRateLimit(s string) (*rateLimiter, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("limit %q is not formatted as requests/period", s)
+	}
+	n, err := strconv.Atoi(parts[0])
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("bad requests number %q given", parts[0])
+	}
+
+	var period time.Duration
+	switch parts[1] {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		return nil, fmt.Errorf("unknown period %q given, expected s, m or h", parts[1])
+	}
+	return newRateLimiter(n, period), nil
+}
+
+// rateLimiter is a token bucket limiter per client.
+// Bucket holds up to burst tokens and is refilled by burst tokens per period.
+type rateLimiter struct {
+	burst int
+	// rate is a number of tokens added per second
+	rate float64
+	now  func() time.Time
+
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newRateLimiter(burst int, period time.Duration) *rateLimiter {
+	return &rateLimiter{
+		burst:     burst,
+		rate:      float64(burst) / period.Seconds(),
+		now:       time.Now,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes token from every given bucket of client if each of them has one, returning tokens left,
+// time until buckets are full and time to wait until next token if any bucket is empty
+func (l *rateLimiter) allow(keys ...string) (ok bool, remaining int, reset, retryAfter time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	buckets := make([]*tokenBucket, 0, len(keys))
+	ok = true
+	for _, key := range keys {
+		b, found := l.buckets[key]
+		if !found {
+			b = &tokenBucket{tokens: float64(l.burst), updated: now}
+			l.buckets[key] = b
+		}
+		b.tokens = math.Min(float64(l.burst), b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+		b.updated = now
+		if b.tokens < 1 {
+			ok = false
+		}
+		buckets = append(buckets, b)
+	}
+
+	// tokens are taken from all buckets or none of them
+	tokens := float64(l.burst)
+	for _, b := range buckets {
+		if ok {
+			b.tokens--
+		} else if wait := l.duration(1 - b.tokens); b.tokens < 1 && wait > retryAfter {
+			retryAfter = wait
+		}
+		tokens = math.Min(tokens, b.tokens)
+	}
+	return ok, int(tokens), l.duration(float64(l.burst) - tokens), retryAfter
+}
+
+// duration returns time needed to add given number of tokens
+func (l *rateLimiter) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// sweep evicts buckets which have been idle long enough to refill,
+// as they are no different from new ones.
+// Must be called under lock.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepPeriod {
+		return
+	}
+	l.lastSweep = now
+
+	refill := l.duration(float64(l.burst))
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// middleware limits requests by client IP and by uid of returning users as well,
+// so that neither switching addresses nor switching accounts bypasses limit
+func (l *rateLimiter) middleware(h http.Handler) http.Handler {
+	if l == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := []string{"ip:" + clientNetwork(remoteIP(r))}
+		// freshly issued uid changes on every request of cookie-less client
+		if uid := auth.UIDFromContext(r.Context()); uid != nil && !auth.IssuedFromContext(r.Context()) {
+			keys = append(keys, "uid:"+uid.String())
+		}
+
+		ok, remaining, reset, retryAfter := l.allow(keys...)
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(l.burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", ceilSeconds(reset))
+		if !ok {
+			w.Header().Set("Retry-After", ceilSeconds(retryAfter))
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte("Too many requests"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ceilSeconds formats duration as whole number of seconds rounded up
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// clientNetwork returns IPv4 address and IPv6 address as its /64 network,
+// so that rotating addresses within the network does not bypass limit
+func clientNetwork(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.String()
+	}
+	mask := net.CIDRMask(ipv6PrefixBits, 8*net.IPv6len)
+	return (&net.IPNet{IP: parsed.Mask(mask), Mask: mask}).String()
+}
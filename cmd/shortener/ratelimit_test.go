@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+)
+
+func Test_parseRateLimit(t *testing.T) {
+	tests := []struct {
+		given     string
+		wantBurst int
+		wantRate  float64
+		wantErr   bool
+	}{
+		{given: "", wantBurst: 0},
+		{given: "5/s", wantBurst: 5, wantRate: 5},
+		{given: "120/m", wantBurst: 120, wantRate: 2},
+		{given: "3600/h", wantBurst: 3600, wantRate: 1},
+		{given: "100", wantErr: true},
+		{given: "0/m", wantErr: true},
+		{given: "ten/m", wantErr: true},
+		{given: "10/d", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.given, func(t *testing.T) {
+			l, err := parseRateLimit(tt.given)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.wantBurst == 0 {
+				assert.Nil(t, l)
+				return
+			}
+			assert.Equal(t, tt.wantBurst, l.burst)
+			assert.InDelta(t, tt.wantRate, l.rate, 1e-9)
+		})
+	}
+}
+
+func Test_rateLimiter(t *testing.T) {
+	now := time.Now()
+	l := newRateLimiter(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	ok, remaining, _, _ := l.allow("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, remaining)
+	ok, remaining, reset, _ := l.allow("a")
+	assert.True(t, ok)
+	assert.Equal(t, 0, remaining)
+	assert.Equal(t, time.Minute, reset)
+
+	ok, _, _, retryAfter := l.allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 30*time.Second, retryAfter)
+
+	// other clients have own buckets
+	ok, _, _, _ = l.allow("b")
+	assert.True(t, ok)
+
+	now = now.Add(30 * time.Second)
+	ok, _, _, _ = l.allow("a")
+	assert.True(t, ok)
+
+	// idle buckets are evicted once refilled
+	now = now.Add(2 * time.Minute)
+	l.allow("c")
+	assert.Len(t, l.buckets, 1)
+
+	// token is taken from every bucket or none of them
+	ok, _, _, _ = l.allow("c", "d")
+	assert.True(t, ok)
+	ok, _, _, _ = l.allow("c", "d")
+	assert.False(t, ok)
+	ok, remaining, _, _ = l.allow("d")
+	assert.True(t, ok)
+	assert.Equal(t, 0, remaining)
+}
+
+func Test_clientNetwork(t *testing.T) {
+	assert.Equal(t, "10.0.0.1", clientNetwork("10.0.0.1"))
+	assert.Equal(t, "10.0.0.1", clientNetwork("::ffff:10.0.0.1"))
+	assert.Equal(t, "2001:db8:0:1::/64", clientNetwork("2001:db8:0:1:2:3:4:5"))
+	assert.Equal(t, "unknown", clientNetwork("unknown"))
+}
+
+func Test_rateLimiterMiddleware(t *testing.T) {
+	l := newRateLimiter(1, time.Hour)
+	h := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	request := func(remoteAddr string, uid uuid.UUID, issued bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "http://localhost:8080/", nil)
+		r.RemoteAddr = remoteAddr
+		ctx := auth.Context(r.Context(), uid)
+		if issued {
+			ctx = auth.IssuedContext(ctx)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r.WithContext(ctx))
+		return w
+	}
+
+	uid := uuid.Must(uuid.NewV4())
+	w := request("10.0.0.1:1234", uid, false)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "3600", w.Header().Get("X-RateLimit-Reset"))
+
+	// returning user is limited by uid whatever address is
+	w = request("10.0.0.2:1234", uid, false)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "3600", w.Header().Get("Retry-After"))
+
+	// new users are limited by address as their uid changes every time
+	w = request("10.0.0.3:1234", uuid.Must(uuid.NewV4()), true)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = request("10.0.0.3:4321", uuid.Must(uuid.NewV4()), true)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// returning users are limited by address as well
+	w = request("10.0.0.1:4321", uuid.Must(uuid.NewV4()), false)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// IPv6 clients are limited by /64 network
+	w = request("[2001:db8:0:1::1]:1234", uuid.Must(uuid.NewV4()), true)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = request("[2001:db8:0:1:ffff::2]:1234", uuid.Must(uuid.NewV4()), true)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	w = request("[2001:db8:0:2::1]:1234", uuid.Must(uuid.NewV4()), true)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	t.Run("nil", func(t *testing.T) {
+		var l *rateLimiter
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		assert.NotNil(t, l.middleware(next))
+	})
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"net"
 	"net/http"
 	"net/http/pprof"
 	"strings"
@@ -13,21 +15,55 @@ import (
 	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
 )
 
-func newRouter(i *app.Instance) http.Handler {
+func newRouter(i *app.Instance, limits routeLimits, proxies trustedProxies, s session) http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
-	r.Use(gzipMiddleware, authMiddleware)
-	r.Use(middleware.RealIP)
+	r.Use(gzipMiddleware, i.APIKeyMiddleware, authMiddleware(s, i.SessionEpoch))
+	r.Use(proxies.middleware, clientMiddleware)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
-	r.Post("/", i.ShortenHandler)
-	r.Post("/api/shorten", i.ShortenAPIHandler)
-	r.Post("/api/shorten/batch", i.BatchShortenAPIHandler)
+	r.With(limits.shorten.middleware).Post("/", i.ShortenHandler)
+	r.With(limits.shorten.middleware).Post("/api/shorten", i.ShortenAPIHandler)
+	r.With(limits.batch.middleware).Post("/api/shorten/batch", i.BatchShortenAPIHandler)
 	r.Delete("/api/user/urls", i.BatchRemoveAPIHandler)
-	r.Get("/{id}", i.ExpandHandler)
+	r.With(limits.redirect.middleware).Get("/{id}", i.ExpandHandler)
+	r.With(limits.redirect.middleware).Head("/{id}", i.ExpandHandler)
+	r.Get("/{id}/qr", i.QRHandler)
+	r.With(limits.redirect.middleware).Get("/{id}/*", i.ExpandHandler)
+	r.With(limits.redirect.middleware).Head("/{id}/*", i.ExpandHandler)
+	r.With(limits.redirect.middleware).Post("/{id}", i.UnlockHandler)
 	r.Get("/api/user/urls", i.UserURLsHandler)
+	r.Get("/api/user/urls/export", i.ExportHandler)
+	r.With(limits.batch.middleware).Post("/api/user/urls/import", i.ImportHandler)
+	r.With(limits.edit.middleware).Patch("/api/user/urls/{id}", i.UpdateURLHandler)
+	r.Get("/api/user/urls/{id}/history", i.URLHistoryHandler)
+	r.With(limits.edit.middleware).Post("/api/user/urls/{id}/rollback", i.RollbackURLHandler)
+	r.Get("/api/user/urls/{id}/rules", i.RulesHandler)
+	r.With(limits.edit.middleware).Put("/api/user/urls/{id}/rules", i.UpdateRulesHandler)
+	r.Get("/api/user/urls/{id}/variants", i.VariantsHandler)
+	r.With(limits.edit.middleware).Put("/api/user/urls/{id}/variants", i.UpdateVariantsHandler)
+	r.With(limits.edit.middleware).Put("/api/user/urls/{id}/redirect", i.UpdateRedirectStatusHandler)
+	r.Get("/api/user/quota", i.QuotaHandler)
+	r.Get("/api/user/settings", i.UserSettingsHandler)
+	r.With(limits.edit.middleware).Put("/api/user/settings", i.UpdateUserSettingsHandler)
+	r.With(limits.edit.middleware).Post("/api/user/urls/transfer", i.TransferOfferHandler)
+	r.With(limits.edit.middleware).Post("/api/user/urls/transfer/accept", i.TransferAcceptHandler)
+	r.With(limits.edit.middleware).Delete("/api/user/urls/transfer/{id}", i.TransferCancelHandler)
+	r.Get("/api/user/audit", i.AuditHandler)
+	r.With(limits.account.middleware).Post("/api/user/register", i.RegisterHandler)
+	r.With(limits.account.middleware).Post("/api/user/login", i.LoginHandler)
+	r.Post("/api/user/logout", i.LogoutHandler)
+	r.With(limits.account.middleware).Delete("/api/user/sessions", i.RevokeSessionsHandler)
+	r.With(limits.account.middleware).Put("/api/user/password", i.ChangePasswordHandler)
+	r.Get("/api/user/keys", i.KeysHandler)
+	r.With(limits.account.middleware).Post("/api/user/keys", i.CreateKeyHandler)
+	r.With(limits.account.middleware).Delete("/api/user/keys/{id}", i.RevokeKeyHandler)
+	r.With(limits.report.middleware).Post("/api/report/{id}", i.ReportHandler)
+	r.With(i.AdminMiddleware).Get("/api/admin/reports", i.ReportsHandler)
+	r.With(i.AdminMiddleware).Post("/api/admin/urls/{id}/disable", i.DisableHandler)
+	r.With(i.AdminMiddleware).Delete("/api/admin/urls/{id}/disable", i.EnableHandler)
 	r.Get("/ping", i.PingHandler)
 
 	r.Get("/debug/pprof/", pprof.Index)
@@ -70,40 +106,84 @@ func gzipMiddleware(h http.Handler) http.Handler {
 	})
 }
 
-func authMiddleware(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var uid *uuid.UUID
+// sessionEpochFunc returns current session epoch of user, tokens of older epochs are revoked
+type sessionEpochFunc func(ctx context.Context, uid uuid.UUID) (int64, error)
+
+// authMiddleware authenticates requests by auth cookie issuing new uid to clients without valid one.
+// Cookies close to expiry are re-issued.
+// Epoch of anonymous cookies is zero, such cookies are checked against epoch only when re-issued.
+func authMiddleware(s session, epoch sessionEpochFunc) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// request has already been authenticated by API key
+			if auth.UIDFromContext(r.Context()) != nil {
+				h.ServeHTTP(w, r)
+				return
+			}
 
-		cookie, err := r.Cookie("auth")
-		if cookie != nil {
-			uid, err = auth.DecodeUIDFromHex(cookie.Value)
-		}
-		// generate new uid if failed to obtain existing
-		if uid == nil {
-			userID := ensureRandom()
-			uid = &userID
-		}
+			var signedIn *auth.Session
+			var refresh bool
+
+			cookie, err := r.Cookie(authCookieName)
+			if cookie != nil {
+				signedIn, refresh, err = s.codec.Decode(cookie.Value)
+			}
+			// keep store off requests of anonymous users
+			if signedIn != nil && (signedIn.Epoch > 0 || refresh) {
+				current, epochErr := epoch(r.Context(), signedIn.UID)
+				if epochErr != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					_, _ = w.Write([]byte("cannot check auth session"))
+					return
+				}
+				if signedIn.Epoch < current {
+					signedIn, err = nil, auth.ErrSessionRevoked
+				}
+			}
+			// generate new uid if failed to obtain existing
+			if signedIn == nil {
+				signedIn = &auth.Session{UID: ensureRandom()}
+			}
+
+			// set new auth cookie in case of absence, decode error or refresh
+			if err != nil || refresh {
+				value, err := s.codec.Encode(*signedIn)
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					_, _ = w.Write([]byte("cannot encode auth cookie"))
+					return
+				}
+				http.SetCookie(w, s.cookie(r, value))
+			}
 
-		// set new auth cookie in case of absence or decode error
-		if err != nil {
-			value, err := auth.EncodeUIDToHex(*uid)
+			// set uid to context
+			ctx := auth.Context(r.Context(), signedIn.UID)
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				_, _ = w.Write([]byte("cannot encode auth cookie"))
-				return
+				ctx = auth.IssuedContext(ctx)
 			}
-			cookie = &http.Cookie{Name: "auth", Value: value}
-			http.SetCookie(w, cookie)
-		}
+			r = r.WithContext(ctx)
 
-		// set uid to context
-		ctx := auth.Context(r.Context(), *uid)
-		r = r.WithContext(ctx)
+			h.ServeHTTP(w, r)
+		})
+	}
+}
 
-		h.ServeHTTP(w, r)
+// clientMiddleware sets client IP resolved by trustedProxies.middleware to context
+func clientMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(app.ClientContext(r.Context(), remoteIP(r))))
 	})
 }
 
+// remoteIP returns client IP without port
+func remoteIP(r *http.Request) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return ip
+}
+
 func ensureRandom() (res uuid.UUID) {
 	for i := 0; i < 10; i++ {
 		res = uuid.Must(uuid.NewV4())
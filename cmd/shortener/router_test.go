@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
+	"encoding/hex"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/app"
 	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/config"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
 )
 
 func Test_authMiddleware(t *testing.T) {
@@ -17,7 +24,7 @@ func Test_authMiddleware(t *testing.T) {
 		r := httptest.NewRequest("GET", "/api/user/urls", nil)
 		w := httptest.NewRecorder()
 
-		mw := authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mw := authMiddleware(session{codec: auth.CookieCodec{}}, noEpoch)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			assert.NotNil(t, auth.UIDFromContext(r.Context()))
 		}))
 		mw.ServeHTTP(w, r)
@@ -25,12 +32,36 @@ func Test_authMiddleware(t *testing.T) {
 		assert.NotEmpty(t, w.Header().Get("Set-Cookie"))
 	})
 
+	t.Run("attributes", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/api/user/urls", nil)
+		w := httptest.NewRecorder()
+
+		s := session{codec: auth.CookieCodec{}, maxAge: time.Hour, sameSite: http.SameSiteStrictMode}
+		authMiddleware(s, noEpoch)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, "/", cookies[0].Path)
+		assert.Equal(t, 3600, cookies[0].MaxAge)
+		assert.True(t, cookies[0].HttpOnly)
+		assert.False(t, cookies[0].Secure)
+		assert.Equal(t, http.SameSiteStrictMode, cookies[0].SameSite)
+
+		// Secure is set for requests over TLS
+		r = httptest.NewRequest("GET", "https://localhost/api/user/urls", nil)
+		w = httptest.NewRecorder()
+		authMiddleware(s, noEpoch)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+		cookies = w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.True(t, cookies[0].Secure)
+	})
+
 	t.Run("bad_cookie", func(t *testing.T) {
 		r := httptest.NewRequest("GET", "/api/user/urls", nil)
 		r.AddCookie(&http.Cookie{Name: "auth", Value: "ololo"})
 		w := httptest.NewRecorder()
 
-		mw := authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mw := authMiddleware(session{codec: auth.CookieCodec{}}, noEpoch)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			assert.NotNil(t, auth.UIDFromContext(r.Context()))
 		}))
 		mw.ServeHTTP(w, r)
@@ -47,11 +78,161 @@ func Test_authMiddleware(t *testing.T) {
 		r.AddCookie(&http.Cookie{Name: "auth", Value: cookie})
 		w := httptest.NewRecorder()
 
-		mw := authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mw := authMiddleware(session{codec: auth.CookieCodec{}}, noEpoch)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			assert.Equal(t, &uid, auth.UIDFromContext(r.Context()))
 		}))
 		mw.ServeHTTP(w, r)
 
 		assert.Empty(t, w.Header().Get("Set-Cookie"))
 	})
+
+	t.Run("authenticated", func(t *testing.T) {
+		uid := uuid.Must(uuid.NewV4())
+		r := httptest.NewRequest("GET", "/api/user/urls", nil)
+		r = r.WithContext(auth.Context(r.Context(), uid))
+		w := httptest.NewRecorder()
+
+		mw := authMiddleware(session{codec: auth.CookieCodec{}}, noEpoch)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, &uid, auth.UIDFromContext(r.Context()))
+		}))
+		mw.ServeHTTP(w, r)
+
+		assert.Empty(t, w.Header().Get("Set-Cookie"))
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		uid := uuid.Must(uuid.NewV4())
+		cookie, err := auth.EncodeUIDToHex(uid)
+		require.NoError(t, err)
+		jwt, err := auth.NewHS256Codec([]byte("ololo-trololo-shimba-boomba-look"), time.Hour)
+		require.NoError(t, err)
+
+		r := httptest.NewRequest("GET", "/api/user/urls", nil)
+		r.AddCookie(&http.Cookie{Name: "auth", Value: cookie})
+		w := httptest.NewRecorder()
+
+		mw := authMiddleware(session{codec: auth.NewTransitionCodec(jwt, auth.CookieCodec{})}, noEpoch)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, &uid, auth.UIDFromContext(r.Context()))
+			assert.False(t, auth.IssuedFromContext(r.Context()))
+		}))
+		mw.ServeHTTP(w, r)
+
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		got, _, err := jwt.Decode(cookies[0].Value)
+		require.NoError(t, err)
+		assert.Equal(t, &auth.Session{UID: uid}, got)
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		uid := uuid.Must(uuid.NewV4())
+		codec := auth.CookieCodec{}
+		epoch := func(ctx context.Context, uid uuid.UUID) (int64, error) { return 2, nil }
+
+		for _, tt := range []struct {
+			epoch   int64
+			wantUID bool
+		}{
+			{epoch: 1},
+			{epoch: 2, wantUID: true},
+			// anonymous cookies are not checked until re-issued
+			{epoch: 0, wantUID: true},
+		} {
+			cookie, err := codec.Encode(auth.Session{UID: uid, Epoch: tt.epoch})
+			require.NoError(t, err)
+
+			r := httptest.NewRequest("GET", "/api/user/urls", nil)
+			r.AddCookie(&http.Cookie{Name: "auth", Value: cookie})
+			w := httptest.NewRecorder()
+
+			var got *uuid.UUID
+			authMiddleware(session{codec: codec}, epoch)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = auth.UIDFromContext(r.Context())
+			})).ServeHTTP(w, r)
+
+			require.NotNil(t, got)
+			assert.Equal(t, tt.wantUID, *got == uid)
+		}
+	})
+}
+
+// noEpoch treats every user as having no account
+func noEpoch(context.Context, uuid.UUID) (int64, error) {
+	return 0, nil
+}
+
+func Test_newSession(t *testing.T) {
+	defer func(baseURL, sameSite string) {
+		config.BaseURL, config.CookieSameSite = baseURL, sameSite
+	}(config.BaseURL, config.CookieSameSite)
+
+	tests := []struct {
+		name         string
+		baseURL      string
+		sameSite     string
+		wantSecure   bool
+		wantSameSite http.SameSite
+		wantErr      bool
+	}{
+		{name: "default", baseURL: "http://localhost:8080", sameSite: "lax", wantSameSite: http.SameSiteLaxMode},
+		{name: "https", baseURL: "https://short.ly", sameSite: "Strict", wantSecure: true, wantSameSite: http.SameSiteStrictMode},
+		{name: "none", baseURL: "http://localhost:8080", sameSite: "none", wantSecure: true, wantSameSite: http.SameSiteNoneMode},
+		{name: "unknown", baseURL: "http://localhost:8080", sameSite: "ololo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.BaseURL, config.CookieSameSite = tt.baseURL, tt.sameSite
+
+			s, err := newSession()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSecure, s.secure)
+			assert.Equal(t, tt.wantSameSite, s.sameSite)
+			assert.Equal(t, config.SessionMaxAge, s.maxAge)
+		})
+	}
+}
+
+func Test_newKeyRing(t *testing.T) {
+	defer func(baseURL, keys string) {
+		config.BaseURL, config.AuthKeys = baseURL, keys
+	}(config.BaseURL, config.AuthKeys)
+
+	config.BaseURL, config.AuthKeys = "http://localhost:8080", ""
+	ring, err := newKeyRing()
+	require.NoError(t, err)
+	assert.Nil(t, ring)
+
+	// built-in secret is public
+	config.BaseURL = "https://short.ly"
+	_, err = newKeyRing()
+	assert.Error(t, err)
+
+	config.AuthKeys = "new:000102030405060708090a0b0c0d0e0f,default:" + hex.EncodeToString(config.AuthSecret)
+	ring, err = newKeyRing()
+	require.NoError(t, err)
+	assert.NotNil(t, ring)
+}
+
+func Test_newRouter(t *testing.T) {
+	storage := store.NewInMemory()
+	docs, _ := url.Parse("https://example.com/docs/")
+	id, err := storage.SaveUserOptions(context.Background(), uuid.Must(uuid.NewV4()), docs, store.Options{Passthrough: true})
+	require.NoError(t, err)
+
+	router := newRouter(app.NewInstance("http://localhost:8080", storage), routeLimits{}, nil, session{codec: auth.CookieCodec{}})
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		t.Run(method, func(t *testing.T) {
+			r := httptest.NewRequest(method, "/"+id+"/guide", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+			assert.Equal(t, "https://example.com/docs/guide", w.Header().Get("Location"))
+		})
+	}
 }
@@ -0,0 +1,189 @@
+package app
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+const (
+	// adminTokenHeader carries token granting access to admin endpoints
+	adminTokenHeader = "X-Admin-Token"
+	// maxReportReason limits length of abuse report reason in characters
+	maxReportReason = 1000
+)
+
+var takedownPage = template.Must(template.New("takedown").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Link disabled</title></head>
+<body>
+<h1>This link has been disabled</h1>
+<p>The destination of this link was reported as harmful and is no longer available.</p>
+{{if .Reason}}<p>Reason: {{.Reason}}</p>{{end}}
+</body>
+</html>
+`))
+
+// ReportHandler saves visitor complaint about URL
+func (i *Instance) ReportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad ID given"))
+		return
+	}
+
+	var req models.ReportRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad request body given"))
+		return
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" || utf8.RuneCountInString(reason) > maxReportReason {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(fmt.Sprintf("Reason must be from 1 to %d characters long", maxReportReason)))
+		return
+	}
+
+	err = i.store.SaveReport(ctx, store.Report{
+		ID:        id,
+		Reason:    reason,
+		ClientIP:  clientIPFromContext(ctx),
+		CreatedAt: time.Now().UTC(),
+	})
+	// repeated and excess reports are accepted silently, there is nothing client can do about them
+	if err != nil && !errors.Is(err, store.ErrConflict) {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ReportsHandler returns complaints about all URLs or URL given by query
+func (i *Instance) ReportsHandler(w http.ResponseWriter, r *http.Request) {
+	reports, err := i.store.LoadReports(r.Context(), r.URL.Query().Get("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	resp := make([]models.ReportResponse, 0, len(reports))
+	for _, report := range reports {
+		resp = append(resp, models.ReportResponse{
+			ShortURL:  i.baseURL + "/" + report.ID,
+			Reason:    report.Reason,
+			ClientIP:  report.ClientIP,
+			CreatedAt: report.CreatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// DisableHandler takes URL down regardless of its owner
+func (i *Instance) DisableHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad ID given"))
+		return
+	}
+
+	var req models.DisableRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad request body given"))
+		return
+	}
+
+	err = i.store.Disable(ctx, id, store.Takedown{
+		Reason:     strings.TrimSpace(req.Reason),
+		Legal:      req.Legal,
+		DisabledAt: time.Now().UTC(),
+	})
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	i.recordAudit(ctx, store.AuditDisable, auditChange{id: id, after: req.Reason})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// EnableHandler brings disabled URL back
+func (i *Instance) EnableHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad ID given"))
+		return
+	}
+
+	if err := i.store.Enable(ctx, id); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	i.recordAudit(ctx, store.AuditEnable, auditChange{id: id})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminMiddleware lets through requests carrying admin token.
+// Admin endpoints are hidden if no token configured.
+func (i *Instance) AdminMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if i.adminToken == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		token := r.Header.Get(adminTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(i.adminToken)) != 1 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// writeTakedown responds to disabled URL with warning page,
+// legal takedowns are answered with 451 and other ones with 410
+func writeTakedown(w http.ResponseWriter, takedown *store.Takedown) {
+	status := http.StatusGone
+	if takedown.Legal {
+		status = http.StatusUnavailableForLegalReasons
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	err := takedownPage.Execute(w, takedown)
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+func Test_takedown(t *testing.T) {
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+	storage := store.NewInMemory()
+	id, err := storage.Save(context.Background(), u)
+	require.NoError(t, err)
+
+	instance := NewInstance("http://localhost:8080", storage, WithAdminToken("secret"))
+
+	call := func(handler http.HandlerFunc, method, id, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "http://localhost:8080/", strings.NewReader(body))
+		r.Header.Set(adminTokenHeader, "secret")
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		r = r.WithContext(ClientContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx), "10.0.0.1"))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	t.Run("report", func(t *testing.T) {
+		w := call(instance.ReportHandler, "POST", id, `{"reason":"  phishing  "}`)
+		assert.Equal(t, http.StatusAccepted, w.Code)
+
+		// repeated report of the same client is accepted but not stored
+		w = call(instance.ReportHandler, "POST", id, `{"reason":"spam"}`)
+		assert.Equal(t, http.StatusAccepted, w.Code)
+
+		w = call(instance.ReportHandler, "POST", id, `{"reason":""}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = call(instance.ReportHandler, "POST", "ololo", `{"reason":"spam"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = call(instance.ReportsHandler, "GET", "", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp []models.ReportResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Len(t, resp, 1)
+		assert.Equal(t, "http://localhost:8080/"+id, resp[0].ShortURL)
+		assert.Equal(t, "phishing", resp[0].Reason)
+		assert.Equal(t, "10.0.0.1", resp[0].ClientIP)
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		w := call(instance.DisableHandler, "POST", id, `{"reason":"court order","legal":true}`)
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		w = call(instance.ExpandHandler, "GET", id, "")
+		assert.Equal(t, http.StatusUnavailableForLegalReasons, w.Code)
+		assert.Empty(t, w.Header().Get("Location"))
+		assert.Contains(t, w.Body.String(), "Reason: court order")
+
+		w = call(instance.UnlockHandler, "POST", id, "")
+		assert.Equal(t, http.StatusUnavailableForLegalReasons, w.Code)
+
+		w = call(instance.DisableHandler, "POST", id, `{"reason":"malware"}`)
+		require.Equal(t, http.StatusNoContent, w.Code)
+		w = call(instance.ExpandHandler, "GET", id, "")
+		assert.Equal(t, http.StatusGone, w.Code)
+
+		w = call(instance.DisableHandler, "POST", "ololo", `{"reason":"malware"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("enable", func(t *testing.T) {
+		w := call(instance.EnableHandler, "DELETE", id, "")
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		w = call(instance.ExpandHandler, "GET", id, "")
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, u.String(), w.Header().Get("Location"))
+	})
+}
+
+func Test_AdminMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		configured string
+		given      string
+		want       int
+	}{
+		{name: "disabled", configured: "", given: "", want: http.StatusNotFound},
+		{name: "missing", configured: "secret", given: "", want: http.StatusForbidden},
+		{name: "wrong", configured: "secret", given: "guess", want: http.StatusForbidden},
+		{name: "valid", configured: "secret", given: "secret", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := &Instance{adminToken: tt.configured}
+			r := httptest.NewRequest("GET", "http://localhost:8080/api/admin/reports", nil)
+			if tt.given != "" {
+				r.Header.Set(adminTokenHeader, tt.given)
+			}
+			w := httptest.NewRecorder()
+			instance.AdminMiddleware(ok).ServeHTTP(w, r)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
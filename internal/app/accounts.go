@@ -0,0 +1,344 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+const (
+	minAccountPassword = 8
+	// maxAccountPassword is a number of bytes bcrypt takes into account
+	maxAccountPassword = 72
+	maxEmail           = 254
+	// loginAttempts is a number of password attempts allowed per account and client IP within loginWindow
+	loginAttempts = 5
+	loginWindow   = time.Minute
+)
+
+// dummyPasswordHash is compared with password of unknown account
+// to answer as long as for existing one
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("ololo-trololo"), bcrypt.DefaultCost)
+
+// SessionIssuer sets and clears auth cookie of signed in user
+type SessionIssuer interface {
+	Issue(w http.ResponseWriter, r *http.Request, s auth.Session) error
+	Clear(w http.ResponseWriter, r *http.Request)
+}
+
+// SessionEpoch returns session epoch of account of uid, tokens of older epochs are revoked.
+// Users without account are of epoch zero.
+func (i *Instance) SessionEpoch(ctx context.Context, uid uuid.UUID) (int64, error) {
+	account, err := i.store.LoadUserAccount(ctx, uid)
+	if errors.Is(err, store.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return account.SessionEpoch, nil
+}
+
+// issueSession sets auth cookie of session unless sessions are disabled
+func (i *Instance) issueSession(w http.ResponseWriter, r *http.Request, s auth.Session) bool {
+	if i.sessions == nil {
+		return true
+	}
+	if err := i.sessions.Issue(w, r, s); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return false
+	}
+	return true
+}
+
+// RegisterHandler creates account owning links of current user.
+// Account starts with session epoch 1, so tokens issued to anonymous user before are revoked once due for refresh.
+func (i *Instance) RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	var req models.AccountRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad request body given"))
+		return
+	}
+
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(fmt.Sprintf("Bad email given: %s", err)))
+		return
+	}
+	if err := checkAccountPassword(req.Password); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(fmt.Sprintf("Bad password given: %s", err)))
+		return
+	}
+
+	hash, err := hashPassword(req.Password)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	err = i.store.SaveAccount(ctx, store.Account{
+		UserID:       *uid,
+		Email:        email,
+		PasswordHash: hash,
+		CreatedAt:    time.Now().UTC(),
+		SessionEpoch: 1,
+	})
+	if errors.Is(err, store.ErrConflict) {
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte("Email or user is already registered"))
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !i.issueSession(w, r, auth.Session{UID: *uid, Epoch: 1}) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(models.AccountResponse{Email: email})
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// LoginHandler signs user in moving links of current anonymous user to account
+func (i *Instance) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req models.AccountRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad request body given"))
+		return
+	}
+
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(fmt.Sprintf("Bad email given: %s", err)))
+		return
+	}
+
+	if ok, retryAfter := i.loginLimiter.allow(clientAttemptKey(ctx, email)); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds()+1)))
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte("Too many password attempts"))
+		return
+	}
+
+	account, err := i.store.LoadAccount(ctx, email)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		writeStoreError(w, err)
+		return
+	}
+	hash := []byte(account.PasswordHash)
+	if err != nil {
+		hash = dummyPasswordHash
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(req.Password)) != nil || err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte("Wrong email or password"))
+		return
+	}
+
+	merged, err := i.claimLinks(ctx, account.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	if !i.issueSession(w, r, auth.Session{UID: account.UserID, Epoch: account.SessionEpoch}) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(models.AccountResponse{Email: email, Merged: merged})
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// LogoutHandler signs user out, following requests are made by new anonymous user
+func (i *Instance) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if i.sessions != nil {
+		i.sessions.Clear(w, r)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeSessionsHandler signs user out on all devices revoking every session of account
+func (i *Instance) RevokeSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := i.store.RevokeSessions(ctx, *uid); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if i.sessions != nil {
+		i.sessions.Clear(w, r)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangePasswordHandler replaces password of current user account
+// revoking its sessions but current one, which is issued again
+func (i *Instance) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad request body given"))
+		return
+	}
+
+	account, err := i.store.LoadUserAccount(ctx, *uid)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	if ok, retryAfter := i.loginLimiter.allow(clientAttemptKey(ctx, account.Email)); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds()+1)))
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte("Too many password attempts"))
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(req.CurrentPassword)) != nil {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("Wrong password"))
+		return
+	}
+	if err := checkAccountPassword(req.NewPassword); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(fmt.Sprintf("Bad password given: %s", err)))
+		return
+	}
+
+	hash, err := hashPassword(req.NewPassword)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	if err := i.store.SetPassword(ctx, *uid, hash); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !i.issueSession(w, r, auth.Session{UID: *uid, Epoch: account.SessionEpoch + 1}) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// claimLinks moves links of current user to account unless current user has own account
+func (i *Instance) claimLinks(ctx context.Context, to uuid.UUID) (merged int, err error) {
+	from := auth.UIDFromContext(ctx)
+	if from == nil || *from == to {
+		return 0, nil
+	}
+
+	_, err = i.store.LoadUserAccount(ctx, *from)
+	if err == nil {
+		// links of other account are never taken
+		return 0, nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return 0, fmt.Errorf("cannot load account: %w", err)
+	}
+
+	urls, err := i.store.LoadUsers(ctx, *from)
+	if errors.Is(err, store.ErrNotFound) || len(urls) == 0 {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("cannot load user URLs: %w", err)
+	}
+
+	ids := make([]string, 0, len(urls))
+	for id := range urls {
+		ids = append(ids, id)
+	}
+	store.SortIDs(ids)
+
+	moved, err := i.store.TransferUsers(ctx, *from, to, ids...)
+	if err != nil {
+		return 0, fmt.Errorf("cannot move user URLs: %w", err)
+	}
+
+	changes := make([]auditChange, 0, len(moved))
+	for _, id := range moved {
+		changes = append(changes, auditChange{id: id, before: from.String(), after: to.String()})
+	}
+	i.recordAudit(ctx, store.AuditTransfer, changes...)
+	return len(moved), nil
+}
+
+// normalizeEmail returns bare email address in lower case
+func normalizeEmail(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", errors.New("empty email")
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s {
+		return "", errors.New("not an email address")
+	}
+	if len(s) > maxEmail {
+		return "", fmt.Errorf("email must be at most %d bytes long", maxEmail)
+	}
+	return strings.ToLower(s), nil
+}
+
+// checkAccountPassword reports whether password is long enough to protect account
+func checkAccountPassword(password string) error {
+	if len(password) < minAccountPassword || len(password) > maxAccountPassword {
+		return fmt.Errorf("password must be from %d to %d bytes long", minAccountPassword, maxAccountPassword)
+	}
+	return nil
+}
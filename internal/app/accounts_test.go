@@ -0,0 +1,168 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+// fakeSessions remembers last issued session
+type fakeSessions struct {
+	issued  *auth.Session
+	cleared bool
+}
+
+func (s *fakeSessions) Issue(w http.ResponseWriter, r *http.Request, session auth.Session) error {
+	s.issued = &session
+	return nil
+}
+
+func (s *fakeSessions) Clear(w http.ResponseWriter, r *http.Request) {
+	s.cleared = true
+}
+
+func Test_accounts(t *testing.T) {
+	ctx := context.Background()
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+	storage := store.NewInMemory()
+	sessions := &fakeSessions{}
+	instance := NewInstance("http://localhost:8080", storage, WithSessions(sessions))
+
+	owner := uuid.Must(uuid.NewV4())
+	anonymous := uuid.Must(uuid.NewV4())
+	ownID, err := storage.SaveUser(ctx, owner, u)
+	require.NoError(t, err)
+	anonIDs, err := storage.SaveUserBatch(ctx, anonymous, []*url.URL{u, u})
+	require.NoError(t, err)
+
+	call := func(handler http.HandlerFunc, uid uuid.UUID, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "http://localhost:8080/", strings.NewReader(body))
+		r = r.WithContext(auth.Context(r.Context(), uid))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	t.Run("register", func(t *testing.T) {
+		w := call(instance.RegisterHandler, owner, `{"email":"not an email","password":"password"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = call(instance.RegisterHandler, owner, `{"email":"user@example.com","password":"short"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = call(instance.RegisterHandler, owner, `{"email":" User@Example.com ","password":"password"}`)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var resp models.AccountResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "user@example.com", resp.Email)
+		// tokens issued before registration are revoked
+		assert.Equal(t, &auth.Session{UID: owner, Epoch: 1}, sessions.issued)
+
+		w = call(instance.RegisterHandler, uuid.Must(uuid.NewV4()), `{"email":"user@example.com","password":"password"}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		w = call(instance.RegisterHandler, owner, `{"email":"other@example.com","password":"password"}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("login", func(t *testing.T) {
+		sessions.issued = nil
+		w := call(instance.LoginHandler, anonymous, `{"email":"user@example.com","password":"wrong password"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w = call(instance.LoginHandler, anonymous, `{"email":"nobody@example.com","password":"password"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Nil(t, sessions.issued)
+
+		w = call(instance.LoginHandler, anonymous, `{"email":"USER@example.com","password":"password"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp models.AccountResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, 2, resp.Merged)
+		assert.Equal(t, &auth.Session{UID: owner, Epoch: 1}, sessions.issued)
+
+		// links of anonymous user now belong to account
+		urls, err := storage.LoadUsers(ctx, owner)
+		require.NoError(t, err)
+		assert.Len(t, urls, 3)
+		for _, id := range append(anonIDs, ownID) {
+			assert.Contains(t, urls, id)
+		}
+		urls, _ = storage.LoadUsers(ctx, anonymous)
+		assert.Empty(t, urls)
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		instance := NewInstance("http://localhost:8080", storage)
+		for n := 0; n < loginAttempts; n++ {
+			w := call(instance.LoginHandler, anonymous, `{"email":"user@example.com","password":"wrong password"}`)
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+		}
+		w := call(instance.LoginHandler, anonymous, `{"email":"user@example.com","password":"password"}`)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+		// failed attempts of one client do not lock account for others
+		r := httptest.NewRequest("POST", "http://localhost:8080/", strings.NewReader(`{"email":"user@example.com","password":"password"}`))
+		w = httptest.NewRecorder()
+		instance.LoginHandler(w, r.WithContext(ClientContext(auth.Context(r.Context(), anonymous), "10.0.0.2")))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("password", func(t *testing.T) {
+		// every password attempt counts, start over with limiter
+		instance := NewInstance("http://localhost:8080", storage, WithSessions(sessions))
+		w := call(instance.ChangePasswordHandler, owner, `{"current_password":"wrong password","new_password":"new password"}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = call(instance.ChangePasswordHandler, owner, `{"current_password":"password","new_password":"short"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = call(instance.ChangePasswordHandler, anonymous, `{"current_password":"password","new_password":"new password"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = call(instance.ChangePasswordHandler, owner, `{"current_password":"password","new_password":"new password"}`)
+		require.Equal(t, http.StatusNoContent, w.Code)
+		// other sessions are revoked, current one is issued again
+		epoch, err := instance.SessionEpoch(ctx, owner)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), epoch)
+		assert.Equal(t, &auth.Session{UID: owner, Epoch: 2}, sessions.issued)
+
+		w = call(instance.LoginHandler, owner, `{"email":"user@example.com","password":"new password"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("logout", func(t *testing.T) {
+		w := call(instance.LogoutHandler, owner, "")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.True(t, sessions.cleared)
+
+		// sessions on other devices are kept
+		epoch, err := instance.SessionEpoch(ctx, owner)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), epoch)
+	})
+
+	t.Run("revoke_sessions", func(t *testing.T) {
+		sessions.cleared = false
+		w := call(instance.RevokeSessionsHandler, owner, "")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.True(t, sessions.cleared)
+
+		epoch, err := instance.SessionEpoch(ctx, owner)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), epoch)
+
+		// anonymous users have no sessions to revoke
+		w = call(instance.RevokeSessionsHandler, uuid.Must(uuid.NewV4()), "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
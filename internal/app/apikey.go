@@ -0,0 +1,215 @@
+package app
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+// maxKeyName limits length of API key name in characters
+const maxKeyName = 100
+
+var errInvalidKey = errors.New("invalid API key")
+
+var ctxAPIKeyKey = struct{ name string }{"api_key"}
+
+// apiKeyFromContext returns ID of API key request has been authenticated by, empty if none
+func apiKeyFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxAPIKeyKey).(string)
+	return id
+}
+
+// CreateKeyHandler issues new API key to current user
+func (i *Instance) CreateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+	// leaked key must not be able to mint keys outliving its revocation
+	if apiKeyFromContext(ctx) != "" {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("API keys cannot be created with API key"))
+		return
+	}
+
+	var req models.CreateKeyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad request body given"))
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if utf8.RuneCountInString(name) > maxKeyName {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(fmt.Sprintf("Name must be at most %d characters long", maxKeyName)))
+		return
+	}
+
+	token, id, hash, err := auth.NewAPIKey()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	key := store.APIKey{
+		ID:        id,
+		UserID:    *uid,
+		Name:      name,
+		Hash:      hash,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := i.store.SaveKey(ctx, key); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	i.recordAudit(ctx, store.AuditKeyCreate, auditChange{after: key.ID})
+
+	resp := keyResponse(key)
+	// the key itself is never shown again
+	resp.Key = token
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// KeysHandler returns API keys of current user without their secrets
+func (i *Instance) KeysHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	keys, err := i.store.LoadUserKeys(ctx, *uid)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	resp := make([]models.KeyResponse, 0, len(keys))
+	for _, key := range keys {
+		resp = append(resp, keyResponse(key))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// RevokeKeyHandler revokes API key of current user
+func (i *Instance) RevokeKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad ID given"))
+		return
+	}
+
+	if err := i.store.RevokeKey(ctx, *uid, id, time.Now().UTC()); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	i.recordAudit(ctx, store.AuditKeyRevoke, auditChange{before: id})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIKeyMiddleware authenticates requests carrying API key as bearer token on behalf of key owner.
+// Requests with invalid key are refused rather than treated as anonymous ones.
+func (i *Instance) APIKeyMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		uid, id, err := i.authenticateKey(r.Context(), token)
+		if errors.Is(err, errInvalidKey) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("Invalid API key given"))
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+		ctx := context.WithValue(auth.Context(r.Context(), uid), ctxAPIKeyKey, id)
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticateKey returns owner and ID of active API key
+func (i *Instance) authenticateKey(ctx context.Context, token string) (uuid.UUID, string, error) {
+	id, hash, err := auth.ParseAPIKey(token)
+	if err != nil {
+		return uuid.Nil, "", errInvalidKey
+	}
+
+	key, err := i.store.LoadKey(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return uuid.Nil, "", errInvalidKey
+	}
+	if err != nil {
+		return uuid.Nil, "", fmt.Errorf("cannot load API key: %w", err)
+	}
+	if key.RevokedAt != nil || subtle.ConstantTimeCompare(hash, key.Hash) != 1 {
+		return uuid.Nil, "", errInvalidKey
+	}
+	return key.UserID, key.ID, nil
+}
+
+// bearerToken returns token of Authorization header with Bearer scheme
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(parts[1]), true
+}
+
+func keyResponse(key store.APIKey) models.KeyResponse {
+	return models.KeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		CreatedAt: key.CreatedAt,
+		RevokedAt: key.RevokedAt,
+	}
+}
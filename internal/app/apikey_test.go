@@ -0,0 +1,113 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+func Test_apiKeys(t *testing.T) {
+	uid := uuid.Must(uuid.NewV4())
+	audit := store.NewMemoryAudit()
+	instance := NewInstance("http://localhost:8080", store.NewInMemory(), WithAuditSink(audit))
+
+	call := func(handler http.HandlerFunc, method, id, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "http://localhost:8080/", strings.NewReader(body))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		r = r.WithContext(auth.Context(context.WithValue(r.Context(), chi.RouteCtxKey, rctx), uid))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+	authenticate := func(header string) (int, *uuid.UUID) {
+		var got *uuid.UUID
+		h := instance.APIKeyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = auth.UIDFromContext(r.Context())
+		}))
+		r := httptest.NewRequest("GET", "http://localhost:8080/api/user/urls", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code, got
+	}
+
+	w := call(instance.CreateKeyHandler, "POST", "", `{"name":" ci "}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created models.KeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "ci", created.Name)
+	assert.True(t, strings.HasPrefix(created.Key, "shk_"+created.ID+"_"))
+
+	w = call(instance.KeysHandler, "GET", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var keys []models.KeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &keys))
+	require.Len(t, keys, 1)
+	assert.Equal(t, created.ID, keys[0].ID)
+	assert.Empty(t, keys[0].Key)
+
+	t.Run("authenticate", func(t *testing.T) {
+		code, got := authenticate("Bearer " + created.Key)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, &uid, got)
+
+		code, got = authenticate("")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Nil(t, got)
+
+		code, _ = authenticate("Bearer " + created.Key + "x")
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		code, _ = authenticate("Bearer ololo")
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("create_with_key", func(t *testing.T) {
+		h := instance.APIKeyMiddleware(http.HandlerFunc(instance.CreateKeyHandler))
+		r := httptest.NewRequest("POST", "http://localhost:8080/api/user/keys", strings.NewReader(`{"name":"more"}`))
+		r.Header.Set("Authorization", "Bearer "+created.Key)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		w := call(instance.RevokeKeyHandler, "DELETE", "ololo", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = call(instance.RevokeKeyHandler, "DELETE", created.ID, "")
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		w = call(instance.RevokeKeyHandler, "DELETE", created.ID, "")
+		assert.Equal(t, http.StatusGone, w.Code)
+
+		code, _ := authenticate("Bearer " + created.Key)
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("audit", func(t *testing.T) {
+		entries, err := audit.LoadUserAudit(context.Background(), uid)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, store.AuditKeyCreate, entries[0].Action)
+		assert.Equal(t, created.ID, entries[0].After)
+		assert.Equal(t, store.AuditKeyRevoke, entries[1].Action)
+		assert.Equal(t, created.ID, entries[1].Before)
+	})
+}
@@ -2,6 +2,10 @@
 package app
 
 import (
+	"html/template"
+
+	"github.com/skip2/go-qrcode"
+
 	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
 )
 
@@ -10,12 +14,102 @@ type Instance struct {
 	baseURL string
 
 	store store.AuthStore
+	audit store.AuditSink
+
+	// unlockLimiter limits password attempts per protected URL and client
+	unlockLimiter *attemptLimiter
+	// unlockURLLimiter limits password attempts per protected URL from all clients
+	unlockURLLimiter *attemptLimiter
+	// comingSoon is served for not yet active URLs, plain 404 if nil
+	comingSoon *template.Template
+	// fetchTitle looks up destination title for preview page, no title shown if nil
+	fetchTitle titleFetcher
+	// titles caches fetched destination titles, every preview fetches title if nil
+	titles *titleCache
+	// qr renders QR codes of short URLs
+	qr *qrRenderer
+	// blocklist denies shortening URLs of listed domains, nothing denied if nil
+	blocklist *Blocklist
+	// adminToken grants access to admin endpoints, they are disabled if empty
+	adminToken string
+	// quota limits URLs of every user, zero quota limits nothing
+	quota quota
+	// issuedUsage counts URLs saved under freshly issued uids per client IP
+	issuedUsage *ipUsage
+	// sessions issues auth cookies on login, no cookies are set if nil
+	sessions SessionIssuer
+	// loginLimiter limits password attempts per account
+	loginLimiter *attemptLimiter
+	// settings caches user defaults applied on redirect, store is asked every time if nil
+	settings *settingsCache
+}
+
+// Option describes optional app instance setting
+type Option func(i *Instance)
+
+// WithAuditSink sets sink to record state-changing operations to
+func WithAuditSink(sink store.AuditSink) Option {
+	return func(i *Instance) {
+		i.audit = sink
+	}
+}
+
+// WithComingSoonPage sets page to serve for not yet active URLs
+func WithComingSoonPage(tmpl *template.Template) Option {
+	return func(i *Instance) {
+		i.comingSoon = tmpl
+	}
+}
+
+// WithQRCode sets default error correction level and margin of QR codes
+func WithQRCode(level qrcode.RecoveryLevel, margin int) Option {
+	return func(i *Instance) {
+		i.qr = newQRRenderer(level, margin)
+	}
+}
+
+// WithBlocklist sets domains denied to be shortened
+func WithBlocklist(blocklist *Blocklist) Option {
+	return func(i *Instance) {
+		i.blocklist = blocklist
+	}
+}
+
+// WithAdminToken sets token granting access to admin endpoints
+func WithAdminToken(token string) Option {
+	return func(i *Instance) {
+		i.adminToken = token
+	}
+}
+
+// WithQuota limits number of active URLs and URLs created per day by every user, zero means no limit
+func WithQuota(active, daily int) Option {
+	return func(i *Instance) {
+		i.quota = quota{active: active, daily: daily}
+	}
+}
+
+// WithSessions sets issuer of auth cookies of signed in users
+func WithSessions(sessions SessionIssuer) Option {
+	return func(i *Instance) {
+		i.sessions = sessions
+	}
 }
 
 // NewInstance return new app instance.
-func NewInstance(baseURL string, storage store.AuthStore) *Instance {
-	return &Instance{
-		baseURL: baseURL,
-		store:   storage,
+func NewInstance(baseURL string, storage store.AuthStore, opts ...Option) *Instance {
+	i := &Instance{
+		baseURL:          baseURL,
+		store:            storage,
+		unlockLimiter:    newAttemptLimiter(unlockAttempts, unlockWindow),
+		unlockURLLimiter: newAttemptLimiter(unlockURLAttempts, unlockWindow),
+		loginLimiter:     newAttemptLimiter(loginAttempts, loginWindow),
+		qr:               newQRRenderer(qrcode.Medium, qrDefaultMargin),
+		settings:         newSettingsCache(settingsTTL),
+		issuedUsage:      newIPUsage(),
+	}
+	for _, opt := range opts {
+		opt(i)
 	}
+	return i
 }
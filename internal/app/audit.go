@@ -0,0 +1,115 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+var ctxClientIPKey = struct{ name string }{"client_ip"}
+
+// ClientContext returns context with client IP
+func ClientContext(parent context.Context, ip string) context.Context {
+	return context.WithValue(parent, ctxClientIPKey, ip)
+}
+
+// clientIPFromContext get client IP from context
+func clientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(ctxClientIPKey).(string)
+	return ip
+}
+
+// AuditHandler returns state-changing operations made by user
+func (i *Instance) AuditHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	if i.audit == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	entries, err := i.audit.LoadUserAudit(ctx, *uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(entries) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp := make([]models.AuditEntryResponse, 0, len(entries))
+	for _, e := range entries {
+		entry := models.AuditEntryResponse{
+			Time:      e.Time,
+			RequestID: e.RequestID,
+			ClientIP:  e.ClientIP,
+			Action:    e.Action,
+			Before:    e.Before,
+			After:     e.After,
+		}
+		// user-wide changes such as settings refer to no URL
+		if e.ShortID != "" {
+			entry.ShortURL = i.baseURL + "/" + e.ShortID
+		}
+		resp = append(resp, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// auditChange describes single changed record
+type auditChange struct {
+	id     string
+	before string
+	after  string
+}
+
+// recordAudit writes entries of operation to audit sink.
+// Audit failures are only logged as operation has been already done.
+func (i *Instance) recordAudit(ctx context.Context, action string, changes ...auditChange) {
+	if i.audit == nil || len(changes) == 0 {
+		return
+	}
+
+	now := time.Now()
+	uid := auth.UIDFromContext(ctx)
+	requestID := middleware.GetReqID(ctx)
+	clientIP := clientIPFromContext(ctx)
+
+	entries := make([]store.AuditEntry, 0, len(changes))
+	for _, c := range changes {
+		entries = append(entries, store.AuditEntry{
+			Time:      now,
+			UserID:    uid,
+			RequestID: requestID,
+			ClientIP:  clientIP,
+			Action:    action,
+			ShortID:   c.id,
+			Before:    c.before,
+			After:     c.after,
+		})
+	}
+
+	if err := i.audit.WriteAudit(ctx, entries...); err != nil {
+		fmt.Printf("cannot write audit entries: %s\n", err)
+	}
+}
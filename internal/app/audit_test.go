@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+func Test_audit(t *testing.T) {
+	uid := uuid.Must(uuid.NewV4())
+
+	sink, err := store.NewFileAudit(filepath.Join(t.TempDir(), "audit.log"))
+	require.NoError(t, err)
+	defer sink.Close()
+
+	instance := NewInstance("http://localhost:8080", store.NewInMemory(), WithAuditSink(sink))
+
+	ctx := auth.Context(context.Background(), uid)
+	ctx = context.WithValue(ctx, middleware.RequestIDKey, "req-1")
+	ctx = ClientContext(ctx, "10.0.0.1")
+
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+	_, err = instance.shorten(ctx, u)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("DELETE", "http://localhost:8080/api/user/urls", strings.NewReader(`["0"]`))
+	w := httptest.NewRecorder()
+	instance.BatchRemoveAPIHandler(w, r.WithContext(ctx))
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	t.Run("other_user", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "http://localhost:8080/api/user/audit", nil)
+		r = r.WithContext(auth.Context(r.Context(), uuid.Must(uuid.NewV4())))
+		w := httptest.NewRecorder()
+		instance.AuditHandler(w, r)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("own_entries", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "http://localhost:8080/api/user/audit", nil)
+		r = r.WithContext(auth.Context(r.Context(), uid))
+		w := httptest.NewRecorder()
+		instance.AuditHandler(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var entries []models.AuditEntryResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+		require.Len(t, entries, 2)
+
+		assert.Equal(t, store.AuditShorten, entries[0].Action)
+		assert.Equal(t, "req-1", entries[0].RequestID)
+		assert.Equal(t, "10.0.0.1", entries[0].ClientIP)
+		assert.Equal(t, "http://localhost:8080/0", entries[0].ShortURL)
+		assert.Equal(t, "https://praktikum.yandex.ru/", entries[0].After)
+
+		assert.Equal(t, store.AuditDelete, entries[1].Action)
+		assert.Equal(t, "https://praktikum.yandex.ru/", entries[1].Before)
+		assert.Empty(t, entries[1].After)
+	})
+}
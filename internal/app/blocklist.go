@@ -0,0 +1,161 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+)
+
+// reasons of URL rejection
+const (
+	rejectBlockedDomain = "blocked_domain"
+	rejectSelfRedirect  = "self_redirect"
+)
+
+// rejectError describes URL refused to be shortened
+type rejectError struct {
+	code   string
+	reason string
+}
+
+func (e *rejectError) Error() string {
+	return e.code + ": " + e.reason
+}
+
+// writeRejectError responds with 422 and reason code if URL was rejected
+func writeRejectError(w http.ResponseWriter, err error) bool {
+	var rejected *rejectError
+	if !errors.As(err, &rejected) {
+		return false
+	}
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	_, _ = w.Write([]byte(rejected.Error()))
+	return true
+}
+
+// Blocklist denies shortening URLs of listed domains.
+// Every line of its file is either domain blocking itself with all subdomains,
+// or glob pattern like "*.example.*" matched against the whole host.
+// Empty lines and lines starting with # are ignored.
+type Blocklist struct {
+	path string
+
+	mutex    sync.RWMutex
+	domains  map[string]struct{}
+	patterns []string
+}
+
+// NewBlocklist loads blocklist from file
+func NewBlocklist(path string) (*Blocklist, error) {
+	b := &Blocklist{path: path}
+	if err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Reload reads blocklist file again, current list is kept on failure
+func (b *Blocklist) Reload() error {
+	f, err := os.Open(b.path)
+	if err != nil {
+		return fmt.Errorf("cannot open blocklist: %w", err)
+	}
+	defer f.Close()
+
+	domains := make(map[string]struct{})
+	var patterns []string
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.ContainsAny(line, "*?[") {
+			if _, err := path.Match(line, ""); err != nil {
+				return fmt.Errorf("bad blocklist pattern at line %d: %w", n, err)
+			}
+			patterns = append(patterns, line)
+			continue
+		}
+		host, err := canonicalHost(strings.TrimPrefix(line, "."))
+		if err != nil {
+			return fmt.Errorf("bad blocklist domain at line %d: %w", n, err)
+		}
+		domains[host] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cannot read blocklist: %w", err)
+	}
+
+	b.mutex.Lock()
+	b.domains = domains
+	b.patterns = patterns
+	b.mutex.Unlock()
+	return nil
+}
+
+// Blocked reports whether host is denied.
+// Nil blocklist denies nothing.
+func (b *Blocklist) Blocked(host string) bool {
+	if b == nil {
+		return false
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	for domain := host; domain != ""; {
+		if _, ok := b.domains[domain]; ok {
+			return true
+		}
+		n := strings.IndexByte(domain, '.')
+		if n < 0 {
+			break
+		}
+		domain = domain[n+1:]
+	}
+	for _, pattern := range b.patterns {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTarget rejects URLs of blocked domains and URLs leading back to the service
+func (i *Instance) checkTarget(ctx context.Context, u *url.URL) error {
+	if i.blocklist.Blocked(u.Hostname()) {
+		return &rejectError{code: rejectBlockedDomain, reason: fmt.Sprintf("domain %q is blocked", u.Hostname())}
+	}
+
+	base, err := canonicalURL(i.baseURL)
+	if err != nil || !strings.EqualFold(base.Hostname(), u.Hostname()) {
+		return nil
+	}
+	// both URLs are canonical, so default ports are omitted in each
+	if base.Scheme == u.Scheme && base.Port() == u.Port() {
+		return &rejectError{code: rejectSelfRedirect, reason: "URL points to this service"}
+	}
+
+	// the same host reached by other scheme or port may still be the service behind proxy
+	id := strings.SplitN(strings.TrimPrefix(strings.TrimPrefix(u.Path, base.Path), "/"), "/", 2)[0]
+	id = strings.TrimSuffix(id, previewSuffix)
+	if id == "" {
+		return nil
+	}
+	if _, err := i.store.LoadRecord(ctx, id); !errors.Is(err, store.ErrNotFound) {
+		return &rejectError{code: rejectSelfRedirect, reason: fmt.Sprintf("URL points to short URL %q of this service", id)}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+)
+
+func Test_Blocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte(`
+# phishing
+Evil.com
+.bad.org
+*.paypal.*
+пример.рф
+`), 0644))
+
+	blocklist, err := NewBlocklist(path)
+	require.NoError(t, err)
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "evil.com", want: true},
+		{host: "login.EVIL.com", want: true},
+		{host: "notevil.com", want: false},
+		{host: "bad.org", want: true},
+		{host: "www.paypal.com.example", want: true},
+		{host: "paypal.com", want: false},
+		{host: "xn--e1afmkfd.xn--p1ai", want: true},
+		{host: "praktikum.yandex.ru", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			assert.Equal(t, tt.want, blocklist.Blocked(tt.host))
+		})
+	}
+
+	t.Run("reload", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("notevil.com\n"), 0644))
+		require.NoError(t, blocklist.Reload())
+		assert.False(t, blocklist.Blocked("evil.com"))
+		assert.True(t, blocklist.Blocked("notevil.com"))
+	})
+
+	t.Run("bad_reload", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("[bad\n"), 0644))
+		assert.Error(t, blocklist.Reload())
+		assert.True(t, blocklist.Blocked("notevil.com"))
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		var blocklist *Blocklist
+		assert.False(t, blocklist.Blocked("evil.com"))
+	})
+}
+
+func Test_rejectTarget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("evil.com\n"), 0644))
+	blocklist, err := NewBlocklist(path)
+	require.NoError(t, err)
+
+	storage := store.NewInMemory()
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+	id, err := storage.Save(context.Background(), u)
+	require.NoError(t, err)
+
+	instance := NewInstance("http://localhost:8080", storage, WithBlocklist(blocklist))
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "blocked",
+			handler:    instance.ShortenHandler,
+			body:       "https://login.evil.com/",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   `blocked_domain: domain "login.evil.com" is blocked`,
+		},
+		{
+			name:       "self",
+			handler:    instance.ShortenHandler,
+			body:       "HTTP://LOCALHOST:8080/0",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   "self_redirect: URL points to this service",
+		},
+		{
+			name:       "other_port",
+			handler:    instance.ShortenHandler,
+			body:       "http://localhost:9090/",
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "other_scheme_short_url",
+			handler:    instance.ShortenHandler,
+			body:       "https://localhost:8080/" + id + "+",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   `self_redirect: URL points to short URL "` + id + `" of this service`,
+		},
+		{
+			name:       "rule_target",
+			handler:    instance.ShortenAPIHandler,
+			body:       `{"url":"https://praktikum.yandex.ru/","rules":[{"target":"http://localhost:8080/` + id + `"}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   "self_redirect: URL points to this service",
+		},
+		{
+			name:       "variant_target",
+			handler:    instance.ShortenAPIHandler,
+			body:       `{"url":"https://praktikum.yandex.ru/","variants":[{"target":"https://evil.com/","weight":1}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   `blocked_domain: domain "evil.com" is blocked`,
+		},
+		{
+			name:       "api",
+			handler:    instance.ShortenAPIHandler,
+			body:       `{"url":"https://evil.com/"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   `blocked_domain: domain "evil.com" is blocked`,
+		},
+		{
+			name:    "batch",
+			handler: instance.BatchShortenAPIHandler,
+			body: `[{"correlation_id":"1","original_url":"https://praktikum.yandex.ru/"},
+				{"correlation_id":"2","original_url":"http://localhost:8080/1"}]`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   "self_redirect: URL points to this service",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "http://localhost:8080/", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			tt.handler(w, r)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, strings.TrimSpace(w.Body.String()))
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// allowedSchemes lists URL schemes that may be shortened with their default ports
+var allowedSchemes = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// canonicalURL validates URL given by user and returns its canonical form,
+// so equal destinations are stored and deduplicated the same way
+func canonicalURL(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, errors.New("empty URL")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, errors.New("cannot parse given string as URL")
+	}
+
+	if u.Scheme == "" {
+		return nil, errors.New("absolute URL with scheme required")
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	defaultPort, ok := allowedSchemes[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("scheme %q is not allowed", u.Scheme)
+	}
+	if u.Opaque != "" {
+		return nil, errors.New("host required")
+	}
+
+	host, err := canonicalHost(u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	port := u.Port()
+	if port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n <= 0 || n > 65535 {
+			return nil, fmt.Errorf("bad port %q given", port)
+		}
+		port = strconv.Itoa(n)
+	}
+	if port == defaultPort {
+		port = ""
+	}
+
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	u.RawQuery = sortQuery(u.RawQuery)
+	u.ForceQuery = false
+
+	return u, nil
+}
+
+// canonicalHost lowercases host converting international domain names to punycode
+func canonicalHost(host string) (string, error) {
+	if host == "" {
+		return "", errors.New("host required")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return strings.ToLower(host), nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(strings.TrimSuffix(host, "."))
+	if err != nil || ascii == "" {
+		return "", fmt.Errorf("bad host %q given", host)
+	}
+	return strings.ToLower(ascii), nil
+}
+
+// sortQuery orders query parameters by name keeping their values as given.
+// Parameters of the same name keep relative order.
+func sortQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param != "" {
+			params = append(params, param)
+		}
+	}
+	sort.SliceStable(params, func(i, j int) bool {
+		return queryParamName(params[i]) < queryParamName(params[j])
+	})
+	return strings.Join(params, "&")
+}
+
+func queryParamName(param string) string {
+	if n := strings.IndexByte(param, '='); n >= 0 {
+		return param[:n]
+	}
+	return param
+}
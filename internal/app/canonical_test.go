@@ -0,0 +1,81 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+)
+
+func Test_canonicalURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    string
+		wantErr string
+	}{
+		{name: "unchanged", raw: "https://praktikum.yandex.ru/", want: "https://praktikum.yandex.ru/"},
+		{name: "case_and_port", raw: "HTTP://Example.COM:80/Path", want: "http://example.com/Path"},
+		{name: "https_port", raw: "https://example.com:443", want: "https://example.com"},
+		{name: "custom_port", raw: "https://example.com:8443/", want: "https://example.com:8443/"},
+		{name: "idn", raw: "https://Пример.рф/путь", want: "https://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C"},
+		{name: "ipv6", raw: "http://[::1]:80/", want: "http://[::1]/"},
+		{name: "query", raw: "https://example.com/?b=2&a=1&b=1&&c", want: "https://example.com/?a=1&b=2&b=1&c"},
+		{name: "fragment", raw: " https://example.com/#top ", want: "https://example.com/#top"},
+		{name: "empty", raw: "", wantErr: "empty URL"},
+		{name: "relative", raw: "/some/path", wantErr: "absolute URL with scheme required"},
+		{name: "bare_word", raw: "example", wantErr: "absolute URL with scheme required"},
+		{name: "javascript", raw: "javascript:alert(1)", wantErr: `scheme "javascript" is not allowed`},
+		{name: "no_host", raw: "http:///path", wantErr: "host required"},
+		{name: "opaque", raw: "http:example.com", wantErr: "host required"},
+		{name: "bad_port", raw: "http://example.com:99999/", wantErr: `bad port "99999" given`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := canonicalURL(tt.raw)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, u.String())
+		})
+	}
+}
+
+func Test_shortenCanonical(t *testing.T) {
+	storage := store.NewInMemory()
+	instance := &Instance{
+		baseURL: "http://localhost:8080",
+		store:   storage,
+	}
+	uid := uuid.Must(uuid.NewV4())
+
+	shorten := func(raw string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "http://localhost:8080/", bytes.NewBufferString(raw))
+		r = r.WithContext(auth.Context(r.Context(), uid))
+		w := httptest.NewRecorder()
+		instance.ShortenHandler(w, r)
+		return w
+	}
+
+	// storage deduplicates by saved form, so canonical one is saved
+	w := shorten("HTTP://Example.com:80/?b=2&a=1")
+	require.Equal(t, http.StatusCreated, w.Code)
+	u, err := storage.Load(context.Background(), strings.TrimPrefix(w.Body.String(), "http://localhost:8080/"))
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/?a=1&b=2", u.String())
+
+	w = shorten("javascript:alert(1)")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `Bad URL given: scheme "javascript" is not allowed`, w.Body.String())
+}
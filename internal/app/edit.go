@@ -0,0 +1,181 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+// UpdateURLHandler changes destination of user URL keeping its ID
+func (i *Instance) UpdateURLHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad ID given"))
+		return
+	}
+
+	var req models.UpdateURLRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad request body given"))
+		return
+	}
+
+	u, err := canonicalURL(req.URL)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(fmt.Sprintf("Bad URL given: %s", err)))
+		return
+	}
+
+	i.updateURL(w, r, store.AuditEdit, id, u)
+}
+
+// RollbackURLHandler returns user URL to one of its previous destinations
+func (i *Instance) RollbackURLHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad ID given"))
+		return
+	}
+
+	var req models.RollbackURLRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad request body given"))
+		return
+	}
+
+	versions, err := i.store.History(ctx, *uid, id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	for _, v := range versions {
+		if v.Number == req.Version {
+			i.updateURL(w, r, store.AuditRestore, id, v.URL)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+	_, _ = w.Write([]byte("Version not found"))
+}
+
+// URLHistoryHandler returns all destinations of user URL
+func (i *Instance) URLHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad ID given"))
+		return
+	}
+
+	versions, err := i.store.History(ctx, *uid, id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	resp := make([]models.URLVersionResponse, 0, len(versions))
+	for _, v := range versions {
+		version := models.URLVersionResponse{
+			Version:     v.Number,
+			OriginalURL: v.URL.String(),
+		}
+		if !v.CreatedAt.IsZero() {
+			createdAt := v.CreatedAt
+			version.CreatedAt = &createdAt
+		}
+		resp = append(resp, version)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+func (i *Instance) updateURL(w http.ResponseWriter, r *http.Request, action, id string, u *url.URL) {
+	ctx := r.Context()
+	uid := auth.UIDFromContext(ctx)
+
+	// previous destinations are checked as well as blocklist or service may have changed since
+	if writeRejectError(w, i.checkTarget(ctx, u)) {
+		return
+	}
+
+	before, err := i.store.LoadUser(ctx, *uid, id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	version, err := i.store.UpdateUser(ctx, *uid, id, u)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	i.recordAudit(ctx, action, auditChange{id: id, before: before.String(), after: u.String()})
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(models.UpdateURLResponse{
+		ShortURL:    i.baseURL + "/" + id,
+		OriginalURL: u.String(),
+		Version:     version,
+	})
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// writeStoreError responds with status matching storage error
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, store.ErrDeleted), errors.Is(err, store.ErrExhausted):
+		w.WriteHeader(http.StatusGone)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+	}
+}
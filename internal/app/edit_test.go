@@ -0,0 +1,112 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+func Test_updateURL(t *testing.T) {
+	uid := uuid.Must(uuid.NewV4())
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+
+	storage := store.NewInMemory()
+	id, _ := storage.SaveUser(context.Background(), uid, u)
+
+	instance := &Instance{
+		baseURL: "http://localhost:8080",
+		store:   storage,
+	}
+
+	newRequest := func(method, target, id, body string, uid uuid.UUID) *http.Request {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+		return r.WithContext(auth.Context(ctx, uid))
+	}
+
+	t.Run("not_owner", func(t *testing.T) {
+		r := newRequest("PATCH", "http://localhost:8080/api/user/urls/"+id, id, `{"url":"https://ya.ru/"}`, uuid.Must(uuid.NewV4()))
+		w := httptest.NewRecorder()
+		instance.UpdateURLHandler(w, r)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		r := newRequest("PATCH", "http://localhost:8080/api/user/urls/"+id, id, `{"url":"https://ya.ru/"}`, uid)
+		w := httptest.NewRecorder()
+		instance.UpdateURLHandler(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "{\"short_url\":\"http://localhost:8080/"+id+"\",\"original_url\":\"https://ya.ru/\",\"version\":2}\n", w.Body.String())
+
+		target, err := storage.Load(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, "https://ya.ru/", target.String())
+	})
+
+	t.Run("history", func(t *testing.T) {
+		r := newRequest("GET", "http://localhost:8080/api/user/urls/"+id+"/history", id, "", uid)
+		w := httptest.NewRecorder()
+		instance.URLHistoryHandler(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var versions []models.URLVersionResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &versions))
+		require.Len(t, versions, 2)
+		assert.Equal(t, "https://praktikum.yandex.ru/", versions[0].OriginalURL)
+		assert.Nil(t, versions[0].CreatedAt)
+		assert.Equal(t, "https://ya.ru/", versions[1].OriginalURL)
+		assert.NotNil(t, versions[1].CreatedAt)
+	})
+
+	t.Run("rollback_unknown_version", func(t *testing.T) {
+		r := newRequest("POST", "http://localhost:8080/api/user/urls/"+id+"/rollback", id, `{"version":5}`, uid)
+		w := httptest.NewRecorder()
+		instance.RollbackURLHandler(w, r)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		r := newRequest("POST", "http://localhost:8080/api/user/urls/"+id+"/rollback", id, `{"version":1}`, uid)
+		w := httptest.NewRecorder()
+		instance.RollbackURLHandler(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "{\"short_url\":\"http://localhost:8080/"+id+"\",\"original_url\":\"https://praktikum.yandex.ru/\",\"version\":3}\n", w.Body.String())
+	})
+
+	t.Run("rollback_blocked", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "blocklist.txt")
+		require.NoError(t, os.WriteFile(path, []byte("ya.ru\n"), 0644))
+		blocklist, err := NewBlocklist(path)
+		require.NoError(t, err)
+		instance.blocklist = blocklist
+
+		r := newRequest("POST", "http://localhost:8080/api/user/urls/"+id+"/rollback", id, `{"version":2}`, uid)
+		w := httptest.NewRecorder()
+		instance.RollbackURLHandler(w, r)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, `blocked_domain: domain "ya.ru" is blocked`, w.Body.String())
+	})
+}
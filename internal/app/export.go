@@ -0,0 +1,430 @@
+package app
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+// supported export and import formats
+const (
+	formatCSV    = "csv"
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatHTML   = "html"
+)
+
+const (
+	// importChunkSize is a max number of URLs saved to storage at once
+	importChunkSize = 100
+	// importBodyLimit is a max size of uploaded import file
+	importBodyLimit = 10 << 20
+)
+
+var csvHeader = []string{"id", "short_url", "original_url", "created_at", "deleted", "options"}
+
+// importRow describes single URL of import file
+type importRow struct {
+	rawURL  string
+	deleted bool
+}
+
+// ExportHandler streams all user URLs with their metadata in requested format
+func (i *Instance) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatJSON
+	}
+
+	enc, contentType, err := newExportEncoder(format, w)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	records, err := i.store.LoadUserRecords(ctx, *uid)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"urls.%s\"", format))
+
+	for _, rec := range records {
+		if err := enc.Encode(i.exportURL(rec)); err != nil {
+			fmt.Printf("cannot write response: %s", err)
+			return
+		}
+	}
+
+	if err := enc.Close(); err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// ImportHandler saves URLs from uploaded file and reports result of every row
+func (i *Instance) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatFromContentType(r.Header.Get("Content-Type"))
+	}
+
+	rows, err := parseImport(format, http.MaxBytesReader(w, r.Body, importBodyLimit))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	if len(rows) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Empty URLs list given"))
+		return
+	}
+
+	res := make([]models.ImportResult, len(rows))
+
+	var pending []int
+	var urls []*url.URL
+	flush := func() {
+		if len(urls) == 0 {
+			return
+		}
+		shortURLs, err := i.shortenBatch(ctx, urls)
+		for j, row := range pending {
+			if err != nil {
+				res[row].Error = err.Error()
+				continue
+			}
+			res[row].ShortURL = shortURLs[j]
+		}
+		pending, urls = nil, nil
+	}
+
+	for row, item := range rows {
+		res[row] = models.ImportResult{
+			Row:         row + 1,
+			OriginalURL: item.rawURL,
+		}
+		if item.deleted {
+			res[row].Error = "deleted URL skipped"
+			continue
+		}
+
+		u, err := canonicalURL(item.rawURL)
+		if err != nil {
+			res[row].Error = err.Error()
+			continue
+		}
+		// reject single row not to fail whole chunk
+		if err := i.checkTarget(ctx, u); err != nil {
+			res[row].Error = err.Error()
+			continue
+		}
+
+		pending = append(pending, row)
+		urls = append(urls, u)
+		if len(urls) == importChunkSize {
+			flush()
+		}
+	}
+	flush()
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// exportURL describes user URL with its metadata
+func (i *Instance) exportURL(rec store.Record) models.ExportURL {
+	u := models.ExportURL{
+		ID:       rec.ID,
+		ShortURL: i.baseURL + "/" + rec.ID,
+		Deleted:  rec.Deleted,
+	}
+	// deleted URLs may be stored without destination
+	if rec.URL != nil {
+		u.OriginalURL = rec.URL.String()
+	}
+	if !rec.CreatedAt.IsZero() {
+		createdAt := rec.CreatedAt.UTC()
+		u.CreatedAt = &createdAt
+	}
+	if !rec.Options.IsZero() {
+		u.Options = exportOptions(rec.Options)
+	}
+	return u
+}
+
+func exportOptions(opts store.Options) *models.ExportOptions {
+	res := &models.ExportOptions{
+		PasswordProtected: opts.PasswordHash != "",
+		MaxClicks:         opts.MaxClicks,
+		ActiveFrom:        opts.ActiveFrom,
+		StickyVariants:    opts.StickyVariants,
+		Passthrough:       opts.Passthrough,
+		Template:          opts.Template,
+		RedirectStatus:    opts.RedirectStatus,
+		Interstitial:      opts.Interstitial,
+	}
+	if len(opts.Rules) > 0 {
+		res.Rules = rulesResponse(opts.Rules)
+	}
+	for _, variant := range opts.Variants {
+		res.Variants = append(res.Variants, models.RedirectVariant{
+			Target: variant.Target,
+			Weight: variant.Weight,
+		})
+	}
+	return res
+}
+
+type exportEncoder interface {
+	Encode(u models.ExportURL) error
+	Close() error
+}
+
+func newExportEncoder(format string, w io.Writer) (enc exportEncoder, contentType string, err error) {
+	switch format {
+	case formatCSV:
+		return &csvExportEncoder{w: csv.NewWriter(w)}, "text/csv", nil
+	case formatJSON:
+		return &jsonExportEncoder{w: w}, "application/json", nil
+	case formatNDJSON:
+		return &ndjsonExportEncoder{enc: json.NewEncoder(w)}, "application/x-ndjson", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported export format: %q", format)
+	}
+}
+
+type csvExportEncoder struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func (e *csvExportEncoder) Encode(u models.ExportURL) error {
+	if !e.wroteHeader {
+		if err := e.w.Write(csvHeader); err != nil {
+			return err
+		}
+		e.wroteHeader = true
+	}
+	var createdAt, options string
+	if u.CreatedAt != nil {
+		createdAt = u.CreatedAt.Format(time.RFC3339)
+	}
+	if u.Options != nil {
+		b, err := json.Marshal(u.Options)
+		if err != nil {
+			return err
+		}
+		options = string(b)
+	}
+	return e.w.Write([]string{u.ID, u.ShortURL, u.OriginalURL, createdAt, strconv.FormatBool(u.Deleted), options})
+}
+
+func (e *csvExportEncoder) Close() error {
+	if !e.wroteHeader {
+		if err := e.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type jsonExportEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonExportEncoder) Encode(u models.ExportURL) error {
+	b, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	delim := ","
+	if e.count == 0 {
+		delim = "["
+	}
+	e.count++
+	_, err = io.WriteString(e.w, delim+string(b))
+	return err
+}
+
+func (e *jsonExportEncoder) Close() error {
+	if e.count == 0 {
+		_, err := io.WriteString(e.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(e.w, "]\n")
+	return err
+}
+
+type ndjsonExportEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonExportEncoder) Encode(u models.ExportURL) error {
+	return e.enc.Encode(u)
+}
+
+func (e *ndjsonExportEncoder) Close() error {
+	return nil
+}
+
+func formatFromContentType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return formatCSV
+	case "application/x-ndjson":
+		return formatNDJSON
+	case "text/html":
+		return formatHTML
+	default:
+		return formatJSON
+	}
+}
+
+// parseImport extracts URLs from import file preserving their order
+func parseImport(format string, r io.Reader) ([]importRow, error) {
+	switch format {
+	case formatCSV:
+		return parseCSVImport(r)
+	case formatJSON:
+		var urls []models.ExportURL
+		if err := json.NewDecoder(r).Decode(&urls); err != nil {
+			return nil, errors.New("bad request body given")
+		}
+		rows := make([]importRow, 0, len(urls))
+		for _, u := range urls {
+			rows = append(rows, importRow{rawURL: strings.TrimSpace(u.OriginalURL), deleted: u.Deleted})
+		}
+		return rows, nil
+	case formatNDJSON:
+		var rows []importRow
+		dec := json.NewDecoder(r)
+		for {
+			var u models.ExportURL
+			err := dec.Decode(&u)
+			if errors.Is(err, io.EOF) {
+				return rows, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("bad request body given at row %d", len(rows)+1)
+			}
+			rows = append(rows, importRow{rawURL: strings.TrimSpace(u.OriginalURL), deleted: u.Deleted})
+		}
+	case formatHTML:
+		return parseBookmarksImport(r)
+	default:
+		return nil, fmt.Errorf("unsupported import format: %q", format)
+	}
+}
+
+// parseCSVImport reads URLs from `original_url` column and their state from `deleted` one
+// or URLs from the first column if file has no header
+func parseCSVImport(r io.Reader) ([]importRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("bad CSV given: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	column, deletedColumn := 0, -1
+	if j := csvColumn(records[0], "original_url"); j >= 0 {
+		column = j
+		deletedColumn = csvColumn(records[0], "deleted")
+		records = records[1:]
+	}
+
+	rows := make([]importRow, 0, len(records))
+	for _, record := range records {
+		var row importRow
+		if column < len(record) {
+			row.rawURL = strings.TrimSpace(record[column])
+		}
+		if deletedColumn >= 0 && deletedColumn < len(record) {
+			row.deleted, _ = strconv.ParseBool(strings.TrimSpace(record[deletedColumn]))
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// csvColumn returns index of named column of CSV header, -1 if there is no such column
+func csvColumn(header []string, name string) int {
+	for j, column := range header {
+		if strings.TrimSpace(column) == name {
+			return j
+		}
+	}
+	return -1
+}
+
+// parseBookmarksImport reads URLs from links of browser bookmarks HTML file
+func parseBookmarksImport(r io.Reader) ([]importRow, error) {
+	var rows []importRow
+
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if errors.Is(z.Err(), io.EOF) {
+				return rows, nil
+			}
+			return nil, fmt.Errorf("bad HTML given: %w", z.Err())
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			if t.DataAtom != atom.A {
+				continue
+			}
+			for _, attr := range t.Attr {
+				if strings.EqualFold(attr.Key, "href") {
+					rows = append(rows, importRow{rawURL: strings.TrimSpace(attr.Val)})
+				}
+			}
+		}
+	}
+}
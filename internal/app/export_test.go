@@ -0,0 +1,170 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+func Test_exportHandler(t *testing.T) {
+	uid := uuid.Must(uuid.NewV4())
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+
+	createdAt := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	storage := store.NewInMemory()
+	require.NoError(t, storage.Restore(context.Background(),
+		store.Record{ID: "0", URL: u, UserID: &uid, CreatedAt: createdAt},
+		store.Record{ID: "1", URL: u, UserID: &uid, Options: store.Options{PasswordHash: "hash", MaxClicks: 3}},
+		store.Record{ID: "2", URL: u, UserID: &uid, Deleted: true, CreatedAt: createdAt},
+	))
+
+	instance := &Instance{
+		baseURL: "http://localhost:8080",
+		store:   storage,
+	}
+
+	testCases := []struct {
+		name           string
+		format         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "bad_format",
+			format:         "xml",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "unsupported export format: \"xml\"",
+		},
+		{
+			name:           "csv",
+			format:         "csv",
+			expectedStatus: http.StatusOK,
+			expectedBody: "id,short_url,original_url,created_at,deleted,options\n" +
+				"0,http://localhost:8080/0,https://praktikum.yandex.ru/,2022-01-02T03:04:05Z,false,\n" +
+				"1,http://localhost:8080/1,https://praktikum.yandex.ru/,,false,\"{\"\"password_protected\"\":true,\"\"max_clicks\"\":3}\"\n" +
+				"2,http://localhost:8080/2,,2022-01-02T03:04:05Z,true,\n",
+		},
+		{
+			name:           "json",
+			format:         "json",
+			expectedStatus: http.StatusOK,
+			expectedBody: "[{\"id\":\"0\",\"short_url\":\"http://localhost:8080/0\",\"original_url\":\"https://praktikum.yandex.ru/\",\"created_at\":\"2022-01-02T03:04:05Z\"}," +
+				"{\"id\":\"1\",\"short_url\":\"http://localhost:8080/1\",\"original_url\":\"https://praktikum.yandex.ru/\",\"options\":{\"password_protected\":true,\"max_clicks\":3}}," +
+				"{\"id\":\"2\",\"short_url\":\"http://localhost:8080/2\",\"original_url\":\"\",\"created_at\":\"2022-01-02T03:04:05Z\",\"deleted\":true}]\n",
+		},
+		{
+			name:           "ndjson",
+			format:         "ndjson",
+			expectedStatus: http.StatusOK,
+			expectedBody: "{\"id\":\"0\",\"short_url\":\"http://localhost:8080/0\",\"original_url\":\"https://praktikum.yandex.ru/\",\"created_at\":\"2022-01-02T03:04:05Z\"}\n" +
+				"{\"id\":\"1\",\"short_url\":\"http://localhost:8080/1\",\"original_url\":\"https://praktikum.yandex.ru/\",\"options\":{\"password_protected\":true,\"max_clicks\":3}}\n" +
+				"{\"id\":\"2\",\"short_url\":\"http://localhost:8080/2\",\"original_url\":\"\",\"created_at\":\"2022-01-02T03:04:05Z\",\"deleted\":true}\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://localhost:8080/api/user/urls/export?format="+tc.format, nil)
+			r = r.WithContext(auth.Context(r.Context(), uid))
+
+			w := httptest.NewRecorder()
+			instance.ExportHandler(w, r)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func Test_importHandler(t *testing.T) {
+	testCases := []struct {
+		name            string
+		format          string
+		body            string
+		expectedStatus  int
+		expectedResults []models.ImportResult
+	}{
+		{
+			name:           "bad_format",
+			format:         "xml",
+			body:           "<urls/>",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "csv",
+			format:         "csv",
+			body:           "id,short_url,original_url,deleted\n1,http://localhost:8080/1,https://praktikum.yandex.ru/,false\n2,,\n3,,https://ya.ru/,true\n",
+			expectedStatus: http.StatusOK,
+			expectedResults: []models.ImportResult{
+				{Row: 1, OriginalURL: "https://praktikum.yandex.ru/", ShortURL: "http://localhost:8080/0"},
+				{Row: 2, OriginalURL: "", Error: "empty URL"},
+				{Row: 3, OriginalURL: "https://ya.ru/", Error: "deleted URL skipped"},
+			},
+		},
+		{
+			name:           "ndjson",
+			format:         "ndjson",
+			body:           "{\"original_url\":\"https://praktikum.yandex.ru/\"}\n{\"original_url\":\"htt_p://o.com\"}\n{\"original_url\":\"\",\"deleted\":true}\n",
+			expectedStatus: http.StatusOK,
+			expectedResults: []models.ImportResult{
+				{Row: 1, OriginalURL: "https://praktikum.yandex.ru/", ShortURL: "http://localhost:8080/0"},
+				{Row: 2, OriginalURL: "htt_p://o.com", Error: "cannot parse given string as URL"},
+				{Row: 3, OriginalURL: "", Error: "deleted URL skipped"},
+			},
+		},
+		{
+			name:           "too_large",
+			format:         "ndjson",
+			body:           strings.Repeat("{\"original_url\":\"https://praktikum.yandex.ru/\"}\n", importBodyLimit/40),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "html",
+			format:         "html",
+			body:           "<DL><p><DT><A HREF=\"https://praktikum.yandex.ru/\" ADD_DATE=\"1\">Praktikum</A><DT><A HREF=\"https://ya.ru/\">Ya</A></DL>",
+			expectedStatus: http.StatusOK,
+			expectedResults: []models.ImportResult{
+				{Row: 1, OriginalURL: "https://praktikum.yandex.ru/", ShortURL: "http://localhost:8080/0"},
+				{Row: 2, OriginalURL: "https://ya.ru/", ShortURL: "http://localhost:8080/1"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			instance := &Instance{
+				baseURL: "http://localhost:8080",
+				store:   store.NewInMemory(),
+			}
+
+			r := httptest.NewRequest("POST", "http://localhost:8080/api/user/urls/import?format="+tc.format, strings.NewReader(tc.body))
+			r = r.WithContext(auth.Context(r.Context(), uuid.Must(uuid.NewV4())))
+
+			w := httptest.NewRecorder()
+			instance.ImportHandler(w, r)
+
+			require.Equal(t, tc.expectedStatus, w.Code)
+			if tc.expectedResults == nil {
+				return
+			}
+
+			var results []models.ImportResult
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &results))
+			assert.Equal(t, tc.expectedResults, results)
+		})
+	}
+}
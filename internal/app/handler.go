@@ -8,6 +8,8 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
@@ -24,14 +26,17 @@ func (i *Instance) ShortenHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	u, err := url.Parse(string(b))
+	u, err := canonicalURL(string(b))
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		_, _ = w.Write([]byte("Cannot parse given string as URL"))
+		_, _ = w.Write([]byte(fmt.Sprintf("Bad URL given: %s", err)))
 		return
 	}
 
 	shortURL, err := i.shorten(r.Context(), u)
+	if writeRejectError(w, err) || writeQuotaError(w, err) {
+		return
+	}
 	if err != nil && !errors.Is(err, store.ErrConflict) {
 		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = w.Write([]byte(err.Error()))
@@ -56,31 +61,99 @@ func (i *Instance) ShortenAPIHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	u, err := url.Parse(req.URL)
+	u, err := canonicalURL(req.URL)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		_, _ = w.Write([]byte("Cannot parse given string as URL"))
+		_, _ = w.Write([]byte(fmt.Sprintf("Bad URL given: %s", err)))
 		return
 	}
 
-	shortURL, err := i.shorten(r.Context(), u)
+	if req.RedirectStatus != 0 && !validRedirectStatus(req.RedirectStatus) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad redirect status given"))
+		return
+	}
+
+	if req.MaxClicks < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Negative max clicks given"))
+		return
+	}
+
+	rules, err := i.parseRules(r.Context(), req.Rules)
+	if writeRejectError(w, err) {
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(fmt.Sprintf("Bad rules given: %s", err)))
+		return
+	}
+
+	variants, err := i.parseVariants(r.Context(), req.Variants)
+	if writeRejectError(w, err) {
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(fmt.Sprintf("Bad variants given: %s", err)))
+		return
+	}
+
+	opts := store.Options{
+		MaxClicks:      req.MaxClicks,
+		ActiveFrom:     req.ActiveFrom,
+		StickyVariants: req.StickyVariants && len(variants) > 0,
+		Passthrough:    req.Passthrough,
+		Template:       req.Template,
+		RedirectStatus: req.RedirectStatus,
+		Interstitial:   req.Interstitial,
+	}
+	if len(rules) > 0 {
+		opts.Rules = rules
+	}
+	if len(variants) > 0 {
+		opts.Variants = variants
+	}
+	if req.Password != "" {
+		opts.PasswordHash, err = hashPassword(req.Password)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+	}
+
+	shortURL, err := i.shortenOptions(r.Context(), u, opts)
+	if writeRejectError(w, err) || writeQuotaError(w, err) {
+		return
+	}
 	if err != nil && !errors.Is(err, store.ErrConflict) {
 		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = w.Write([]byte(err.Error()))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-
 	status := http.StatusCreated
 	if errors.Is(err, store.ErrConflict) {
 		status = http.StatusConflict
 	}
 
-	w.WriteHeader(status)
-	err = json.NewEncoder(w).Encode(models.ShortenResponse{
+	resp := models.ShortenResponse{
 		Result: shortURL,
-	})
+	}
+	if req.QR {
+		resp.QR, err = i.qrDataURI(shortURL)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(resp)
 
 	if err != nil {
 		fmt.Printf("cannot write response: %s", err)
@@ -95,7 +168,14 @@ func (i *Instance) ExpandHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	target, err := i.store.Load(r.Context(), id)
+	// trailing plus asks for preview like ?preview=1 does
+	preview := r.URL.Query().Get("preview") == "1"
+	if strings.HasSuffix(id, previewSuffix) {
+		id = strings.TrimSuffix(id, previewSuffix)
+		preview = true
+	}
+
+	rec, err := i.store.LoadRecord(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
 			w.WriteHeader(http.StatusNotFound)
@@ -109,8 +189,66 @@ func (i *Instance) ExpandHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if rec.Disabled != nil {
+		writeTakedown(w, rec.Disabled)
+		return
+	}
+
+	// path suffix is only allowed for passthrough URLs
+	if chi.URLParam(r, "*") != "" && !rec.Options.Passthrough {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if rec.Options.Pending(time.Now()) {
+		i.writeComingSoon(w, rec)
+		return
+	}
+	if rec.Options.PasswordHash != "" && !unlocked(r, rec) {
+		writePasswordForm(w, http.StatusOK, id, false)
+		return
+	}
+	if preview || rec.Options.Interstitial {
+		i.writePreview(w, r, rec)
+		return
+	}
+
+	i.follow(w, r, rec, i.redirectStatus(r.Context(), rec))
+}
+
+// follow counts click of limited URL and redirects to its destination matching request.
+// HEAD requests are never counted.
+func (i *Instance) follow(w http.ResponseWriter, r *http.Request, rec store.Record, status int) {
+	counted := r.Method != http.MethodHead
+	if rec.Options.MaxClicks > 0 {
+		err := store.ErrExhausted
+		if counted {
+			err = i.store.Click(r.Context(), rec.ID)
+		} else if rec.Clicks < rec.Options.MaxClicks {
+			err = nil
+		}
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+	}
+
+	target, matched := resolveTarget(r, rec, time.Now())
+	if !matched && len(rec.Options.Variants) > 0 {
+		var variant int
+		target, variant = pickVariant(w, r, rec)
+		if counted {
+			if err := i.store.CountVariant(r.Context(), rec.ID, variant); err != nil {
+				fmt.Printf("cannot count variant click: %s", err)
+			}
+		}
+	}
+
+	target = expandTarget(target, r, rec.Options)
+
+	writeCacheHeaders(w, status, rec.Options)
 	w.Header().Set("Location", target.String())
-	w.WriteHeader(http.StatusTemporaryRedirect)
+	w.WriteHeader(status)
 }
 
 func (i *Instance) UserURLsHandler(w http.ResponseWriter, r *http.Request) {
@@ -132,11 +270,20 @@ func (i *Instance) UserURLsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	opts, err := i.store.LoadUserOptions(ctx, *uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
 	var resp []models.URLResponse
 	for id, u := range urls {
 		resp = append(resp, models.URLResponse{
 			ShortURL:    i.baseURL + "/" + id,
 			OriginalURL: u.String(),
+			ActiveFrom:  opts[id].ActiveFrom,
+			Pending:     opts[id].Pending(now),
 		})
 	}
 
@@ -161,10 +308,10 @@ func (i *Instance) BatchShortenAPIHandler(w http.ResponseWriter, r *http.Request
 
 	var urls []*url.URL
 	for _, pair := range req {
-		u, err := url.Parse(pair.OriginalURL)
+		u, err := canonicalURL(pair.OriginalURL)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
-			msg := fmt.Sprintf("Cannot parse given string as URL: %s", pair.OriginalURL)
+			msg := fmt.Sprintf("Bad URL given: %s: %s", pair.OriginalURL, err)
 			_, _ = w.Write([]byte(msg))
 			return
 		}
@@ -172,6 +319,9 @@ func (i *Instance) BatchShortenAPIHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	shortURLs, err := i.shortenBatch(r.Context(), urls)
+	if writeRejectError(w, err) || writeQuotaError(w, err) {
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = w.Write([]byte(err.Error()))
@@ -223,12 +373,28 @@ func (i *Instance) BatchRemoveAPIHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	var changes []auditChange
+	if i.audit != nil {
+		urls, err := i.store.LoadUsers(ctx, *uid)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+		for _, id := range ids {
+			if u, ok := urls[id]; ok {
+				changes = append(changes, auditChange{id: id, before: u.String()})
+			}
+		}
+	}
+
 	err = i.store.DeleteUsers(ctx, *uid, ids...)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = w.Write([]byte(err.Error()))
 		return
 	}
+	i.recordAudit(ctx, store.AuditDelete, changes...)
 
 	w.WriteHeader(http.StatusAccepted)
 }
@@ -244,24 +410,56 @@ func (i *Instance) PingHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (i *Instance) shorten(ctx context.Context, rawURL *url.URL) (shortURL string, err error) {
+	return i.shortenOptions(ctx, rawURL, store.Options{})
+}
+
+// shortenOptions saves URL with options, which are never deduplicated
+func (i *Instance) shortenOptions(ctx context.Context, rawURL *url.URL, opts store.Options) (shortURL string, err error) {
 	uid := auth.UIDFromContext(ctx)
+	if uid == nil && !opts.IsZero() {
+		return "", errors.New("cannot save URL options of anonymous user")
+	}
+	if err := i.checkTarget(ctx, rawURL); err != nil {
+		return "", err
+	}
+	ctx, err = i.quotaContext(ctx, 1)
+	if err != nil {
+		return "", err
+	}
 
 	var id string
-	if uid != nil {
+	switch {
+	case !opts.IsZero():
+		id, err = i.store.SaveUserOptions(ctx, *uid, rawURL, opts)
+	case uid != nil:
 		id, err = i.store.SaveUser(ctx, *uid, rawURL)
-	} else {
+	default:
 		id, err = i.store.Save(ctx, rawURL)
 	}
 
 	if err != nil && !errors.Is(err, store.ErrConflict) {
 		return "", fmt.Errorf("cannot save URL to storage: %w", err)
 	}
+	if err == nil {
+		i.recordAudit(ctx, store.AuditShorten, auditChange{id: id, after: rawURL.String()})
+	}
 	return fmt.Sprintf("%s/%s", i.baseURL, id), err
 }
 
 func (i *Instance) shortenBatch(ctx context.Context, rawURLs []*url.URL) (shortURLs []string, err error) {
 	uid := auth.UIDFromContext(ctx)
 
+	for _, u := range rawURLs {
+		if err := i.checkTarget(ctx, u); err != nil {
+			return nil, fmt.Errorf("cannot save %s: %w", u, err)
+		}
+	}
+	// whole batch is refused if it does not fit
+	ctx, err = i.quotaContext(ctx, len(rawURLs))
+	if err != nil {
+		return nil, err
+	}
+
 	var ids []string
 	if uid != nil {
 		ids, err = i.store.SaveUserBatch(ctx, *uid, rawURLs)
@@ -273,9 +471,12 @@ func (i *Instance) shortenBatch(ctx context.Context, rawURLs []*url.URL) (shortU
 		return nil, fmt.Errorf("cannot save URL to storage: %w", err)
 	}
 
-	for _, id := range ids {
+	changes := make([]auditChange, 0, len(ids))
+	for j, id := range ids {
 		shortURLs = append(shortURLs, fmt.Sprintf("%s/%s", i.baseURL, id))
+		changes = append(changes, auditChange{id: id, after: rawURLs[j].String()})
 	}
+	i.recordAudit(ctx, store.AuditBatchShorten, changes...)
 
 	return shortURLs, nil
 }
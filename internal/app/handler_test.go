@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -41,7 +42,7 @@ func Test_ShortenAPIHandler(t *testing.T) {
 			name:             "bad_request",
 			url:              "htt_p://o.com",
 			expectedStatus:   http.StatusBadRequest,
-			expectedResponse: []byte("Cannot parse given string as URL"),
+			expectedResponse: []byte("Bad URL given: cannot parse given string as URL"),
 		},
 		{
 			name:             "success",
@@ -216,12 +217,12 @@ func BenchmarkShortener(b *testing.B) {
 	})
 }
 
-func ExampleShorten() {
+func ExampleInstance_shorten() {
 
 	storage := store.NewInMemory()
 	defer storage.Close()
 
-	instance := NewInstance(config.BaseURL, storage)
+	instance := NewInstance("http://localhost:8080", storage)
 
 	url, _ := url.Parse("https://practicum.yandex.ru/")
 
@@ -229,5 +230,31 @@ func ExampleShorten() {
 	fmt.Println(id)
 
 	// Output:
-	// "http://localhost:8080/0"
+	// http://localhost:8080/0
+}
+
+func Test_maxClicks(t *testing.T) {
+	uid := uuid.Must(uuid.NewV4())
+	instance := &Instance{
+		baseURL: "http://localhost:8080",
+		store:   store.NewInMemory(),
+	}
+
+	r := httptest.NewRequest("POST", "http://localhost:8080/api/shorten",
+		strings.NewReader(`{"url":"https://praktikum.yandex.ru/","max_clicks":1}`))
+	r = r.WithContext(auth.Context(r.Context(), uid))
+	w := httptest.NewRecorder()
+	instance.ShortenAPIHandler(w, r)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	for _, expectedStatus := range []int{http.StatusTemporaryRedirect, http.StatusGone} {
+		r := httptest.NewRequest("GET", "http://localhost:8080/0", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "0")
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		instance.ExpandHandler(w, r)
+
+		assert.Equal(t, expectedStatus, w.Code)
+	}
 }
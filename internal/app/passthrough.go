@@ -0,0 +1,58 @@
+package app
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+)
+
+// placeholderRe matches {name} in destination, braces may be escaped by URL encoding
+var placeholderRe = regexp.MustCompile(`\{(\w+)\}|%7[Bb](\w+)%7[Dd]`)
+
+// expandTarget applies request path suffix, query and template parameters to destination
+func expandTarget(target *url.URL, r *http.Request, opts store.Options) *url.URL {
+	if !opts.Template && !opts.Passthrough {
+		return target
+	}
+	query := r.URL.Query()
+
+	if opts.Template {
+		raw := placeholderRe.ReplaceAllStringFunc(target.String(), func(placeholder string) string {
+			m := placeholderRe.FindStringSubmatch(placeholder)
+			name := m[1]
+			if name == "" {
+				name = m[2]
+			}
+			return url.QueryEscape(query.Get(name))
+		})
+		filled, err := url.Parse(raw)
+		if err != nil {
+			return target
+		}
+		target = filled
+	}
+
+	if opts.Passthrough {
+		res := *target
+		if suffix := chi.URLParam(r, "*"); suffix != "" {
+			res.Path = strings.TrimRight(res.Path, "/") + "/" + suffix
+			res.RawPath = ""
+		}
+
+		// request parameters override destination ones
+		if len(query) > 0 {
+			merged := res.Query()
+			for name, values := range query {
+				merged[name] = values
+			}
+			res.RawQuery = merged.Encode()
+		}
+		target = &res
+	}
+	return target
+}
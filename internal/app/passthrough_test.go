@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+)
+
+func Test_passthrough(t *testing.T) {
+	uid := uuid.Must(uuid.NewV4())
+	ctx := context.Background()
+	storage := store.NewInMemory()
+
+	docs, _ := url.Parse("https://example.com/docs/?lang=en")
+	search, _ := url.Parse("https://example.com/search?q={q}&src=short")
+	plain, _ := url.Parse("https://praktikum.yandex.ru/")
+
+	passthroughID, _ := storage.SaveUserOptions(ctx, uid, docs, store.Options{Passthrough: true})
+	templateID, _ := storage.SaveUserOptions(ctx, uid, search, store.Options{Template: true})
+	plainID, _ := storage.SaveUser(ctx, uid, plain)
+
+	instance := &Instance{
+		baseURL: "http://localhost:8080",
+		store:   storage,
+	}
+
+	testCases := []struct {
+		name             string
+		id               string
+		suffix           string
+		query            string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{
+			name:             "passthrough_path_and_query",
+			id:               passthroughID,
+			suffix:           "guide/intro",
+			query:            "lang=ru&page=2",
+			expectedStatus:   http.StatusTemporaryRedirect,
+			expectedLocation: "https://example.com/docs/guide/intro?lang=ru&page=2",
+		},
+		{
+			name:             "passthrough_as_is",
+			id:               passthroughID,
+			expectedStatus:   http.StatusTemporaryRedirect,
+			expectedLocation: "https://example.com/docs/?lang=en",
+		},
+		{
+			name:             "template",
+			id:               templateID,
+			query:            "q=go+maps",
+			expectedStatus:   http.StatusTemporaryRedirect,
+			expectedLocation: "https://example.com/search?q=go+maps&src=short",
+		},
+		{
+			name:           "suffix_not_allowed",
+			id:             plainID,
+			suffix:         "ololo",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			target := "http://localhost:8080/" + tc.id
+			if tc.suffix != "" {
+				target += "/" + tc.suffix
+			}
+			if tc.query != "" {
+				target += "?" + tc.query
+			}
+
+			r := httptest.NewRequest("GET", target, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tc.id)
+			rctx.URLParams.Add("*", tc.suffix)
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			instance.ExpandHandler(w, r)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			assert.Equal(t, tc.expectedLocation, w.Header().Get("Location"))
+		})
+	}
+}
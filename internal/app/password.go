@@ -0,0 +1,254 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+)
+
+const (
+	// unlockTTL is a period during which unlocked URL is followed without password
+	unlockTTL = 15 * time.Minute
+	// unlockAttempts is a number of password attempts allowed per URL and client within unlockWindow
+	unlockAttempts = 5
+	// unlockURLAttempts is a number of password attempts allowed per URL from all clients within unlockWindow,
+	// so that switching addresses does not give unlimited guesses
+	unlockURLAttempts = 30
+	unlockWindow      = time.Minute
+	// attemptSweepPeriod is a period of evicting stale attempt windows
+	attemptSweepPeriod = time.Minute
+)
+
+var passwordForm = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Password required</title></head>
+<body>
+<form method="post" action="/{{.ID}}">
+<p>This link is protected by password.</p>
+{{if .Failed}}<p>Wrong password, try again.</p>{{end}}
+<input type="password" name="password" autofocus>
+<button type="submit">Open</button>
+</form>
+</body>
+</html>
+`))
+
+// unlockToken describes sealed cookie value remembering unlocked URL
+type unlockToken struct {
+	ID string `json:"id"`
+	// Gate is a fingerprint of password hash to forget unlock on password change
+	Gate      string    `json:"gate"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+// hashPassword returns salted hash of password to store with URL
+func hashPassword(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("cannot hash password: %w", err)
+	}
+	return string(b), nil
+}
+
+// UnlockHandler checks password of protected URL and redirects to it on success
+func (i *Instance) UnlockHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad ID given"))
+		return
+	}
+
+	rec, err := i.store.LoadRecord(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if rec.Disabled != nil {
+		writeTakedown(w, rec.Disabled)
+		return
+	}
+	if rec.Options.Pending(time.Now()) {
+		i.writeComingSoon(w, rec)
+		return
+	}
+	// preview continue button posts here for public and already unlocked URLs
+	if rec.Options.PasswordHash == "" || unlocked(r, rec) {
+		i.follow(w, r, rec, http.StatusSeeOther)
+		return
+	}
+
+	ok, retryAfter := i.unlockLimiter.allow(clientAttemptKey(r.Context(), id))
+	if ok {
+		ok, retryAfter = i.unlockURLLimiter.allow(id)
+	}
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds()+1)))
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte("Too many password attempts"))
+		return
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(rec.Options.PasswordHash), []byte(r.PostFormValue("password")))
+	if err != nil {
+		if !errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writePasswordForm(w, http.StatusUnauthorized, id, true)
+		return
+	}
+
+	b, err := json.Marshal(unlockToken{
+		ID:        id,
+		Gate:      passwordGate(rec.Options.PasswordHash),
+		ExpiresAt: time.Now().Add(unlockTTL).UTC(),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	sealed, err := auth.SealToHex(auth.PurposeUnlock, b)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("cannot seal unlock cookie"))
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     unlockCookieName(id),
+		Value:    sealed,
+		Path:     "/" + id,
+		MaxAge:   int(unlockTTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	i.follow(w, r, rec, http.StatusSeeOther)
+}
+
+// unlocked reports whether request carries valid unlock cookie for protected record
+func unlocked(r *http.Request, rec store.Record) bool {
+	cookie, err := r.Cookie(unlockCookieName(rec.ID))
+	if err != nil {
+		return false
+	}
+	b, err := auth.OpenFromHex(auth.PurposeUnlock, cookie.Value)
+	if err != nil {
+		return false
+	}
+	var token unlockToken
+	if err := json.Unmarshal(b, &token); err != nil {
+		return false
+	}
+	return token.ID == rec.ID &&
+		token.Gate == passwordGate(rec.Options.PasswordHash) &&
+		time.Now().Before(token.ExpiresAt)
+}
+
+func writePasswordForm(w http.ResponseWriter, status int, id string, failed bool) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	err := passwordForm.Execute(w, struct {
+		ID     string
+		Failed bool
+	}{id, failed})
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+func unlockCookieName(id string) string {
+	return "unlock_" + id
+}
+
+// passwordGate returns short fingerprint of password hash
+func passwordGate(hash string) string {
+	sum := sha256.Sum256([]byte(hash))
+	return hex.EncodeToString(sum[:8])
+}
+
+// attemptLimiter limits number of attempts per key within fixed time window.
+// Nil limiter allows everything.
+type attemptLimiter struct {
+	limit  int
+	window time.Duration
+
+	mutex     sync.Mutex
+	windows   map[string]*attemptWindow
+	lastSweep time.Time
+}
+
+type attemptWindow struct {
+	start    time.Time
+	attempts int
+}
+
+func newAttemptLimiter(limit int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		limit:     limit,
+		window:    window,
+		windows:   make(map[string]*attemptWindow),
+		lastSweep: time.Now(),
+	}
+}
+
+// clientAttemptKey scopes attempts on key to client IP
+// so that nobody can lock other clients out by failing attempts on purpose
+func clientAttemptKey(ctx context.Context, key string) string {
+	return key + " " + clientIPFromContext(ctx)
+}
+
+// allow registers attempt for key and returns time to wait if limit is exceeded
+func (l *attemptLimiter) allow(key string) (ok bool, retryAfter time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	win, ok := l.windows[key]
+	if !ok || now.Sub(win.start) >= l.window {
+		win = &attemptWindow{start: now}
+		l.windows[key] = win
+	}
+	if win.attempts >= l.limit {
+		return false, win.start.Add(l.window).Sub(now)
+	}
+	win.attempts++
+	return true, 0
+}
+
+// sweep forgets stale windows not to grow infinitely.
+// Must be called under lock.
+func (l *attemptLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < attemptSweepPeriod {
+		return
+	}
+	l.lastSweep = now
+
+	for k, win := range l.windows {
+		if now.Sub(win.start) >= l.window {
+			delete(l.windows, k)
+		}
+	}
+}
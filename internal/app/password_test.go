@@ -0,0 +1,169 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+)
+
+func Test_passwordProtection(t *testing.T) {
+	uid := uuid.Must(uuid.NewV4())
+	storage := store.NewInMemory()
+
+	instance := &Instance{
+		baseURL:          "http://localhost:8080",
+		store:            storage,
+		unlockLimiter:    newAttemptLimiter(2, time.Minute),
+		unlockURLLimiter: newAttemptLimiter(3, time.Minute),
+	}
+
+	r := httptest.NewRequest("POST", "http://localhost:8080/api/shorten",
+		strings.NewReader(`{"url":"https://praktikum.yandex.ru/","password":"secret"}`))
+	r = r.WithContext(auth.Context(r.Context(), uid))
+	w := httptest.NewRecorder()
+	instance.ShortenAPIHandler(w, r)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	// protected URL is never deduplicated with plain one
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+	plainID, err := storage.SaveUser(context.Background(), uid, u)
+	require.NoError(t, err)
+	assert.Equal(t, "1", plainID)
+
+	id := "0"
+	rec, err := storage.LoadRecord(context.Background(), id)
+	require.NoError(t, err)
+	assert.NotEqual(t, "secret", rec.Options.PasswordHash)
+
+	newRequest := func(method, body string, cookies ...*http.Cookie) *http.Request {
+		r := httptest.NewRequest(method, "http://localhost:8080/"+id, strings.NewReader(body))
+		if body != "" {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+	}
+
+	t.Run("form", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		instance.ExpandHandler(w, newRequest("GET", ""))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Location"))
+		assert.Contains(t, w.Body.String(), `<form method="post" action="/0">`)
+	})
+
+	t.Run("wrong_password", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		instance.UnlockHandler(w, newRequest("POST", "password=ololo"))
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "Wrong password")
+		assert.Empty(t, w.Result().Cookies())
+	})
+
+	var unlock *http.Cookie
+	t.Run("unlock", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		instance.UnlockHandler(w, newRequest("POST", "password=secret"))
+
+		assert.Equal(t, http.StatusSeeOther, w.Code)
+		assert.Equal(t, "https://praktikum.yandex.ru/", w.Header().Get("Location"))
+
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		unlock = cookies[0]
+		assert.Equal(t, "unlock_0", unlock.Name)
+		assert.Equal(t, "/0", unlock.Path)
+		assert.True(t, unlock.HttpOnly)
+	})
+
+	t.Run("unlocked", func(t *testing.T) {
+		require.NotNil(t, unlock)
+		w := httptest.NewRecorder()
+		instance.ExpandHandler(w, newRequest("GET", "", unlock))
+
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, "https://praktikum.yandex.ru/", w.Header().Get("Location"))
+	})
+
+	t.Run("forged_cookie", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		instance.ExpandHandler(w, newRequest("GET", "", &http.Cookie{Name: "unlock_0", Value: "ololo"}))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Location"))
+	})
+
+	t.Run("rate_limited", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		instance.UnlockHandler(w, newRequest("POST", "password=secret"))
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	})
+
+	t.Run("other_client", func(t *testing.T) {
+		r := newRequest("POST", "password=secret")
+		r = r.WithContext(ClientContext(r.Context(), "192.0.2.1"))
+		w := httptest.NewRecorder()
+		instance.UnlockHandler(w, r)
+
+		assert.Equal(t, http.StatusSeeOther, w.Code)
+	})
+
+	t.Run("url_limited", func(t *testing.T) {
+		// attempts from all clients are limited per URL as well
+		r := newRequest("POST", "password=secret")
+		r = r.WithContext(ClientContext(r.Context(), "192.0.2.2"))
+		w := httptest.NewRecorder()
+		instance.UnlockHandler(w, r)
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	})
+}
+
+func Test_attemptLimiter(t *testing.T) {
+	l := newAttemptLimiter(2, time.Hour)
+
+	ok, _ := l.allow("a")
+	assert.True(t, ok)
+	ok, _ = l.allow("a")
+	assert.True(t, ok)
+	ok, retryAfter := l.allow("a")
+	assert.False(t, ok)
+	assert.True(t, retryAfter > 0 && retryAfter <= time.Hour)
+
+	// other keys are limited separately
+	ok, _ = l.allow("b")
+	assert.True(t, ok)
+
+	var nilLimiter *attemptLimiter
+	ok, _ = nilLimiter.allow("a")
+	assert.True(t, ok)
+
+	// stale windows are evicted by a periodic sweep
+	stale := newAttemptLimiter(1, time.Millisecond)
+	_, _ = stale.allow("a")
+	stale.lastSweep = time.Now().Add(-attemptSweepPeriod)
+	time.Sleep(2 * time.Millisecond)
+	_, _ = stale.allow("b")
+	_, found := stale.windows["a"]
+	assert.False(t, found)
+}
@@ -0,0 +1,303 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+)
+
+const (
+	// previewSuffix appended to short URL ID shows preview instead of redirect
+	previewSuffix = "+"
+	// titleTimeout limits time spent on fetching destination title
+	titleTimeout = 3 * time.Second
+	// titleReadLimit limits number of destination page bytes read looking for title
+	titleReadLimit = 64 << 10
+	// titleRedirects limits number of redirects followed looking for title
+	titleRedirects = 3
+	// titleCacheTTL is a period during which fetched title of URL is shown without fetching it again
+	titleCacheTTL = time.Hour
+	// titleCacheSize limits number of cached titles, cache is emptied once it is exceeded
+	titleCacheSize = 10000
+)
+
+// errNonPublicAddress is returned when title fetch is about to connect to internal network
+var errNonPublicAddress = errors.New("non-public address")
+
+// nonPublicNets are networks title fetch never connects to
+var nonPublicNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.0.0.0/24",
+		"192.168.0.0/16",
+		"198.18.0.0/15",
+		"224.0.0.0/4",
+		"240.0.0.0/4",
+		"::/128",
+		"::1/128",
+		"fc00::/7",
+		"fe80::/10",
+		"ff00::/8",
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Link preview</title></head>
+<body>
+<p>This link leads to:</p>
+{{if .Title}}<h1>{{.Title}}</h1>{{end}}
+<p><code>{{.URL}}</code></p>
+{{if not .CreatedAt.IsZero}}<p>Created {{.CreatedAt.Format "2006-01-02 15:04 MST"}}</p>{{end}}
+<form method="post" action="{{.Action}}">
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// titleFetcher returns title of destination page
+type titleFetcher func(ctx context.Context, u *url.URL) (string, error)
+
+// WithPageTitles enables showing destination page titles on preview page.
+// Titles are fetched from public addresses only and cached per URL.
+func WithPageTitles() Option {
+	return func(i *Instance) {
+		i.fetchTitle = newPageTitleFetcher(publicIP)
+		i.titles = newTitleCache(titleCacheTTL)
+	}
+}
+
+// writePreview shows destination of URL instead of redirecting to it.
+// Continue button posts to UnlockHandler which redirects without preview.
+func (i *Instance) writePreview(w http.ResponseWriter, r *http.Request, rec store.Record) {
+	var title string
+	if i.fetchTitle != nil && r.Method != http.MethodHead {
+		title = i.pageTitle(r.Context(), rec)
+	}
+
+	// keep visitor query for passthrough and template URLs
+	query := r.URL.Query()
+	query.Del("preview")
+	action := "/" + rec.ID
+	if len(query) > 0 {
+		action += "?" + query.Encode()
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	err := previewPage.Execute(w, struct {
+		URL       string
+		Title     string
+		CreatedAt time.Time
+		Action    string
+	}{rec.URL.String(), title, rec.CreatedAt, action})
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// pageTitle returns cached title of record destination fetching it if not cached yet
+func (i *Instance) pageTitle(ctx context.Context, rec store.Record) string {
+	if title, ok := i.titles.get(rec.ID, rec.URL.String()); ok {
+		return title
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, titleTimeout)
+	defer cancel()
+
+	title, err := i.fetchTitle(ctx, rec.URL)
+	if err != nil {
+		fmt.Printf("cannot fetch title of %s: %s\n", rec.URL, err)
+	}
+	// failures are cached as well so that broken destination is not requested on every preview
+	i.titles.put(rec.ID, rec.URL.String(), title)
+	return title
+}
+
+// newPageTitleFetcher returns fetcher connecting only to addresses allowed by given function.
+// Addresses are checked on connect so that redirects and DNS rebinding cannot bypass the check.
+func newPageTitleFetcher(allow func(ip net.IP) bool) titleFetcher {
+	dialer := &net.Dialer{
+		Timeout: titleTimeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !allow(ip) {
+				return fmt.Errorf("cannot connect to %s: %w", host, errNonPublicAddress)
+			}
+			return nil
+		},
+	}
+	client := &http.Client{
+		Timeout: titleTimeout,
+		Transport: &http.Transport{
+			// no proxy as it would connect to destination on our behalf unchecked
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: titleTimeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= titleRedirects {
+				return fmt.Errorf("stopped after %d redirects", titleRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("cannot follow redirect to %s", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+
+	return func(ctx context.Context, u *url.URL) (string, error) {
+		return fetchPageTitle(ctx, client, u)
+	}
+}
+
+// fetchPageTitle requests destination page and returns content of its title element
+func fetchPageTitle(ctx context.Context, client *http.Client, u *url.URL) (string, error) {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot build request: %w", err)
+	}
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot request page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil
+	}
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err != nil || mediaType != "text/html" {
+		return "", nil
+	}
+	return parseTitle(io.LimitReader(resp.Body, titleReadLimit)), nil
+}
+
+// publicIP reports whether address is reachable from internet,
+// loopback, private, link-local (cloud metadata included) and reserved ones are not
+func publicIP(ip net.IP) bool {
+	for _, n := range nonPublicNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// titleCache keeps fetched titles per short URL ID, nil cache keeps nothing
+type titleCache struct {
+	ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[string]cachedTitle
+}
+
+type cachedTitle struct {
+	// url is destination title belongs to, entry is stale once URL is edited
+	url     string
+	title   string
+	expires time.Time
+}
+
+func newTitleCache(ttl time.Duration) *titleCache {
+	return &titleCache{
+		ttl:     ttl,
+		entries: make(map[string]cachedTitle),
+	}
+}
+
+func (c *titleCache) get(id, u string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[id]
+	if !ok || entry.url != u || time.Now().After(entry.expires) {
+		return "", false
+	}
+	return entry.title, true
+}
+
+func (c *titleCache) put(id, u, title string) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.entries) >= titleCacheSize {
+		c.entries = make(map[string]cachedTitle)
+	}
+	c.entries[id] = cachedTitle{url: u, title: title, expires: time.Now().Add(c.ttl)}
+}
+
+// parseTitle returns text of first title element of HTML document
+func parseTitle(r io.Reader) string {
+	tokenizer := html.NewTokenizer(r)
+	inTitle := false
+	var title strings.Builder
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return strings.TrimSpace(title.String())
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			if string(name) == "title" {
+				inTitle = true
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if inTitle && string(name) == "title" {
+				return strings.Join(strings.Fields(title.String()), " ")
+			}
+		case html.TextToken:
+			if inTitle {
+				title.Write(tokenizer.Text())
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package app
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+)
+
+func Test_preview(t *testing.T) {
+	var fetches int32
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte("<html><head><title>\n  Practicum &amp; Go\n</title></head><body></body></html>"))
+	}))
+	defer page.Close()
+
+	uid := uuid.Must(uuid.NewV4())
+	u, _ := url.Parse(page.URL + "/course")
+
+	storage := store.NewInMemory()
+	id, err := storage.SaveUser(context.Background(), uid, u)
+	require.NoError(t, err)
+	forcedID, err := storage.SaveUserOptions(context.Background(), uid, u, store.Options{Interstitial: true})
+	require.NoError(t, err)
+
+	instance := NewInstance("http://localhost:8080", storage, WithPageTitles())
+	// test page is served on loopback
+	instance.fetchTitle = newPageTitleFetcher(func(net.IP) bool { return true })
+
+	expand := func(method, id, target string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		instance.ExpandHandler(w, r)
+		return w
+	}
+
+	tests := []struct {
+		name        string
+		id          string
+		target      string
+		wantPreview bool
+		wantAction  string
+	}{
+		{
+			name:   "redirect",
+			id:     id,
+			target: "http://localhost:8080/" + id,
+		},
+		{
+			name:        "plus_suffix",
+			id:          id + "+",
+			target:      "http://localhost:8080/" + id + "+",
+			wantPreview: true,
+			wantAction:  `action="/` + id + `"`,
+		},
+		{
+			name:        "query",
+			id:          id,
+			target:      "http://localhost:8080/" + id + "?preview=1",
+			wantPreview: true,
+			wantAction:  `action="/` + id + `"`,
+		},
+		{
+			name:        "forced",
+			id:          forcedID,
+			target:      "http://localhost:8080/" + forcedID + "?ref=mail",
+			wantPreview: true,
+			wantAction:  `action="/` + forcedID + `?ref=mail"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := expand("GET", tt.id, tt.target)
+
+			if !tt.wantPreview {
+				assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+				assert.Equal(t, u.String(), w.Header().Get("Location"))
+				return
+			}
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Empty(t, w.Header().Get("Location"))
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			body := w.Body.String()
+			assert.Contains(t, body, "<h1>Practicum &amp; Go</h1>")
+			assert.Contains(t, body, u.String())
+			assert.Contains(t, body, "Created ")
+			assert.Contains(t, body, tt.wantAction)
+		})
+	}
+
+	t.Run("cached", func(t *testing.T) {
+		// titles fetched above are cached per URL
+		before := atomic.LoadInt32(&fetches)
+		w := expand("GET", id+"+", "http://localhost:8080/"+id+"+")
+		assert.Contains(t, w.Body.String(), "<h1>Practicum &amp; Go</h1>")
+
+		w = expand("HEAD", forcedID, "http://localhost:8080/"+forcedID)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, before, atomic.LoadInt32(&fetches))
+	})
+
+	t.Run("continue", func(t *testing.T) {
+		r := httptest.NewRequest("POST", "http://localhost:8080/"+forcedID, strings.NewReader(""))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", forcedID)
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		instance.UnlockHandler(w, r)
+
+		assert.Equal(t, http.StatusSeeOther, w.Code)
+		assert.Equal(t, u.String(), w.Header().Get("Location"))
+	})
+}
+
+func Test_parseTitle(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{name: "simple", page: "<title>Hello</title>", want: "Hello"},
+		{name: "whitespace", page: "<head><title>\n Hello\n  world </title></head>", want: "Hello world"},
+		{name: "missing", page: "<html><body><h1>Hello</h1></body></html>", want: ""},
+		{name: "first_only", page: "<title>One</title><title>Two</title>", want: "One"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseTitle(strings.NewReader(tt.page)))
+		})
+	}
+}
+
+func Test_pageTitleFetcher(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<title>Internal</title>"))
+	}))
+	defer page.Close()
+
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, page.URL, http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	for _, target := range []string{page.URL, redirect.URL, "http://localhost:" + strings.Split(page.URL, ":")[2]} {
+		u, _ := url.Parse(target)
+		title, err := newPageTitleFetcher(publicIP)(context.Background(), u)
+		assert.ErrorIs(t, err, errNonPublicAddress, target)
+		assert.Empty(t, title)
+	}
+
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "::1", "fd00::1", "fe80::1", "0.0.0.0"} {
+		assert.False(t, publicIP(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"8.8.8.8", "2a00:1450:4010:c05::64"} {
+		assert.True(t, publicIP(net.ParseIP(ip)), ip)
+	}
+}
@@ -0,0 +1,291 @@
+package app
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	qrFormatPNG = "png"
+	qrFormatSVG = "svg"
+
+	// qrDefaultSize is a side of QR code image in pixels
+	qrDefaultSize = 256
+	qrMaxSize     = 2048
+	// qrDefaultMargin is a width of quiet zone around QR code in modules
+	qrDefaultMargin = 4
+	qrMaxMargin     = 16
+	// qrCacheSize limits number of rendered QR codes kept in memory
+	qrCacheSize = 1024
+)
+
+// qrParams describes QR code rendering
+type qrParams struct {
+	format string
+	size   int
+	level  qrcode.RecoveryLevel
+	margin int
+}
+
+type qrKey struct {
+	content string
+	params  qrParams
+}
+
+// qrRenderer renders QR codes caching results.
+// Nil renderer uses default settings and caches nothing.
+type qrRenderer struct {
+	level  qrcode.RecoveryLevel
+	margin int
+
+	mutex sync.Mutex
+	cache map[qrKey][]byte
+}
+
+func newQRRenderer(level qrcode.RecoveryLevel, margin int) *qrRenderer {
+	return &qrRenderer{
+		level:  level,
+		margin: margin,
+		cache:  make(map[qrKey][]byte),
+	}
+}
+
+// ParseQRLevel parses QR code error correction level: L, M, Q or H
+func ParseQRLevel(s string) (qrcode.RecoveryLevel, error) {
+	switch strings.ToUpper(s) {
+	case "L":
+		return qrcode.Low, nil
+	case "M":
+		return qrcode.Medium, nil
+	case "Q":
+		return qrcode.High, nil
+	case "H":
+		return qrcode.Highest, nil
+	default:
+		return 0, fmt.Errorf("unknown error correction level %q", s)
+	}
+}
+
+// QRHandler renders short URL as QR code image.
+// Format, size, error correction level and margin may be set by query.
+func (i *Instance) QRHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad ID given"))
+		return
+	}
+
+	params, err := i.qr.params(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(fmt.Sprintf("Bad QR code parameters given: %s", err)))
+		return
+	}
+
+	rec, err := i.store.LoadRecord(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if rec.Disabled != nil {
+		writeTakedown(w, rec.Disabled)
+		return
+	}
+
+	b, err := i.qr.render(i.baseURL+"/"+id, params)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	contentType := "image/png"
+	if params.format == qrFormatSVG {
+		contentType = "image/svg+xml"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// qrDataURI returns short URL QR code as PNG data URI of default look
+func (i *Instance) qrDataURI(shortURL string) (string, error) {
+	params := i.qr.defaults()
+	b, err := i.qr.render(shortURL, params)
+	if err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(b), nil
+}
+
+func (q *qrRenderer) defaults() qrParams {
+	params := qrParams{
+		format: qrFormatPNG,
+		size:   qrDefaultSize,
+		level:  qrcode.Medium,
+		margin: qrDefaultMargin,
+	}
+	if q != nil {
+		params.level = q.level
+		params.margin = q.margin
+	}
+	return params
+}
+
+// params reads rendering parameters from request query over renderer defaults
+func (q *qrRenderer) params(r *http.Request) (qrParams, error) {
+	params := q.defaults()
+	query := r.URL.Query()
+
+	if format := query.Get("format"); format != "" {
+		if format != qrFormatPNG && format != qrFormatSVG {
+			return params, fmt.Errorf("unknown format %q", format)
+		}
+		params.format = format
+	}
+	if size := query.Get("size"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n <= 0 || n > qrMaxSize {
+			return params, fmt.Errorf("size must be from 1 to %d", qrMaxSize)
+		}
+		params.size = n
+	}
+	if level := query.Get("level"); level != "" {
+		l, err := ParseQRLevel(level)
+		if err != nil {
+			return params, err
+		}
+		params.level = l
+	}
+	if margin := query.Get("margin"); margin != "" {
+		n, err := strconv.Atoi(margin)
+		if err != nil || n < 0 || n > qrMaxMargin {
+			return params, fmt.Errorf("margin must be from 0 to %d", qrMaxMargin)
+		}
+		params.margin = n
+	}
+	return params, nil
+}
+
+// render returns encoded QR code image of content
+func (q *qrRenderer) render(content string, params qrParams) ([]byte, error) {
+	key := qrKey{content: content, params: params}
+	if q != nil {
+		q.mutex.Lock()
+		b, ok := q.cache[key]
+		q.mutex.Unlock()
+		if ok {
+			return b, nil
+		}
+	}
+
+	code, err := qrcode.New(content, params.level)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode QR code: %w", err)
+	}
+	code.DisableBorder = true
+	bitmap := code.Bitmap()
+
+	var b []byte
+	if params.format == qrFormatSVG {
+		b = qrSVG(bitmap, params.size, params.margin)
+	} else {
+		b, err = qrPNG(bitmap, params.size, params.margin)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if q != nil {
+		q.mutex.Lock()
+		// drop arbitrary entry not to grow infinitely
+		if len(q.cache) >= qrCacheSize {
+			for k := range q.cache {
+				delete(q.cache, k)
+				break
+			}
+		}
+		q.cache[key] = b
+		q.mutex.Unlock()
+	}
+	return b, nil
+}
+
+// qrPNG draws QR code modules scaled to fit given size with margin around
+func qrPNG(bitmap [][]bool, size, margin int) ([]byte, error) {
+	modules := len(bitmap) + 2*margin
+	scale := size / modules
+	if scale < 1 {
+		scale = 1
+	}
+	// center code when size is not a multiple of modules count
+	side := modules * scale
+	if side < size {
+		side = size
+	}
+	offset := (side - modules*scale) / 2
+
+	img := image.NewGray(image.Rect(0, 0, side, side))
+	for p := range img.Pix {
+		img.Pix[p] = 0xff
+	}
+	for y, row := range bitmap {
+		for x, set := range row {
+			if !set {
+				continue
+			}
+			left := offset + (x+margin)*scale
+			top := offset + (y+margin)*scale
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray(left+dx, top+dy, color.Gray{})
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("cannot encode PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// qrSVG draws QR code as single path merging horizontal runs of modules
+func qrSVG(bitmap [][]bool, size, margin int) []byte {
+	modules := len(bitmap) + 2*margin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, modules, modules)
+	buf.WriteString(`<rect width="100%" height="100%" fill="#fff"/><path fill="#000" d="`)
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", start+margin, y+margin, x-start, x-start)
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/skip2/go-qrcode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+func Test_QRHandler(t *testing.T) {
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+	storage := store.NewInMemory()
+	id, err := storage.Save(context.Background(), u)
+	require.NoError(t, err)
+
+	instance := NewInstance("http://localhost:8080", storage)
+
+	render := func(id, query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "http://localhost:8080/"+id+"/qr?"+query, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		instance.QRHandler(w, r)
+		return w
+	}
+
+	t.Run("png", func(t *testing.T) {
+		w := render(id, "size=300")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+
+		img, err := png.Decode(w.Body)
+		require.NoError(t, err)
+		assert.Equal(t, 300, img.Bounds().Dx())
+		assert.Equal(t, 300, img.Bounds().Dy())
+	})
+
+	t.Run("svg", func(t *testing.T) {
+		w := render(id, "format=svg&size=128&margin=0&level=H")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+		assert.True(t, strings.HasPrefix(w.Body.String(), `<svg xmlns="http://www.w3.org/2000/svg" width="128" height="128"`))
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		first := render(id, "format=svg")
+		second := render(id, "format=svg")
+		assert.Equal(t, first.Body.String(), second.Body.String())
+
+		params := instance.qr.defaults()
+		params.format = qrFormatSVG
+		_, ok := instance.qr.cache[qrKey{content: "http://localhost:8080/" + id, params: params}]
+		assert.True(t, ok)
+	})
+
+	t.Run("bad_params", func(t *testing.T) {
+		for _, query := range []string{"format=gif", "size=0", "size=100000", "level=X", "margin=-1"} {
+			w := render(id, query)
+			assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		}
+	})
+
+	t.Run("not_found", func(t *testing.T) {
+		w := render("unknown", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func Test_qrMargin(t *testing.T) {
+	code, err := qrcode.New("http://localhost:8080/1", qrcode.Medium)
+	require.NoError(t, err)
+	code.DisableBorder = true
+	bitmap := code.Bitmap()
+
+	b, err := qrPNG(bitmap, len(bitmap)+4, 2)
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+
+	// margin is white, top left finder pattern starts right after it
+	r, _, _, _ := img.At(1, 1).RGBA()
+	assert.Equal(t, uint32(0xffff), r)
+	r, _, _, _ = img.At(2, 2).RGBA()
+	assert.Equal(t, uint32(0), r)
+}
+
+func Test_shortenQR(t *testing.T) {
+	instance := NewInstance("http://localhost:8080", store.NewInMemory())
+
+	r := httptest.NewRequest("POST", "http://localhost:8080/api/shorten",
+		strings.NewReader(`{"url":"https://praktikum.yandex.ru/","qr":true}`))
+	r = r.WithContext(auth.Context(r.Context(), uuid.Must(uuid.NewV4())))
+	w := httptest.NewRecorder()
+	instance.ShortenAPIHandler(w, r)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var resp models.ShortenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.True(t, strings.HasPrefix(resp.QR, "data:image/png;base64,"))
+
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(resp.QR, "data:image/png;base64,"))
+	require.NoError(t, err)
+	_, err = png.Decode(bytes.NewReader(b))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+// quota limits URLs owned by single user, zero limit means no limit
+type quota struct {
+	// active limits number of not deleted URLs
+	active int
+	// daily limits number of URLs created since UTC midnight
+	daily int
+}
+
+// writeQuotaError responds with 403 if user has run out of quota
+func writeQuotaError(w http.ResponseWriter, err error) bool {
+	var exceeded *store.QuotaError
+	if !errors.As(err, &exceeded) {
+		return false
+	}
+	w.WriteHeader(http.StatusForbidden)
+	_, _ = w.Write([]byte(exceeded.Error()))
+	return true
+}
+
+// QuotaHandler returns current user quota usage
+func (i *Instance) QuotaHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	day := quotaDay(time.Now())
+	usage, err := i.store.UserUsage(ctx, *uid, day)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(models.QuotaResponse{
+		Active:  models.QuotaUsage{Used: usage.Active, Limit: i.quota.active},
+		Daily:   models.QuotaUsage{Used: usage.Created, Limit: i.quota.daily},
+		ResetAt: day.AddDate(0, 0, 1),
+	})
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// quotaContext returns context which store enforces quota of current user with
+// when n new URLs are saved, anonymous requests are not limited.
+// Clients without established uid get new one on every request, so URLs saved by them
+// are counted per client IP instead.
+func (i *Instance) quotaContext(ctx context.Context, n int) (context.Context, error) {
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil || i.quota.active <= 0 && i.quota.daily <= 0 {
+		return ctx, nil
+	}
+
+	day := quotaDay(time.Now())
+	if auth.IssuedFromContext(ctx) {
+		if err := i.issuedUsage.reserve(clientIPFromContext(ctx), day, n, i.quota); err != nil {
+			return ctx, err
+		}
+	}
+	return store.QuotaContext(ctx, store.Quota{Active: i.quota.active, Daily: i.quota.daily, Since: day}), nil
+}
+
+// ipUsage counts URLs saved by clients without established uid per client IP within UTC day
+type ipUsage struct {
+	mutex   sync.Mutex
+	day     time.Time
+	created map[string]int
+}
+
+func newIPUsage() *ipUsage {
+	return &ipUsage{created: make(map[string]int)}
+}
+
+// reserve counts n URLs saved from IP within day, QuotaError is returned if IP has run out of quota.
+// Daily quota is applied if set, active one otherwise as URLs of different uids cannot be told deleted.
+func (u *ipUsage) reserve(ip string, day time.Time, n int, q quota) error {
+	kind, limit := store.QuotaDaily, q.daily
+	if limit <= 0 {
+		kind, limit = store.QuotaActive, q.active
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	// counters of previous days are dropped at once
+	if !u.day.Equal(day) {
+		u.day = day
+		u.created = make(map[string]int)
+	}
+	if used := u.created[ip]; used+n > limit {
+		return &store.QuotaError{Kind: kind, Limit: limit, Used: used, Requested: n}
+	}
+	u.created[ip] += n
+	return nil
+}
+
+// quotaDay returns start of UTC day daily quota is counted from
+func quotaDay(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,113 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+func Test_quota(t *testing.T) {
+	uid := uuid.Must(uuid.NewV4())
+
+	call := func(instance *Instance, handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "http://localhost:8080/", strings.NewReader(body))
+		r = r.WithContext(auth.Context(r.Context(), uid))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+	batch := func(n int) string {
+		req := make([]models.BatchShortenRequest, n)
+		for j := range req {
+			req[j] = models.BatchShortenRequest{CorrelationID: "c", OriginalURL: "https://praktikum.yandex.ru/"}
+		}
+		b, _ := json.Marshal(req)
+		return string(b)
+	}
+	quotaUsage := func(instance *Instance) models.QuotaResponse {
+		w := call(instance, instance.QuotaHandler, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp models.QuotaResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	t.Run("active", func(t *testing.T) {
+		instance := NewInstance("http://localhost:8080", store.NewInMemory(), WithQuota(3, 0))
+
+		w := call(instance, instance.ShortenHandler, "https://praktikum.yandex.ru/")
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		// batch over quota saves nothing
+		w = call(instance, instance.BatchShortenAPIHandler, batch(3))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, "active quota exceeded: 1 of 3 URLs used, 3 more requested", w.Body.String())
+		assert.Equal(t, models.QuotaUsage{Used: 1, Limit: 3}, quotaUsage(instance).Active)
+
+		w = call(instance, instance.BatchShortenAPIHandler, batch(2))
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		w = call(instance, instance.ShortenAPIHandler, `{"url":"https://praktikum.yandex.ru/"}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		// deleted URLs free quota up
+		urls, err := instance.store.LoadUsers(context.Background(), uid)
+		require.NoError(t, err)
+		for id := range urls {
+			require.NoError(t, instance.store.DeleteUsers(context.Background(), uid, id))
+			break
+		}
+		w = call(instance, instance.ShortenHandler, "https://praktikum.yandex.ru/")
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("daily", func(t *testing.T) {
+		instance := NewInstance("http://localhost:8080", store.NewInMemory(), WithQuota(0, 2))
+
+		w := call(instance, instance.BatchShortenAPIHandler, batch(2))
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		w = call(instance, instance.ShortenHandler, "https://praktikum.yandex.ru/")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.True(t, strings.HasPrefix(w.Body.String(), "daily quota exceeded"))
+
+		resp := quotaUsage(instance)
+		assert.Equal(t, models.QuotaUsage{Used: 2, Limit: 0}, resp.Active)
+		assert.Equal(t, models.QuotaUsage{Used: 2, Limit: 2}, resp.Daily)
+		assert.WithinDuration(t, time.Now(), resp.ResetAt, 24*time.Hour)
+		assert.True(t, resp.ResetAt.After(time.Now()))
+	})
+
+	t.Run("issued", func(t *testing.T) {
+		instance := NewInstance("http://localhost:8080", store.NewInMemory(), WithQuota(0, 2))
+
+		// every cookie-less request gets new uid, so quota is counted per client IP
+		issued := func(ip string) *httptest.ResponseRecorder {
+			r := httptest.NewRequest("POST", "http://localhost:8080/", strings.NewReader("https://praktikum.yandex.ru/"))
+			ctx := auth.IssuedContext(auth.Context(r.Context(), uuid.Must(uuid.NewV4())))
+			w := httptest.NewRecorder()
+			instance.ShortenHandler(w, r.WithContext(ClientContext(ctx, ip)))
+			return w
+		}
+
+		assert.Equal(t, http.StatusCreated, issued("10.0.0.1").Code)
+		assert.Equal(t, http.StatusCreated, issued("10.0.0.1").Code)
+		w := issued("10.0.0.1")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, "daily quota exceeded: 2 of 2 URLs used, 1 more requested", w.Body.String())
+
+		assert.Equal(t, http.StatusCreated, issued("10.0.0.2").Code)
+	})
+}
@@ -0,0 +1,248 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+// permanentRedirectTTL is a period during which clients may cache permanent redirects.
+// It is kept short as owners may still edit destination of a permanently redirected URL,
+// clients keep following the old one until it expires.
+const permanentRedirectTTL = 5 * time.Minute
+
+// settingsTTL is a period during which user defaults are served from cache,
+// changes made through other instances are picked up after it expires
+const settingsTTL = time.Minute
+
+// UpdateRedirectStatusHandler changes redirect status of user URL
+func (i *Instance) UpdateRedirectStatusHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req models.RedirectStatusRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad request body given"))
+		return
+	}
+	if req.RedirectStatus != 0 && !validRedirectStatus(req.RedirectStatus) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad redirect status given"))
+		return
+	}
+
+	rec, ok := i.loadOwnRecord(w, r)
+	if !ok {
+		return
+	}
+
+	opts := rec.Options
+	opts.RedirectStatus = req.RedirectStatus
+	if err := i.store.SetOptions(ctx, *rec.UserID, rec.ID, opts); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	i.recordAudit(ctx, store.AuditRedirect, auditChange{
+		id:     rec.ID,
+		before: strconv.Itoa(rec.Options.RedirectStatus),
+		after:  strconv.Itoa(req.RedirectStatus),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(req)
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// UserSettingsHandler returns current user defaults
+func (i *Instance) UserSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	settings, err := i.store.LoadUserSettings(ctx, *uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(models.UserSettings{
+		RedirectStatus: settings.RedirectStatus,
+	})
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// UpdateUserSettingsHandler replaces current user defaults
+func (i *Instance) UpdateUserSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	var req models.UserSettings
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad request body given"))
+		return
+	}
+	if req.RedirectStatus != 0 && !validRedirectStatus(req.RedirectStatus) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad redirect status given"))
+		return
+	}
+
+	before, err := i.store.LoadUserSettings(ctx, *uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	settings := store.UserSettings{
+		RedirectStatus: req.RedirectStatus,
+	}
+	err = i.store.SaveUserSettings(ctx, *uid, settings)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	i.settings.put(*uid, settings)
+	i.recordAudit(ctx, store.AuditSettings, auditChange{
+		before: strconv.Itoa(before.RedirectStatus),
+		after:  strconv.Itoa(settings.RedirectStatus),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(req)
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// redirectStatus returns status of URL redirect falling back to its owner default
+func (i *Instance) redirectStatus(ctx context.Context, rec store.Record) int {
+	if rec.Options.RedirectStatus != 0 {
+		return rec.Options.RedirectStatus
+	}
+	if rec.UserID != nil {
+		settings, ok := i.settings.get(*rec.UserID)
+		if !ok {
+			var err error
+			settings, err = i.store.LoadUserSettings(ctx, *rec.UserID)
+			if err != nil {
+				// not cached so that store is asked again on next redirect
+				fmt.Printf("cannot load user settings: %s\n", err)
+				return http.StatusTemporaryRedirect
+			}
+			i.settings.put(*rec.UserID, settings)
+		}
+		if settings.RedirectStatus != 0 {
+			return settings.RedirectStatus
+		}
+	}
+	return http.StatusTemporaryRedirect
+}
+
+// settingsCache keeps user defaults for a while to spare store round trip on every redirect,
+// nil cache keeps nothing
+type settingsCache struct {
+	ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[uuid.UUID]cachedSettings
+}
+
+type cachedSettings struct {
+	settings store.UserSettings
+	expires  time.Time
+}
+
+func newSettingsCache(ttl time.Duration) *settingsCache {
+	return &settingsCache{
+		ttl:     ttl,
+		entries: make(map[uuid.UUID]cachedSettings),
+	}
+}
+
+func (c *settingsCache) get(uid uuid.UUID) (store.UserSettings, bool) {
+	if c == nil {
+		return store.UserSettings{}, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[uid]
+	if !ok || time.Now().After(entry.expires) {
+		delete(c.entries, uid)
+		return store.UserSettings{}, false
+	}
+	return entry.settings, true
+}
+
+func (c *settingsCache) put(uid uuid.UUID, settings store.UserSettings) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	// drop expired entries so that cache does not outgrow active users
+	for id, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, id)
+		}
+	}
+	c.entries[uid] = cachedSettings{settings: settings, expires: now.Add(c.ttl)}
+}
+
+func validRedirectStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// writeCacheHeaders allows clients to cache permanent redirects
+// unless destination depends on visitor or number of follows
+func writeCacheHeaders(w http.ResponseWriter, status int, opts store.Options) {
+	permanent := status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect
+	dynamic := opts.PasswordHash != "" ||
+		opts.MaxClicks > 0 ||
+		len(opts.Rules) > 0 ||
+		len(opts.Variants) > 0
+
+	if !permanent || dynamic {
+		w.Header().Set("Cache-Control", "no-store")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(permanentRedirectTTL.Seconds())))
+	w.Header().Set("Expires", time.Now().Add(permanentRedirectTTL).UTC().Format(http.TimeFormat))
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+)
+
+func Test_redirectStatus(t *testing.T) {
+	ctx := context.Background()
+	uid := uuid.Must(uuid.NewV4())
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+
+	storage := store.NewInMemory()
+	permanentID, _ := storage.SaveUserOptions(ctx, uid, u, store.Options{RedirectStatus: http.StatusMovedPermanently})
+	limitedID, _ := storage.SaveUserOptions(ctx, uid, u, store.Options{RedirectStatus: http.StatusPermanentRedirect, MaxClicks: 1})
+	defaultID, _ := storage.SaveUser(ctx, uid, u)
+
+	audit := store.NewMemoryAudit()
+	instance := &Instance{
+		baseURL:  "http://localhost:8080",
+		store:    storage,
+		audit:    audit,
+		settings: newSettingsCache(settingsTTL),
+	}
+
+	expand := func(method, id string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "http://localhost:8080/"+id, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		instance.ExpandHandler(w, r)
+		return w
+	}
+
+	t.Run("permanent", func(t *testing.T) {
+		w := expand("GET", permanentID)
+
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "public, max-age=300", w.Header().Get("Cache-Control"))
+		assert.NotEmpty(t, w.Header().Get("Expires"))
+	})
+
+	t.Run("head_not_counted", func(t *testing.T) {
+		for j := 0; j < 3; j++ {
+			w := expand("HEAD", limitedID)
+
+			assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		}
+		assert.Equal(t, http.StatusPermanentRedirect, expand("GET", limitedID).Code)
+		assert.Equal(t, http.StatusGone, expand("HEAD", limitedID).Code)
+	})
+
+	t.Run("user_default", func(t *testing.T) {
+		assert.Equal(t, http.StatusTemporaryRedirect, expand("GET", defaultID).Code)
+
+		r := httptest.NewRequest("PUT", "http://localhost:8080/api/user/settings", strings.NewReader(`{"redirect_status":302}`))
+		r = r.WithContext(auth.Context(r.Context(), uid))
+		w := httptest.NewRecorder()
+		instance.UpdateUserSettingsHandler(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.Equal(t, http.StatusFound, expand("GET", defaultID).Code)
+		// own status of URL wins over user default
+		assert.Equal(t, http.StatusMovedPermanently, expand("GET", permanentID).Code)
+
+		entries, err := audit.LoadUserAudit(ctx, uid)
+		require.NoError(t, err)
+		require.NotEmpty(t, entries)
+		last := entries[len(entries)-1]
+		assert.Equal(t, store.AuditSettings, last.Action)
+		assert.Equal(t, "0", last.Before)
+		assert.Equal(t, "302", last.After)
+	})
+
+	t.Run("cached_default", func(t *testing.T) {
+		// changes made behind instance back are served from cache until it expires
+		require.NoError(t, storage.SaveUserSettings(ctx, uid, store.UserSettings{RedirectStatus: http.StatusMovedPermanently}))
+		assert.Equal(t, http.StatusFound, expand("GET", defaultID).Code)
+
+		instance.settings = newSettingsCache(0)
+		assert.Equal(t, http.StatusMovedPermanently, expand("GET", defaultID).Code)
+	})
+
+	t.Run("bad_status", func(t *testing.T) {
+		r := httptest.NewRequest("PUT", "http://localhost:8080/api/user/settings", strings.NewReader(`{"redirect_status":200}`))
+		r = r.WithContext(auth.Context(r.Context(), uid))
+		w := httptest.NewRecorder()
+		instance.UpdateUserSettingsHandler(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "Bad redirect status given", w.Body.String())
+	})
+}
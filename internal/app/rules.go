@@ -0,0 +1,316 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+// device classes matched by rules
+const (
+	deviceIOS     = "ios"
+	deviceAndroid = "android"
+	deviceMobile  = "mobile"
+	deviceDesktop = "desktop"
+)
+
+// timeOfDayLayout is a format of time window bounds
+const timeOfDayLayout = "15:04"
+
+// RulesHandler returns redirect rules of user URL
+func (i *Instance) RulesHandler(w http.ResponseWriter, r *http.Request) {
+	rec, ok := i.loadOwnRecord(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(rulesResponse(rec.Options.Rules))
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// UpdateRulesHandler replaces redirect rules of user URL
+func (i *Instance) UpdateRulesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req []models.RedirectRule
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad request body given"))
+		return
+	}
+
+	rules, err := i.parseRules(ctx, req)
+	if writeRejectError(w, err) {
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(fmt.Sprintf("Bad rules given: %s", err)))
+		return
+	}
+
+	rec, ok := i.loadOwnRecord(w, r)
+	if !ok {
+		return
+	}
+
+	opts := rec.Options
+	opts.Rules = rules
+	if err := i.store.SetOptions(ctx, *rec.UserID, rec.ID, opts); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	before, _ := json.Marshal(rulesResponse(rec.Options.Rules))
+	after, _ := json.Marshal(rulesResponse(rules))
+	i.recordAudit(ctx, store.AuditRules, auditChange{id: rec.ID, before: string(before), after: string(after)})
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(rulesResponse(rules))
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// loadOwnRecord loads URL from path owned by current user responding with error otherwise
+func (i *Instance) loadOwnRecord(w http.ResponseWriter, r *http.Request) (rec store.Record, ok bool) {
+	uid := auth.UIDFromContext(r.Context())
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return rec, false
+	}
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad ID given"))
+		return rec, false
+	}
+
+	rec, err := i.store.LoadRecord(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err)
+		return rec, false
+	}
+	if rec.UserID == nil || *rec.UserID != *uid {
+		w.WriteHeader(http.StatusNotFound)
+		return rec, false
+	}
+	return rec, true
+}
+
+// parseRules validates rules given by user
+func (i *Instance) parseRules(ctx context.Context, req []models.RedirectRule) ([]store.Rule, error) {
+	rules := make([]store.Rule, 0, len(req))
+	for n, rule := range req {
+		target, err := canonicalURL(rule.Target)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: bad target URL given: %s", n+1, err)
+		}
+		if err := i.checkTarget(ctx, target); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", n+1, err)
+		}
+
+		for _, lang := range rule.Languages {
+			if lang == "" {
+				return nil, fmt.Errorf("rule %d: empty language given", n+1)
+			}
+		}
+
+		for _, device := range rule.Devices {
+			switch device {
+			case deviceIOS, deviceAndroid, deviceMobile, deviceDesktop:
+			default:
+				return nil, fmt.Errorf("rule %d: unknown device %q given", n+1, device)
+			}
+		}
+
+		var window *store.TimeWindow
+		if rule.Time != nil {
+			window = &store.TimeWindow{
+				From:     rule.Time.From,
+				To:       rule.Time.To,
+				Location: rule.Time.Location,
+			}
+			if err := checkTimeWindow(window); err != nil {
+				return nil, fmt.Errorf("rule %d: %s", n+1, err)
+			}
+		}
+
+		rules = append(rules, store.Rule{
+			Languages: rule.Languages,
+			Devices:   rule.Devices,
+			Time:      window,
+			Target:    target.String(),
+		})
+	}
+	return rules, nil
+}
+
+func checkTimeWindow(window *store.TimeWindow) error {
+	if _, err := time.Parse(timeOfDayLayout, window.From); err != nil {
+		return errors.New("bad time window start given")
+	}
+	if _, err := time.Parse(timeOfDayLayout, window.To); err != nil {
+		return errors.New("bad time window end given")
+	}
+	if _, err := time.LoadLocation(window.Location); err != nil {
+		return errors.New("unknown time window location given")
+	}
+	return nil
+}
+
+func rulesResponse(rules []store.Rule) []models.RedirectRule {
+	resp := make([]models.RedirectRule, 0, len(rules))
+	for _, rule := range rules {
+		item := models.RedirectRule{
+			Languages: rule.Languages,
+			Devices:   rule.Devices,
+			Target:    rule.Target,
+		}
+		if rule.Time != nil {
+			item.Time = &models.TimeWindow{
+				From:     rule.Time.From,
+				To:       rule.Time.To,
+				Location: rule.Time.Location,
+			}
+		}
+		resp = append(resp, item)
+	}
+	return resp
+}
+
+// resolveTarget returns destination of first rule matching request, URL itself otherwise
+func resolveTarget(r *http.Request, rec store.Record, now time.Time) (target *url.URL, matched bool) {
+	if len(rec.Options.Rules) == 0 {
+		return rec.URL, false
+	}
+
+	langs := acceptedLanguages(r.Header.Get("Accept-Language"))
+	device := deviceClass(r.UserAgent())
+	for _, rule := range rec.Options.Rules {
+		if !matchLanguages(rule.Languages, langs) ||
+			!matchDevices(rule.Devices, device) ||
+			!matchTimeWindow(rule.Time, now) {
+			continue
+		}
+		target, err := url.Parse(rule.Target)
+		if err != nil {
+			continue
+		}
+		return target, true
+	}
+	return rec.URL, false
+}
+
+// acceptedLanguages returns lowercased language tags accepted by client
+func acceptedLanguages(header string) (langs []string) {
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		accepted := true
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+			accepted = err == nil && q > 0
+		}
+		if accepted {
+			langs = append(langs, tag)
+		}
+	}
+	return langs
+}
+
+func matchLanguages(ruleLangs, langs []string) bool {
+	if len(ruleLangs) == 0 {
+		return true
+	}
+	for _, want := range ruleLangs {
+		want = strings.ToLower(want)
+		for _, lang := range langs {
+			if lang == want || strings.HasPrefix(lang, want+"-") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// deviceClass guesses client device class by its User-Agent
+func deviceClass(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "iPhone"),
+		strings.Contains(userAgent, "iPad"),
+		strings.Contains(userAgent, "iPod"):
+		return deviceIOS
+	case strings.Contains(userAgent, "Android"):
+		return deviceAndroid
+	case strings.Contains(userAgent, "Mobile"):
+		return deviceMobile
+	default:
+		return deviceDesktop
+	}
+}
+
+func matchDevices(ruleDevices []string, device string) bool {
+	if len(ruleDevices) == 0 {
+		return true
+	}
+	for _, want := range ruleDevices {
+		// mobile matches any handheld device
+		if want == device || want == deviceMobile && device != deviceDesktop {
+			return true
+		}
+	}
+	return false
+}
+
+func matchTimeWindow(window *store.TimeWindow, now time.Time) bool {
+	if window == nil {
+		return true
+	}
+	loc, err := time.LoadLocation(window.Location)
+	if err != nil {
+		return false
+	}
+	from, err := time.Parse(timeOfDayLayout, window.From)
+	if err != nil {
+		return false
+	}
+	to, err := time.Parse(timeOfDayLayout, window.To)
+	if err != nil {
+		return false
+	}
+
+	now = now.In(loc)
+	minute := now.Hour()*60 + now.Minute()
+	start := from.Hour()*60 + from.Minute()
+	end := to.Hour()*60 + to.Minute()
+	if start <= end {
+		return start <= minute && minute < end
+	}
+	return minute >= start || minute < end
+}
@@ -0,0 +1,160 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+)
+
+func Test_resolveTarget(t *testing.T) {
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+	rec := store.Record{
+		ID:  "0",
+		URL: u,
+		Options: store.Options{Rules: []store.Rule{
+			{Devices: []string{"ios"}, Target: "https://apps.apple.com/"},
+			{Devices: []string{"android"}, Target: "https://play.google.com/"},
+			{Languages: []string{"en"}, Time: &store.TimeWindow{From: "22:00", To: "06:00"}, Target: "https://example.com/night"},
+			{Languages: []string{"en"}, Target: "https://example.com/"},
+		}},
+	}
+	noon := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	midnight := time.Date(2022, 1, 1, 0, 30, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name           string
+		userAgent      string
+		acceptLanguage string
+		now            time.Time
+		expected       string
+	}{
+		{
+			name:      "ios",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 15_0 like Mac OS X) Mobile/15E148",
+			now:       noon,
+			expected:  "https://apps.apple.com/",
+		},
+		{
+			name:      "android",
+			userAgent: "Mozilla/5.0 (Linux; Android 12; Pixel 6) Mobile Safari/537.36",
+			now:       noon,
+			expected:  "https://play.google.com/",
+		},
+		{
+			name:           "language",
+			userAgent:      "Mozilla/5.0 (X11; Linux x86_64)",
+			acceptLanguage: "ru-RU, en-US;q=0.8",
+			now:            noon,
+			expected:       "https://example.com/",
+		},
+		{
+			name:           "night",
+			userAgent:      "Mozilla/5.0 (X11; Linux x86_64)",
+			acceptLanguage: "en-GB",
+			now:            midnight,
+			expected:       "https://example.com/night",
+		},
+		{
+			name:           "rejected_language",
+			userAgent:      "Mozilla/5.0 (X11; Linux x86_64)",
+			acceptLanguage: "ru, en;q=0",
+			now:            noon,
+			expected:       "https://praktikum.yandex.ru/",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://localhost:8080/0", nil)
+			r.Header.Set("User-Agent", tc.userAgent)
+			r.Header.Set("Accept-Language", tc.acceptLanguage)
+
+			target, _ := resolveTarget(r, rec, tc.now)
+			assert.Equal(t, tc.expected, target.String())
+		})
+	}
+}
+
+func Test_updateRules(t *testing.T) {
+	uid := uuid.Must(uuid.NewV4())
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+
+	storage := store.NewInMemory()
+	id, _ := storage.SaveUser(context.Background(), uid, u)
+
+	instance := &Instance{
+		baseURL: "http://localhost:8080",
+		store:   storage,
+	}
+
+	newRequest := func(method, body string, uid uuid.UUID) *http.Request {
+		r := httptest.NewRequest(method, "http://localhost:8080/api/user/urls/"+id+"/rules", strings.NewReader(body))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+		return r.WithContext(auth.Context(ctx, uid))
+	}
+
+	testCases := []struct {
+		name           string
+		uid            uuid.UUID
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "bad_device",
+			uid:            uid,
+			body:           `[{"devices":["fridge"],"target":"https://ya.ru/"}]`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Bad rules given: rule 1: unknown device \"fridge\" given",
+		},
+		{
+			name:           "bad_time",
+			uid:            uid,
+			body:           `[{"time":{"from":"25:00","to":"06:00"},"target":"https://ya.ru/"}]`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Bad rules given: rule 1: bad time window start given",
+		},
+		{
+			name:           "not_owner",
+			uid:            uuid.Must(uuid.NewV4()),
+			body:           `[{"devices":["ios"],"target":"https://ya.ru/"}]`,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "success",
+			uid:            uid,
+			body:           `[{"devices":["ios"],"target":"https://ya.ru/"}]`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "[{\"devices\":[\"ios\"],\"target\":\"https://ya.ru/\"}]\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			instance.UpdateRulesHandler(w, newRequest("PUT", tc.body, tc.uid))
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+
+	w := httptest.NewRecorder()
+	instance.RulesHandler(w, newRequest("GET", "", uid))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[{\"devices\":[\"ios\"],\"target\":\"https://ya.ru/\"}]\n", w.Body.String())
+}
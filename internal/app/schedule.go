@@ -0,0 +1,36 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+)
+
+// comingSoonData describes values available to coming soon page template
+type comingSoonData struct {
+	ID         string
+	ActiveFrom time.Time
+}
+
+// writeComingSoon responds with 404 to not yet active URL
+// rendering coming soon page if configured
+func (i *Instance) writeComingSoon(w http.ResponseWriter, rec store.Record) {
+	w.Header().Set("Cache-Control", "no-store")
+	if i.comingSoon == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+
+	err := i.comingSoon.Execute(w, comingSoonData{
+		ID:         rec.ID,
+		ActiveFrom: *rec.Options.ActiveFrom,
+	})
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
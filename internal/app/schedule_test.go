@@ -0,0 +1,90 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+func Test_activeFrom(t *testing.T) {
+	uid := uuid.Must(uuid.NewV4())
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+	future := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	past := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+
+	storage := store.NewInMemory()
+	pendingID, _ := storage.SaveUserOptions(context.Background(), uid, u, store.Options{ActiveFrom: &future})
+	activeID, _ := storage.SaveUserOptions(context.Background(), uid, u, store.Options{ActiveFrom: &past})
+
+	expand := func(instance *Instance, id string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "http://localhost:8080/"+id, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		instance.ExpandHandler(w, r)
+		return w
+	}
+
+	t.Run("not_found", func(t *testing.T) {
+		instance := &Instance{baseURL: "http://localhost:8080", store: storage}
+		w := expand(instance, pendingID)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Empty(t, w.Header().Get("Location"))
+		assert.Empty(t, w.Body.String())
+	})
+
+	t.Run("coming_soon", func(t *testing.T) {
+		tmpl := template.Must(template.New("soon").Parse(`{{.ID}} opens at {{.ActiveFrom.Format "2006-01-02"}}`))
+		instance := NewInstance("http://localhost:8080", storage, WithComingSoonPage(tmpl))
+		w := expand(instance, pendingID)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, pendingID+" opens at "+future.Format("2006-01-02"), w.Body.String())
+	})
+
+	t.Run("active", func(t *testing.T) {
+		instance := &Instance{baseURL: "http://localhost:8080", store: storage}
+		w := expand(instance, activeID)
+
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, u.String(), w.Header().Get("Location"))
+	})
+
+	t.Run("user_urls", func(t *testing.T) {
+		instance := &Instance{baseURL: "http://localhost:8080", store: storage}
+		r := httptest.NewRequest("GET", "http://localhost:8080/api/user/urls", nil)
+		r = r.WithContext(auth.Context(r.Context(), uid))
+		w := httptest.NewRecorder()
+		instance.UserURLsHandler(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp []models.URLResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+		pending := make(map[string]bool)
+		for _, item := range resp {
+			require.NotNil(t, item.ActiveFrom)
+			pending[item.ShortURL] = item.Pending
+		}
+		assert.Equal(t, map[string]bool{
+			"http://localhost:8080/" + pendingID: true,
+			"http://localhost:8080/" + activeID:  false,
+		}, pending)
+	})
+}
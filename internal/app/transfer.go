@@ -0,0 +1,239 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+// transferTokenTTL is a period during which transfer can be accepted
+const transferTokenTTL = 7 * 24 * time.Hour
+
+// transferToken describes sealed reference to stored transfer offer
+type transferToken struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+// TransferOfferHandler issues single-use token allowing another user to take given user URLs.
+// Offer is bound to account of email given in "to" query parameter if any.
+func (i *Instance) TransferOfferHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	var ids []string
+	err := json.NewDecoder(r.Body).Decode(&ids)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad request body given"))
+		return
+	}
+
+	if len(ids) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Empty IDs list given"))
+		return
+	}
+
+	urls, err := i.store.LoadUsers(ctx, *uid)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	for _, id := range ids {
+		if _, ok := urls[id]; !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("URL %s is not owned by user", id)))
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	transfer := store.Transfer{
+		ID:        uuid.Must(uuid.NewV4()).String(),
+		From:      *uid,
+		IDs:       ids,
+		CreatedAt: now,
+		ExpiresAt: now.Add(transferTokenTTL),
+	}
+
+	if to := r.URL.Query().Get("to"); to != "" {
+		email, err := normalizeEmail(to)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("Bad recipient email given: %s", err)))
+			return
+		}
+		account, err := i.store.LoadAccount(ctx, email)
+		if errors.Is(err, store.ErrNotFound) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("Recipient account not found"))
+			return
+		}
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		transfer.To = &account.UserID
+	}
+
+	if err := i.store.SaveTransfer(ctx, transfer); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	b, err := json.Marshal(transferToken{ID: transfer.ID, ExpiresAt: transfer.ExpiresAt})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	sealed, err := auth.SealToHex(auth.PurposeTransfer, b)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("cannot seal transfer token"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	err = json.NewEncoder(w).Encode(models.TransferTokenResponse{
+		ID:        transfer.ID,
+		Token:     sealed,
+		ExpiresAt: transfer.ExpiresAt,
+	})
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// TransferCancelHandler cancels pending transfer offered by current user
+func (i *Instance) TransferCancelHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if err := i.store.CancelTransfer(ctx, *uid, id, time.Now().UTC()); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TransferAcceptHandler moves URLs offered by transfer token to current user
+func (i *Instance) TransferAcceptHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uid := auth.UIDFromContext(ctx)
+	if uid == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	var req models.TransferAcceptRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad request body given"))
+		return
+	}
+
+	var token transferToken
+	b, err := auth.OpenFromHex(auth.PurposeTransfer, req.Token)
+	if err == nil {
+		err = json.Unmarshal(b, &token)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad transfer token given"))
+		return
+	}
+
+	transfer, err := i.store.LoadTransfer(ctx, token.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad transfer token given"))
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	if time.Now().After(transfer.ExpiresAt) {
+		w.WriteHeader(http.StatusGone)
+		_, _ = w.Write([]byte("Transfer token expired"))
+		return
+	}
+	if transfer.From == *uid {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Cannot transfer URLs to their owner"))
+		return
+	}
+	if transfer.To != nil && *transfer.To != *uid {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("Transfer is offered to another user"))
+		return
+	}
+
+	moved, err := i.store.AcceptTransfer(ctx, transfer.ID, *uid, time.Now().UTC())
+	if errors.Is(err, store.ErrDeleted) {
+		w.WriteHeader(http.StatusGone)
+		_, _ = w.Write([]byte("Transfer has already been accepted or cancelled"))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	changes := make([]auditChange, 0, len(moved))
+	for _, id := range moved {
+		changes = append(changes, auditChange{id: id, before: transfer.From.String(), after: uid.String()})
+	}
+	i.recordAudit(ctx, store.AuditTransfer, changes...)
+
+	urls, err := i.store.LoadUsers(ctx, *uid)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]models.URLResponse, 0, len(moved))
+	for _, id := range moved {
+		u, ok := urls[id]
+		if !ok {
+			continue
+		}
+		resp = append(resp, models.URLResponse{
+			ShortURL:    i.baseURL + "/" + id,
+			OriginalURL: u.String(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
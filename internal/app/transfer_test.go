@@ -0,0 +1,199 @@
+package app
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+func Test_transfer(t *testing.T) {
+	from := uuid.Must(uuid.NewV4())
+	to := uuid.Must(uuid.NewV4())
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+
+	storage := store.NewInMemory()
+	id, _ := storage.SaveUser(context.Background(), from, u)
+
+	instance := &Instance{
+		baseURL: "http://localhost:8080",
+		store:   storage,
+	}
+
+	t.Run("not_owned", func(t *testing.T) {
+		r := httptest.NewRequest("POST", "http://localhost:8080/api/user/urls/transfer", strings.NewReader(`["`+id+`"]`))
+		r = r.WithContext(auth.Context(r.Context(), to))
+		w := httptest.NewRecorder()
+		instance.TransferOfferHandler(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	r := httptest.NewRequest("POST", "http://localhost:8080/api/user/urls/transfer", strings.NewReader(`["`+id+`"]`))
+	r = r.WithContext(auth.Context(r.Context(), from))
+	w := httptest.NewRecorder()
+	instance.TransferOfferHandler(w, r)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var offer models.TransferTokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &offer))
+	body := `{"token":"` + offer.Token + `"}`
+
+	// token of the same offer sealed for another purpose
+	b, err := auth.Open(auth.PurposeTransfer, mustDecodeHex(t, offer.Token))
+	require.NoError(t, err)
+	sealed, err := auth.SealToHex(auth.PurposeUnlock, b)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name           string
+		uid            uuid.UUID
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "bad_token",
+			uid:            to,
+			body:           `{"token":"ololo"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Bad transfer token given",
+		},
+		{
+			name:           "other_purpose",
+			uid:            to,
+			body:           `{"token":"` + sealed + `"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Bad transfer token given",
+		},
+		{
+			name:           "same_user",
+			uid:            from,
+			body:           body,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Cannot transfer URLs to their owner",
+		},
+		{
+			name:           "accept",
+			uid:            to,
+			body:           body,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "[{\"short_url\":\"http://localhost:8080/" + id + "\",\"original_url\":\"https://praktikum.yandex.ru/\"}]\n",
+		},
+		{
+			name:           "accept_again",
+			uid:            uuid.Must(uuid.NewV4()),
+			body:           body,
+			expectedStatus: http.StatusGone,
+			expectedBody:   "Transfer has already been accepted or cancelled",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "http://localhost:8080/api/user/urls/transfer/accept", strings.NewReader(tc.body))
+			r = r.WithContext(auth.Context(r.Context(), tc.uid))
+			w := httptest.NewRecorder()
+			instance.TransferAcceptHandler(w, r)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+
+	_, err = storage.LoadUser(context.Background(), from, id)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	_, err = storage.LoadUser(context.Background(), to, id)
+	assert.NoError(t, err)
+}
+
+func Test_transferRecipient(t *testing.T) {
+	from := uuid.Must(uuid.NewV4())
+	to := uuid.Must(uuid.NewV4())
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+
+	storage := store.NewInMemory()
+	id, _ := storage.SaveUser(context.Background(), from, u)
+	require.NoError(t, storage.SaveAccount(context.Background(), store.Account{UserID: to, Email: "to@example.com"}))
+
+	instance := &Instance{
+		baseURL: "http://localhost:8080",
+		store:   storage,
+	}
+
+	offer := func(t *testing.T, target string) models.TransferTokenResponse {
+		r := httptest.NewRequest("POST", target, strings.NewReader(`["`+id+`"]`))
+		r = r.WithContext(auth.Context(r.Context(), from))
+		w := httptest.NewRecorder()
+		instance.TransferOfferHandler(w, r)
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		var resp models.TransferTokenResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+	accept := func(uid uuid.UUID, token string) int {
+		r := httptest.NewRequest("POST", "http://localhost:8080/api/user/urls/transfer/accept",
+			strings.NewReader(`{"token":"`+token+`"}`))
+		r = r.WithContext(auth.Context(r.Context(), uid))
+		w := httptest.NewRecorder()
+		instance.TransferAcceptHandler(w, r)
+		return w.Code
+	}
+
+	t.Run("unknown_recipient", func(t *testing.T) {
+		r := httptest.NewRequest("POST", "http://localhost:8080/api/user/urls/transfer?to=nobody@example.com",
+			strings.NewReader(`["`+id+`"]`))
+		r = r.WithContext(auth.Context(r.Context(), from))
+		w := httptest.NewRecorder()
+		instance.TransferOfferHandler(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		resp := offer(t, "http://localhost:8080/api/user/urls/transfer")
+
+		cancel := func(uid uuid.UUID) int {
+			r := httptest.NewRequest("DELETE", "http://localhost:8080/api/user/urls/transfer/"+resp.ID, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", resp.ID)
+			r = r.WithContext(context.WithValue(auth.Context(r.Context(), uid), chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+			instance.TransferCancelHandler(w, r)
+			return w.Code
+		}
+
+		assert.Equal(t, http.StatusNotFound, cancel(to))
+		assert.Equal(t, http.StatusNoContent, cancel(from))
+		assert.Equal(t, http.StatusGone, cancel(from))
+		assert.Equal(t, http.StatusGone, accept(to, resp.Token))
+	})
+
+	resp := offer(t, "http://localhost:8080/api/user/urls/transfer?to=TO@example.com")
+	assert.Equal(t, http.StatusForbidden, accept(uuid.Must(uuid.NewV4()), resp.Token))
+	assert.Equal(t, http.StatusOK, accept(to, resp.Token))
+
+	_, err := storage.LoadUser(context.Background(), to, id)
+	assert.NoError(t, err)
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
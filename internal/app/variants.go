@@ -0,0 +1,180 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+// variantCookieTTL is a period during which returning visitor stays on the same variant
+const variantCookieTTL = 30 * 24 * time.Hour
+
+// VariantsHandler returns variants of user URL with their follow counts
+func (i *Instance) VariantsHandler(w http.ResponseWriter, r *http.Request) {
+	rec, ok := i.loadOwnRecord(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(variantsResponse(rec))
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// UpdateVariantsHandler replaces variants of user URL.
+// Follow counts are kept by variant position.
+func (i *Instance) UpdateVariantsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req models.VariantsRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Bad request body given"))
+		return
+	}
+
+	variants, err := i.parseVariants(ctx, req.Variants)
+	if writeRejectError(w, err) {
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(fmt.Sprintf("Bad variants given: %s", err)))
+		return
+	}
+
+	rec, ok := i.loadOwnRecord(w, r)
+	if !ok {
+		return
+	}
+
+	opts := rec.Options
+	opts.Variants = variants
+	opts.StickyVariants = req.Sticky && len(variants) > 0
+	if err := i.store.SetOptions(ctx, *rec.UserID, rec.ID, opts); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	before, _ := json.Marshal(rec.Options.Variants)
+	rec.Options = opts
+	after, _ := json.Marshal(rec.Options.Variants)
+	i.recordAudit(ctx, store.AuditVariants, auditChange{id: rec.ID, before: string(before), after: string(after)})
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(variantsResponse(rec))
+	if err != nil {
+		fmt.Printf("cannot write response: %s", err)
+	}
+}
+
+// parseVariants validates variants given by user
+func (i *Instance) parseVariants(ctx context.Context, req []models.RedirectVariant) ([]store.Variant, error) {
+	variants := make([]store.Variant, 0, len(req))
+	for n, variant := range req {
+		target, err := canonicalURL(variant.Target)
+		if err != nil {
+			return nil, fmt.Errorf("variant %d: bad target URL given: %s", n+1, err)
+		}
+		if err := i.checkTarget(ctx, target); err != nil {
+			return nil, fmt.Errorf("variant %d: %w", n+1, err)
+		}
+		if variant.Weight <= 0 {
+			return nil, fmt.Errorf("variant %d: weight must be positive", n+1)
+		}
+		variants = append(variants, store.Variant{
+			Target: target.String(),
+			Weight: variant.Weight,
+		})
+	}
+	return variants, nil
+}
+
+func variantsResponse(rec store.Record) models.VariantsResponse {
+	resp := models.VariantsResponse{
+		Variants: make([]models.VariantStatsResponse, 0, len(rec.Options.Variants)),
+		Sticky:   rec.Options.StickyVariants,
+	}
+	for n, variant := range rec.Options.Variants {
+		resp.Variants = append(resp.Variants, models.VariantStatsResponse{
+			Target: variant.Target,
+			Weight: variant.Weight,
+			Clicks: rec.VariantClicks[n],
+		})
+	}
+	return resp
+}
+
+// pickVariant chooses URL variant randomly according to weights,
+// returning visitors get the remembered one if variants are sticky
+func pickVariant(w http.ResponseWriter, r *http.Request, rec store.Record) (target *url.URL, variant int) {
+	variants := rec.Options.Variants
+
+	variant = -1
+	if rec.Options.StickyVariants {
+		if cookie, err := r.Cookie(variantCookieName(rec.ID)); err == nil {
+			if n, err := strconv.Atoi(cookie.Value); err == nil && n >= 0 && n < len(variants) {
+				variant = n
+			}
+		}
+	}
+
+	if variant < 0 {
+		variant = weightedChoice(variants)
+		if rec.Options.StickyVariants {
+			http.SetCookie(w, &http.Cookie{
+				Name:     variantCookieName(rec.ID),
+				Value:    strconv.Itoa(variant),
+				Path:     "/" + rec.ID,
+				MaxAge:   int(variantCookieTTL.Seconds()),
+				HttpOnly: true,
+			})
+		}
+	}
+
+	target, err := url.Parse(variants[variant].Target)
+	if err != nil {
+		return rec.URL, variant
+	}
+	return target, variant
+}
+
+// weightedChoice returns position of randomly chosen variant
+func weightedChoice(variants []store.Variant) int {
+	var total int64
+	for _, v := range variants {
+		total += int64(v.Weight)
+	}
+	if total <= 0 {
+		return 0
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(total))
+	if err != nil {
+		return 0
+	}
+	point := n.Int64()
+	for pos, v := range variants {
+		point -= int64(v.Weight)
+		if point < 0 {
+			return pos
+		}
+	}
+	return len(variants) - 1
+}
+
+func variantCookieName(id string) string {
+	return "variant_" + id
+}
@@ -0,0 +1,103 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/auth"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/store"
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/models"
+)
+
+func Test_weightedChoice(t *testing.T) {
+	variants := []store.Variant{
+		{Target: "https://a.example.com/", Weight: 1},
+		{Target: "https://b.example.com/", Weight: 3},
+	}
+
+	counts := make([]int, len(variants))
+	for j := 0; j < 4000; j++ {
+		counts[weightedChoice(variants)]++
+	}
+	assert.InDelta(t, 1000, counts[0], 200)
+	assert.InDelta(t, 3000, counts[1], 200)
+}
+
+func Test_variants(t *testing.T) {
+	uid := uuid.Must(uuid.NewV4())
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+
+	storage := store.NewInMemory()
+	id, _ := storage.SaveUser(context.Background(), uid, u)
+
+	instance := &Instance{
+		baseURL: "http://localhost:8080",
+		store:   storage,
+	}
+
+	newRequest := func(method, target, body string) *http.Request {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+		return r.WithContext(auth.Context(ctx, uid))
+	}
+
+	t.Run("bad_weight", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		instance.UpdateVariantsHandler(w, newRequest("PUT", "http://localhost:8080/api/user/urls/"+id+"/variants",
+			`{"variants":[{"target":"https://a.example.com/","weight":0}]}`))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "Bad variants given: variant 1: weight must be positive", w.Body.String())
+	})
+
+	w := httptest.NewRecorder()
+	instance.UpdateVariantsHandler(w, newRequest("PUT", "http://localhost:8080/api/user/urls/"+id+"/variants",
+		`{"variants":[{"target":"https://a.example.com/","weight":1},{"target":"https://b.example.com/","weight":1}],"sticky":true}`))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// first follow assigns variant remembered by cookie
+	w = httptest.NewRecorder()
+	instance.ExpandHandler(w, newRequest("GET", "http://localhost:8080/"+id, ""))
+	require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	location := w.Header().Get("Location")
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "variant_"+id, cookies[0].Name)
+
+	for j := 0; j < 5; j++ {
+		r := newRequest("GET", "http://localhost:8080/"+id, "")
+		r.AddCookie(cookies[0])
+		w := httptest.NewRecorder()
+		instance.ExpandHandler(w, r)
+
+		assert.Equal(t, location, w.Header().Get("Location"))
+	}
+
+	w = httptest.NewRecorder()
+	instance.VariantsHandler(w, newRequest("GET", "http://localhost:8080/api/user/urls/"+id+"/variants", ""))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp models.VariantsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Sticky)
+	require.Len(t, resp.Variants, 2)
+
+	clicks := make(map[string]int)
+	for _, v := range resp.Variants {
+		clicks[v.Target] = v.Clicks
+	}
+	assert.Equal(t, 6, clicks[location])
+}
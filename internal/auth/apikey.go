@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// apiKeyPrefix marks API keys to tell them from other tokens and find them in leaked data
+	apiKeyPrefix = "shk_"
+	apiKeyIDSize = 8
+	// apiKeySecretSize is large enough to store secret hashed with fast hash function
+	apiKeySecretSize = 32
+)
+
+var errBadAPIKey = errors.New("malformed API key")
+
+// NewAPIKey generates API key formatted as shk_<id>_<secret>.
+// The key is to be shown to its owner once, only its ID and hash of its secret are to be stored.
+func NewAPIKey() (key, id string, hash []byte, err error) {
+	rawID := make([]byte, apiKeyIDSize)
+	if _, err := rand.Read(rawID); err != nil {
+		return "", "", nil, fmt.Errorf("cannot generate API key ID: %w", err)
+	}
+	secret := make([]byte, apiKeySecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", nil, fmt.Errorf("cannot generate API key secret: %w", err)
+	}
+
+	id = hex.EncodeToString(rawID)
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	return apiKeyPrefix + id + "_" + encoded, id, hashAPIKeySecret(encoded), nil
+}
+
+// ParseAPIKey returns ID of API key and hash of its secret to compare with stored one
+func ParseAPIKey(key string) (id string, hash []byte, err error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", nil, errBadAPIKey
+	}
+	parts := strings.SplitN(strings.TrimPrefix(key, apiKeyPrefix), "_", 2)
+	if len(parts) != 2 || len(parts[0]) != 2*apiKeyIDSize || parts[1] == "" {
+		return "", nil, errBadAPIKey
+	}
+	if _, err := hex.DecodeString(parts[0]); err != nil {
+		return "", nil, errBadAPIKey
+	}
+	return parts[0], hashAPIKeySecret(parts[1]), nil
+}
+
+func hashAPIKeySecret(secret string) []byte {
+	h := sha256.Sum256([]byte(secret))
+	return h[:]
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAPIKey(t *testing.T) {
+	key, id, hash, err := NewAPIKey()
+	require.NoError(t, err)
+
+	gotID, gotHash, err := ParseAPIKey(key)
+	require.NoError(t, err)
+	assert.Equal(t, id, gotID)
+	assert.Equal(t, hash, gotHash)
+
+	_, gotHash, err = ParseAPIKey(key + "x")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, gotHash)
+
+	for _, bad := range []string{"", "ololo", "shk_", "shk_" + id, "shk_" + id + "_", "shk_zz_secret", "key_" + id + "_secret"} {
+		_, _, err := ParseAPIKey(bad)
+		assert.Error(t, err, bad)
+	}
+}
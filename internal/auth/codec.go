@@ -2,38 +2,80 @@
 package auth
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"io"
+	"time"
 
 	"github.com/gofrs/uuid"
+)
+
+// Purpose separates data sealed for different uses,
+// data sealed for one purpose cannot be opened for another one
+type Purpose string
 
-	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/config"
+const (
+	// PurposeUID seals uid of auth tokens, it is empty to keep tokens sealed before purposes were introduced valid
+	PurposeUID Purpose = ""
+	// PurposeUnlock seals access to password-protected URLs
+	PurposeUnlock Purpose = "unlock"
+	// PurposeTransfer seals offers of URLs to another user
+	PurposeTransfer Purpose = "transfer"
 )
 
-// EncodeUID encode uid
-func EncodeUID(uid uuid.UUID) ([]byte, error) {
-	c, err := aes.NewCipher(config.AuthSecret)
+// Seal encrypt and authenticate data for given purpose with active auth secret
+func Seal(purpose Purpose, plaintext []byte) ([]byte, error) {
+	k, err := currentKeyRing()
 	if err != nil {
-		return nil, fmt.Errorf("cannot create new cipher: %w", err)
+		return nil, err
 	}
+	return k.seal(purpose, plaintext)
+}
 
-	gcm, err := cipher.NewGCM(c)
+// Open decrypt data sealed for given purpose with any accepted auth secret
+func Open(purpose Purpose, ciphertext []byte) ([]byte, error) {
+	plaintext, _, err := openStale(purpose, ciphertext)
+	return plaintext, err
+}
+
+// openStale decrypt data reporting whether it has been sealed with not active auth secret
+func openStale(purpose Purpose, ciphertext []byte) ([]byte, bool, error) {
+	k, err := currentKeyRing()
 	if err != nil {
-		return nil, fmt.Errorf("cannot create gcm from cipher: %w", err)
+		return nil, false, err
 	}
+	return k.open(purpose, ciphertext)
+}
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, fmt.Errorf("cannot populate nonce: %w", err)
+// SealToHex seal data and encode it to hex
+func SealToHex(purpose Purpose, plaintext []byte) (string, error) {
+	b, err := Seal(purpose, plaintext)
+	if err != nil {
+		return "", err
 	}
+	return hex.EncodeToString(b), nil
+}
 
-	cyphertext := gcm.Seal(nonce, nonce, uid.Bytes(), nil)
-	return cyphertext, nil
+// OpenFromHex open data sealed with SealToHex
+func OpenFromHex(purpose Purpose, s string) ([]byte, error) {
+	h, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode hex string to bytes: %w", err)
+	}
+	return Open(purpose, h)
+}
+
+// Session is signed in user carried by auth token
+type Session struct {
+	UID uuid.UUID
+	// Epoch is session epoch of user account at issue, tokens of older epochs are revoked
+	Epoch int64
+}
+
+// EncodeUID encode uid with current time as its issue time
+func EncodeUID(uid uuid.UUID) ([]byte, error) {
+	return encodeSessionAt(Session{UID: uid}, time.Now())
 }
 
 // EncodeUIDToHex encode uid to hex
@@ -47,39 +89,112 @@ func EncodeUIDToHex(uid uuid.UUID) (string, error) {
 
 // DecodeUID decode uid to hex
 func DecodeUID(ciphertext []byte) (*uuid.UUID, error) {
-	c, err := aes.NewCipher(config.AuthSecret)
+	s, _, _, err := decodeSession(ciphertext)
 	if err != nil {
-		return nil, fmt.Errorf("cannot create new cipher: %w", err)
+		return nil, err
 	}
+	return &s.UID, nil
+}
 
-	gcm, err := cipher.NewGCM(c)
+// DecodeUIDFromHex decode uid from hex
+func DecodeUIDFromHex(s string) (*uuid.UUID, error) {
+	h, err := hex.DecodeString(s)
 	if err != nil {
-		return nil, fmt.Errorf("cannot create gcm from cipher: %w", err)
+		return nil, fmt.Errorf("cannot decode hex string to bytes: %w", err)
+	}
+	return DecodeUID(h)
+}
+
+// encodeSessionAt seals uid followed by its issue time in Unix seconds and session epoch
+func encodeSessionAt(s Session, issuedAt time.Time) ([]byte, error) {
+	payload := make([]byte, uuid.Size+16)
+	copy(payload, s.UID.Bytes())
+	binary.BigEndian.PutUint64(payload[uuid.Size:], uint64(issuedAt.Unix()))
+	binary.BigEndian.PutUint64(payload[uuid.Size+8:], uint64(s.Epoch))
+	return Seal(PurposeUID, payload)
+}
+
+// decodeSession decode session with its issue time, which is zero for uid sealed without it,
+// reporting whether it has been sealed with not active auth secret.
+// Epoch of session sealed without it is zero.
+func decodeSession(ciphertext []byte) (s *Session, issuedAt time.Time, stale bool, err error) {
+	payload, stale, err := openStale(PurposeUID, ciphertext)
+	if err != nil {
+		return nil, issuedAt, false, err
 	}
 
-	nonceSize := gcm.NonceSize()
-	if len(ciphertext) < nonceSize {
-		return nil, errors.New("bad nonce size")
+	var epoch int64
+	switch len(payload) {
+	case uuid.Size:
+	case uuid.Size + 8:
+		issuedAt = time.Unix(int64(binary.BigEndian.Uint64(payload[uuid.Size:])), 0)
+	case uuid.Size + 16:
+		issuedAt = time.Unix(int64(binary.BigEndian.Uint64(payload[uuid.Size:])), 0)
+		epoch = int64(binary.BigEndian.Uint64(payload[uuid.Size+8:]))
+	default:
+		return nil, issuedAt, false, errors.New("cannot decode uid: bad payload size")
 	}
 
-	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
-	rawUID, err := gcm.Open(nil, nonce, ciphertext, nil)
+	u, err := uuid.FromBytes(payload[:uuid.Size])
 	if err != nil {
-		return nil, fmt.Errorf("cannot decode cyphertest: %w", err)
+		return nil, issuedAt, false, fmt.Errorf("cannot decode uid: %w", err)
 	}
+	return &Session{UID: u, Epoch: epoch}, issuedAt, stale, nil
+}
+
+// Codec encodes session to auth token and back
+type Codec interface {
+	Encode(s Session) (token string, err error)
+	// Decode returns session of valid token and whether the token is to be re-issued
+	Decode(token string) (s *Session, refresh bool, err error)
+}
+
+var _ Codec = CookieCodec{}
+
+// CookieCodec encodes session with its issue time as hex of AES-GCM ciphertext
+type CookieCodec struct {
+	// MaxAge limits age of accepted tokens, zero means no limit
+	MaxAge time.Duration
+	// Refresh is age tokens are re-issued at to slide their expiry, zero means never
+	Refresh time.Duration
+	// LegacyUntil is time tokens without issue time are accepted till,
+	// such tokens are accepted and re-issued if it is zero
+	LegacyUntil time.Time
+}
 
-	uid, err := uuid.FromBytes(rawUID)
+// Encode seals session with current time as its issue time
+func (CookieCodec) Encode(s Session) (string, error) {
+	b, err := encodeSessionAt(s, time.Now())
 	if err != nil {
-		return nil, fmt.Errorf("cannot decode uid: %w", err)
+		return "", fmt.Errorf("cannot encode uid: %w", err)
 	}
-	return &uid, nil
+	return hex.EncodeToString(b), nil
 }
 
-// DecodeUIDFromHex decode uid from hex
-func DecodeUIDFromHex(s string) (*uuid.UUID, error) {
-	h, err := hex.DecodeString(s)
+// Decode decodes uid like DecodeUIDFromHex rejecting too old tokens.
+// Tokens without issue time are expired after LegacyUntil if it is set.
+// Tokens sealed with retired secret, old enough or without issue time are to be re-issued.
+func (c CookieCodec) Decode(token string) (*Session, bool, error) {
+	h, err := hex.DecodeString(token)
 	if err != nil {
-		return nil, fmt.Errorf("cannot decode hex string to bytes: %w", err)
+		return nil, false, fmt.Errorf("cannot decode hex string to bytes: %w", err)
 	}
-	return DecodeUID(h)
+	s, issuedAt, stale, err := decodeSession(h)
+	if err != nil {
+		return nil, false, err
+	}
+	// age of tokens issued before issue time was sealed is unknown,
+	// they are re-issued with issue time and can be replayed till LegacyUntil
+	if issuedAt.IsZero() {
+		if !c.LegacyUntil.IsZero() && !time.Now().Before(c.LegacyUntil) {
+			return nil, false, ErrTokenExpired
+		}
+		return s, true, nil
+	}
+
+	age := time.Since(issuedAt)
+	if c.MaxAge > 0 && age > c.MaxAge {
+		return nil, false, ErrTokenExpired
+	}
+	return s, stale || c.Refresh > 0 && age >= c.Refresh, nil
 }
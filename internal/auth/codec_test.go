@@ -1,11 +1,100 @@
 package auth
 
 import (
+	"encoding/binary"
+	"encoding/hex"
 	"testing"
+	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func TestCookieCodec(t *testing.T) {
+	codec := CookieCodec{MaxAge: 30 * 24 * time.Hour, Refresh: 24 * time.Hour}
+	uid := uuid.Must(uuid.NewV4())
+
+	encode := func(age time.Duration) string {
+		b, err := encodeSessionAt(Session{UID: uid}, time.Now().Add(-age))
+		require.NoError(t, err)
+		return hex.EncodeToString(b)
+	}
+
+	tests := []struct {
+		name        string
+		age         time.Duration
+		wantRefresh bool
+		wantErr     bool
+	}{
+		{name: "fresh", age: time.Minute},
+		{name: "slide", age: 25 * time.Hour, wantRefresh: true},
+		{name: "expired", age: 31 * 24 * time.Hour, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, refresh, err := codec.Decode(encode(tt.age))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrTokenExpired)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, &Session{UID: uid}, got)
+			assert.Equal(t, tt.wantRefresh, refresh)
+		})
+	}
+
+	t.Run("epoch", func(t *testing.T) {
+		token, err := codec.Encode(Session{UID: uid, Epoch: 2})
+		require.NoError(t, err)
+		got, _, err := codec.Decode(token)
+		require.NoError(t, err)
+		assert.Equal(t, &Session{UID: uid, Epoch: 2}, got)
+
+		// tokens sealed before epochs were introduced are of epoch zero
+		payload := make([]byte, 8)
+		binary.BigEndian.PutUint64(payload, uint64(time.Now().Unix()))
+		b, err := Seal(PurposeUID, append(uid.Bytes(), payload...))
+		require.NoError(t, err)
+		got, _, err = codec.Decode(hex.EncodeToString(b))
+		require.NoError(t, err)
+		assert.Equal(t, &Session{UID: uid}, got)
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		got, refresh, err := CookieCodec{}.Decode(encode(365 * 24 * time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, &Session{UID: uid}, got)
+		assert.False(t, refresh)
+	})
+
+	t.Run("no_issue_time", func(t *testing.T) {
+		b, err := Seal(PurposeUID, uid.Bytes())
+		require.NoError(t, err)
+		legacy := hex.EncodeToString(b)
+
+		// token without issue time is accepted to be re-issued unless cutoff is set
+		got, refresh, err := codec.Decode(legacy)
+		require.NoError(t, err)
+		assert.Equal(t, &Session{UID: uid}, got)
+		assert.True(t, refresh)
+
+		migrating := codec
+		migrating.LegacyUntil = time.Now().Add(time.Hour)
+		got, refresh, err = migrating.Decode(legacy)
+		require.NoError(t, err)
+		assert.Equal(t, &Session{UID: uid}, got)
+		assert.True(t, refresh)
+
+		// replayed token is expired every time after cutoff
+		migrating.LegacyUntil = time.Now().Add(-time.Hour)
+		for n := 0; n < 2; n++ {
+			_, _, err = migrating.Decode(legacy)
+			assert.ErrorIs(t, err, ErrTokenExpired)
+		}
+	})
+}
+
 func BenchmarkEncodeUID(b *testing.B) {
 	uid := uuid.Must(uuid.NewV4())
 
@@ -22,3 +22,16 @@ func UIDFromContext(ctx context.Context) *uuid.UUID {
 	uid := val.(uuid.UUID)
 	return &uid
 }
+
+var ctxIssuedKey = struct{ name string }{"issued"}
+
+// IssuedContext marks uid in context as just issued rather than presented by client
+func IssuedContext(parent context.Context) context.Context {
+	return context.WithValue(parent, ctxIssuedKey, true)
+}
+
+// IssuedFromContext reports whether uid in context has just been issued
+func IssuedFromContext(ctx context.Context) bool {
+	issued, _ := ctx.Value(ctxIssuedKey).(bool)
+	return issued
+}
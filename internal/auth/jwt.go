@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// supported JWT signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrTokenExpired = errors.New("token expired")
+	// ErrSessionRevoked is returned for tokens of past session epoch of account
+	ErrSessionRevoked = errors.New("session revoked")
+
+	errBadToken     = errors.New("malformed token")
+	errBadSignature = errors.New("bad token signature")
+)
+
+var _ Codec = (*JWTCodec)(nil)
+
+// Claims describes JWT payload
+type Claims struct {
+	Subject  string   `json:"sub"`
+	Issuer   string   `json:"iss,omitempty"`
+	IssuedAt int64    `json:"iat"`
+	Expires  int64    `json:"exp"`
+	Scopes   []string `json:"scopes,omitempty"`
+	// Epoch is session epoch of subject account
+	Epoch int64 `json:"sep,omitempty"`
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+}
+
+// JWTCodec encodes uid as subject of signed JWT
+type JWTCodec struct {
+	alg    string
+	secret []byte
+	key    ed25519.PrivateKey
+	public ed25519.PublicKey
+
+	// ttl is a lifetime of issued tokens
+	ttl time.Duration
+	// refresh is a remaining lifetime tokens are re-issued at
+	refresh time.Duration
+	issuer  string
+	scopes  []string
+	now     func() time.Time
+}
+
+// JWTOption describes optional JWT codec setting
+type JWTOption func(c *JWTCodec)
+
+// WithIssuer sets issuer of tokens, tokens of other issuers are not accepted
+func WithIssuer(issuer string) JWTOption {
+	return func(c *JWTCodec) {
+		c.issuer = issuer
+	}
+}
+
+// WithScopes sets scopes granted by issued tokens
+func WithScopes(scopes ...string) JWTOption {
+	return func(c *JWTCodec) {
+		c.scopes = scopes
+	}
+}
+
+// WithRefresh sets remaining lifetime tokens are re-issued at
+func WithRefresh(refresh time.Duration) JWTOption {
+	return func(c *JWTCodec) {
+		c.refresh = refresh
+	}
+}
+
+// NewHS256Codec creates codec signing tokens with HMAC SHA-256
+func NewHS256Codec(secret []byte, ttl time.Duration, opts ...JWTOption) (*JWTCodec, error) {
+	if len(secret) < sha256.Size {
+		return nil, fmt.Errorf("secret must be at least %d bytes long", sha256.Size)
+	}
+	return newJWTCodec(&JWTCodec{alg: AlgHS256, secret: secret, ttl: ttl}, opts), nil
+}
+
+// NewEdDSACodec creates codec signing tokens with Ed25519 private key
+func NewEdDSACodec(key ed25519.PrivateKey, ttl time.Duration, opts ...JWTOption) (*JWTCodec, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("bad Ed25519 private key size")
+	}
+	public := key.Public().(ed25519.PublicKey)
+	return newJWTCodec(&JWTCodec{alg: AlgEdDSA, key: key, public: public, ttl: ttl}, opts), nil
+}
+
+func newJWTCodec(c *JWTCodec, opts []JWTOption) *JWTCodec {
+	c.now = time.Now
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ParseEd25519Key parses PEM encoded PKCS #8 Ed25519 private key
+func ParseEd25519Key(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse private key: %w", err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%T is not Ed25519 private key", key)
+	}
+	return edKey, nil
+}
+
+// Encode issues token with uid as subject
+func (c *JWTCodec) Encode(s Session) (string, error) {
+	now := c.now()
+	return c.EncodeClaims(Claims{
+		Subject:  s.UID.String(),
+		Issuer:   c.issuer,
+		IssuedAt: now.Unix(),
+		Expires:  now.Add(c.ttl).Unix(),
+		Scopes:   c.scopes,
+		Epoch:    s.Epoch,
+	})
+}
+
+// Decode returns subject of valid token, tokens close to expiry are to be re-issued
+func (c *JWTCodec) Decode(token string) (*Session, bool, error) {
+	claims, err := c.DecodeClaims(token)
+	if err != nil {
+		return nil, false, err
+	}
+	uid, err := uuid.FromString(claims.Subject)
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot decode uid: %w", err)
+	}
+	refresh := time.Unix(claims.Expires, 0).Sub(c.now()) < c.refresh
+	return &Session{UID: uid, Epoch: claims.Epoch}, refresh, nil
+}
+
+// EncodeClaims signs claims as is
+func (c *JWTCodec) EncodeClaims(claims Claims) (string, error) {
+	header, err := json.Marshal(jwtHeader{Algorithm: c.alg, Type: "JWT"})
+	if err != nil {
+		return "", fmt.Errorf("cannot encode token header: %w", err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("cannot encode token claims: %w", err)
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(c.sign([]byte(signed))), nil
+}
+
+// DecodeClaims verifies token signature, expiry and issuer returning its claims
+func (c *JWTCodec) DecodeClaims(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errBadToken
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errBadToken
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, errBadToken
+	}
+	// never let token choose algorithm to verify it with
+	if header.Algorithm != c.alg {
+		return nil, fmt.Errorf("unexpected token algorithm %q", header.Algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errBadToken
+	}
+	if !c.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, errBadSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errBadToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errBadToken
+	}
+
+	if !c.now().Before(time.Unix(claims.Expires, 0)) {
+		return nil, ErrTokenExpired
+	}
+	if claims.Issuer != c.issuer {
+		return nil, fmt.Errorf("unexpected token issuer %q", claims.Issuer)
+	}
+	return &claims, nil
+}
+
+func (c *JWTCodec) sign(data []byte) []byte {
+	if c.alg == AlgEdDSA {
+		return ed25519.Sign(c.key, data)
+	}
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func (c *JWTCodec) verify(data, signature []byte) bool {
+	if c.alg == AlgEdDSA {
+		return ed25519.Verify(c.public, data, signature)
+	}
+	return hmac.Equal(c.sign(data), signature)
+}
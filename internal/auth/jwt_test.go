@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTCodec(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	secret := []byte("ololo-trololo-shimba-boomba-look")
+
+	hs, err := NewHS256Codec(secret, time.Hour, WithIssuer("shortener"), WithScopes("urls:write"))
+	require.NoError(t, err)
+	ed, err := NewEdDSACodec(edKey, time.Hour, WithIssuer("shortener"))
+	require.NoError(t, err)
+
+	_, err = NewHS256Codec([]byte("short"), time.Hour)
+	assert.Error(t, err)
+
+	for name, codec := range map[string]*JWTCodec{"hs256": hs, "eddsa": ed} {
+		t.Run(name, func(t *testing.T) {
+			uid := uuid.Must(uuid.NewV4())
+			token, err := codec.Encode(Session{UID: uid, Epoch: 3})
+			require.NoError(t, err)
+
+			got, refresh, err := codec.Decode(token)
+			require.NoError(t, err)
+			assert.Equal(t, &Session{UID: uid, Epoch: 3}, got)
+			assert.False(t, refresh)
+
+			claims, err := codec.DecodeClaims(token)
+			require.NoError(t, err)
+			assert.Equal(t, uid.String(), claims.Subject)
+			assert.Equal(t, "shortener", claims.Issuer)
+			assert.Equal(t, claims.IssuedAt+3600, claims.Expires)
+
+			parts := strings.Split(token, ".")
+			tampered := parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString([]byte("ololo"))
+			_, _, err = codec.Decode(tampered)
+			assert.Error(t, err)
+
+			// unsigned token must not be accepted
+			none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+			_, _, err = codec.Decode(none + "." + parts[1] + ".")
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("scopes", func(t *testing.T) {
+		token, err := hs.Encode(Session{UID: uuid.Must(uuid.NewV4())})
+		require.NoError(t, err)
+		claims, err := hs.DecodeClaims(token)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"urls:write"}, claims.Scopes)
+	})
+
+	t.Run("other_key", func(t *testing.T) {
+		other, err := NewHS256Codec([]byte("trololo-ololo-boomba-shimba-look"), time.Hour, WithIssuer("shortener"))
+		require.NoError(t, err)
+		token, err := other.Encode(Session{UID: uuid.Must(uuid.NewV4())})
+		require.NoError(t, err)
+		_, _, err = hs.Decode(token)
+		assert.Error(t, err)
+
+		// algorithms are not interchangeable
+		token, err = ed.Encode(Session{UID: uuid.Must(uuid.NewV4())})
+		require.NoError(t, err)
+		_, _, err = hs.Decode(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("other_issuer", func(t *testing.T) {
+		other, err := NewHS256Codec(secret, time.Hour)
+		require.NoError(t, err)
+		token, err := other.Encode(Session{UID: uuid.Must(uuid.NewV4())})
+		require.NoError(t, err)
+		_, _, err = hs.Decode(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		now := time.Now()
+		codec, err := NewHS256Codec(secret, time.Hour, WithRefresh(10*time.Minute))
+		require.NoError(t, err)
+		codec.now = func() time.Time { return now }
+
+		uid := uuid.Must(uuid.NewV4())
+		token, err := codec.Encode(Session{UID: uid})
+		require.NoError(t, err)
+
+		now = now.Add(55 * time.Minute)
+		got, refresh, err := codec.Decode(token)
+		require.NoError(t, err)
+		assert.Equal(t, &Session{UID: uid}, got)
+		assert.True(t, refresh)
+
+		now = now.Add(5 * time.Minute)
+		_, _, err = codec.Decode(token)
+		assert.ErrorIs(t, err, ErrTokenExpired)
+	})
+}
+
+func TestParseEd25519Key(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	got, err := ParseEd25519Key(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+	assert.Equal(t, key, got)
+
+	_, err = ParseEd25519Key([]byte("ololo"))
+	assert.Error(t, err)
+}
+
+func TestTransitionCodec(t *testing.T) {
+	jwt, err := NewHS256Codec([]byte("ololo-trololo-shimba-boomba-look"), time.Hour)
+	require.NoError(t, err)
+	codec := NewTransitionCodec(jwt, CookieCodec{})
+
+	uid := uuid.Must(uuid.NewV4())
+	legacy, err := CookieCodec{}.Encode(Session{UID: uid})
+	require.NoError(t, err)
+
+	// previous format is accepted once to be re-issued
+	got, refresh, err := codec.Decode(legacy)
+	require.NoError(t, err)
+	assert.Equal(t, &Session{UID: uid}, got)
+	assert.True(t, refresh)
+
+	token, err := codec.Encode(Session{UID: uid})
+	require.NoError(t, err)
+	got, refresh, err = codec.Decode(token)
+	require.NoError(t, err)
+	assert.Equal(t, &Session{UID: uid}, got)
+	assert.False(t, refresh)
+
+	_, _, err = codec.Decode("ololo")
+	assert.Error(t, err)
+}
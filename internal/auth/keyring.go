@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/config"
+)
+
+// DefaultKeyID identifies config.AuthSecret in default key ring.
+// Data sealed before key IDs were introduced is opened with key of this ID,
+// so the former secret must be kept in the ring under it or such data can no longer be opened.
+const DefaultKeyID = "default"
+
+// sealedVersion marks data sealed with key ID
+const sealedVersion = 1
+
+const maxKeyID = 255
+
+var errNoKey = errors.New("cannot open sealed data with any accepted key")
+
+// keyRing holds ring set by SetKeyRing
+var keyRing atomic.Value
+
+// KeyRing holds auth secrets by their IDs.
+// Data is sealed with the active key and opened with any key of the ring.
+type KeyRing struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// NewKeyRing creates ring of AES secrets sealing data with active one
+func NewKeyRing(active string, secrets map[string][]byte) (*KeyRing, error) {
+	if _, ok := secrets[active]; !ok {
+		return nil, fmt.Errorf("active key %q not found", active)
+	}
+
+	k := &KeyRing{
+		active: active,
+		keys:   make(map[string]cipher.AEAD, len(secrets)),
+	}
+	for id, secret := range secrets {
+		if id == "" || len(id) > maxKeyID {
+			return nil, fmt.Errorf("key ID must be from 1 to %d bytes long", maxKeyID)
+		}
+		c, err := aes.NewCipher(secret)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create new cipher of key %q: %w", id, err)
+		}
+		gcm, err := cipher.NewGCM(c)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create gcm from cipher: %w", err)
+		}
+		k.keys[id] = gcm
+	}
+	return k, nil
+}
+
+// ParseKeyRing parses keys formatted as "id:hex-secret" separated by commas or new lines.
+// The first key is the active one, other ones are only accepted.
+// Empty lines and lines starting with # are ignored.
+func ParseKeyRing(s string) (*KeyRing, error) {
+	var active string
+	secrets := make(map[string][]byte)
+
+	entries := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '\n'
+	})
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("key %q is not formatted as id:secret", entry)
+		}
+		id := strings.TrimSpace(parts[0])
+		if _, ok := secrets[id]; ok {
+			return nil, fmt.Errorf("duplicate key ID %q", id)
+		}
+		secret, err := hex.DecodeString(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode secret of key %q: %w", id, err)
+		}
+
+		if active == "" {
+			active = id
+		}
+		secrets[id] = secret
+	}
+
+	if len(secrets) == 0 {
+		return nil, errors.New("no keys given")
+	}
+	return NewKeyRing(active, secrets)
+}
+
+// SetKeyRing replaces ring of auth secrets, config.AuthSecret is used while it is nil.
+// config.AuthSecret is public, so production services must set their own ring.
+func SetKeyRing(k *KeyRing) {
+	keyRing.Store(k)
+}
+
+// currentKeyRing returns ring set by SetKeyRing or ring of config.AuthSecret
+func currentKeyRing() (*KeyRing, error) {
+	if k, ok := keyRing.Load().(*KeyRing); ok && k != nil {
+		return k, nil
+	}
+	return NewKeyRing(DefaultKeyID, map[string][]byte{DefaultKeyID: config.AuthSecret})
+}
+
+// seal encrypts data with active key prefixing it with key ID,
+// purpose is authenticated as additional data
+func (k *KeyRing) seal(purpose Purpose, plaintext []byte) ([]byte, error) {
+	gcm := k.keys[k.active]
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("cannot populate nonce: %w", err)
+	}
+
+	sealed := make([]byte, 0, 2+len(k.active)+len(nonce)+len(plaintext)+gcm.Overhead())
+	sealed = append(sealed, sealedVersion, byte(len(k.active)))
+	sealed = append(sealed, k.active...)
+	sealed = append(sealed, nonce...)
+	return gcm.Seal(sealed, nonce, plaintext, purpose.additionalData()), nil
+}
+
+// open decrypts data with key of embedded ID,
+// stale is true if data has to be sealed again with the active key
+func (k *KeyRing) open(purpose Purpose, sealed []byte) (plaintext []byte, stale bool, err error) {
+	if len(sealed) > 2 && sealed[0] == sealedVersion {
+		end := 2 + int(sealed[1])
+		if len(sealed) >= end {
+			id := string(sealed[2:end])
+			if gcm, ok := k.keys[id]; ok {
+				if plaintext, err := openGCM(gcm, sealed[end:], purpose.additionalData()); err == nil {
+					return plaintext, id != k.active, nil
+				}
+			}
+		}
+	}
+
+	// data sealed without key ID
+	if gcm, ok := k.keys[DefaultKeyID]; ok {
+		if plaintext, err := openGCM(gcm, sealed, purpose.additionalData()); err == nil {
+			return plaintext, true, nil
+		}
+	}
+	return nil, false, errNoKey
+}
+
+func openGCM(gcm cipher.AEAD, ciphertext, additionalData []byte) ([]byte, error) {
+	nonceSize := gcm.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, errors.New("bad nonce size")
+	}
+
+	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode cyphertest: %w", err)
+	}
+	return plaintext, nil
+}
+
+// additionalData returns purpose authenticated along with sealed data, nil for PurposeUID
+func (p Purpose) additionalData() []byte {
+	if p == PurposeUID {
+		return nil
+	}
+	return []byte(p)
+}
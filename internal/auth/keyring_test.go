@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-musthave-shortener-trainer/internal/config"
+)
+
+func TestParseKeyRing(t *testing.T) {
+	secret := hex.EncodeToString([]byte("ololo-trololo-shimba-boomba-look"))
+
+	tests := []struct {
+		name       string
+		given      string
+		wantActive string
+		wantKeys   int
+		wantErr    bool
+	}{
+		{name: "single", given: "k1:" + secret, wantActive: "k1", wantKeys: 1},
+		{name: "env", given: "k2:" + secret + ", k1:" + secret, wantActive: "k2", wantKeys: 2},
+		{name: "file", given: "# rotated\nk2:" + secret + "\n\nk1:" + secret + "\n", wantActive: "k2", wantKeys: 2},
+		{name: "empty", given: "# nothing", wantErr: true},
+		{name: "no_id", given: secret, wantErr: true},
+		{name: "empty_id", given: ":" + secret, wantErr: true},
+		{name: "duplicate", given: "k1:" + secret + ",k1:" + secret, wantErr: true},
+		{name: "bad_hex", given: "k1:ololo", wantErr: true},
+		{name: "bad_size", given: "k1:abcd", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseKeyRing(tt.given)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantActive, k.active)
+			assert.Len(t, k.keys, tt.wantKeys)
+		})
+	}
+}
+
+func TestKeyRing(t *testing.T) {
+	defer SetKeyRing(nil)
+
+	newSecret := func() []byte {
+		b := make([]byte, 32)
+		_, err := rand.Read(b)
+		require.NoError(t, err)
+		return b
+	}
+	old, current := newSecret(), newSecret()
+	uid := uuid.Must(uuid.NewV4())
+
+	oldRing, err := NewKeyRing("k1", map[string][]byte{"k1": old})
+	require.NoError(t, err)
+	rotated, err := NewKeyRing("k2", map[string][]byte{"k1": old, "k2": current})
+	require.NoError(t, err)
+	retired, err := NewKeyRing("k2", map[string][]byte{"k2": current})
+	require.NoError(t, err)
+
+	SetKeyRing(oldRing)
+	token, err := CookieCodec{}.Encode(Session{UID: uid})
+	require.NoError(t, err)
+
+	// cookies of accepted key are re-issued with the active one
+	SetKeyRing(rotated)
+	got, refresh, err := CookieCodec{}.Decode(token)
+	require.NoError(t, err)
+	assert.Equal(t, &Session{UID: uid}, got)
+	assert.True(t, refresh)
+
+	token, err = CookieCodec{}.Encode(Session{UID: uid})
+	require.NoError(t, err)
+	got, refresh, err = CookieCodec{}.Decode(token)
+	require.NoError(t, err)
+	assert.Equal(t, &Session{UID: uid}, got)
+	assert.False(t, refresh)
+
+	SetKeyRing(oldRing)
+	_, _, err = CookieCodec{}.Decode(token)
+	assert.Error(t, err)
+
+	SetKeyRing(retired)
+	_, err = DecodeUIDFromHex(token)
+	assert.NoError(t, err)
+}
+
+func TestKeyRing_legacy(t *testing.T) {
+	defer SetKeyRing(nil)
+	uid := uuid.Must(uuid.NewV4())
+
+	// seal the way it was done before key IDs
+	c, err := aes.NewCipher(config.AuthSecret)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(c)
+	require.NoError(t, err)
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	require.NoError(t, err)
+	legacy := hex.EncodeToString(gcm.Seal(nonce, nonce, uid.Bytes(), nil))
+
+	got, refresh, err := CookieCodec{}.Decode(legacy)
+	require.NoError(t, err)
+	assert.Equal(t, &Session{UID: uid}, got)
+	assert.True(t, refresh)
+
+	ring, err := NewKeyRing("k1", map[string][]byte{"k1": []byte("trololo-ololo-boomba-shimba-look")})
+	require.NoError(t, err)
+	SetKeyRing(ring)
+	_, _, err = CookieCodec{}.Decode(legacy)
+	assert.Error(t, err)
+}
@@ -0,0 +1,34 @@
+package auth
+
+var _ Codec = (*TransitionCodec)(nil)
+
+// TransitionCodec issues tokens of current codec and still accepts tokens of previous ones,
+// which are re-issued by current codec
+type TransitionCodec struct {
+	current  Codec
+	previous []Codec
+}
+
+// NewTransitionCodec creates codec switching from previous codecs to current one
+func NewTransitionCodec(current Codec, previous ...Codec) *TransitionCodec {
+	return &TransitionCodec{current: current, previous: previous}
+}
+
+// Encode encodes session with current codec
+func (c *TransitionCodec) Encode(s Session) (string, error) {
+	return c.current.Encode(s)
+}
+
+// Decode tries current codec first and then previous ones in order
+func (c *TransitionCodec) Decode(token string) (*Session, bool, error) {
+	s, refresh, err := c.current.Decode(token)
+	if err == nil {
+		return s, refresh, nil
+	}
+	for _, codec := range c.previous {
+		if s, _, prevErr := codec.Decode(token); prevErr == nil {
+			return s, true, nil
+		}
+	}
+	return nil, false, err
+}
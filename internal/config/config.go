@@ -4,15 +4,74 @@ package config
 import (
 	"flag"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
 	RunPort     = ":8080"
 	BaseURL     = "http://localhost:8080/"
 	PersistFile = ""
+	// AuthSecret seals auth cookies unless AuthKeys or AuthKeysFile are given.
+	// It is public, so it is refused when serving HTTPS; keep it in the ring under ID "default" to keep issued cookies valid.
 	AuthSecret  = []byte("ololo-trololo-shimba-boomba-look")
 	DatabaseDSN = ""
+	MirrorDSN   = ""
+	MirrorLog   = ""
+	// MirrorStatsInterval is interval mirror counters are logged at, never if zero
+	MirrorStatsInterval = time.Minute
+	AuditDSN            = ""
+	// ComingSoonPage is HTML template served for not yet active URLs instead of 404 body
+	ComingSoonPage = ""
+	// QRLevel is default QR code error correction level: L, M, Q or H
+	QRLevel = "M"
+	// QRMargin is default width of quiet zone around QR code in modules
+	QRMargin = 4
+	// PreviewTitles enables fetching destination page titles shown on preview page
+	PreviewTitles = false
+	// BlocklistFile lists domains denied to be shortened, reloaded on SIGHUP
+	BlocklistFile = ""
+	// AdminToken grants access to admin endpoints, they are disabled if empty
+	AdminToken = ""
+	// RateShorten, RateBatch, RateRedirect, RateReport, RateEdit and RateAccount
+	// limit requests per client like "100/m", unlimited if empty
+	RateShorten  = "100/m"
+	RateBatch    = "10/m"
+	RateRedirect = ""
+	RateReport   = ""
+	RateEdit     = ""
+	RateAccount  = ""
+	// TrustedProxies lists comma separated IPs and CIDRs of proxies whose forwarding headers tell client address
+	TrustedProxies = ""
+	// QuotaActive and QuotaDaily limit URLs owned by every user and created by them per day, unlimited if zero
+	QuotaActive = 0
+	QuotaDaily  = 0
+	// AuthKeys and AuthKeysFile list auth secrets formatted as id:hex-secret, the first one seals new data
+	AuthKeys     = ""
+	AuthKeysFile = ""
+	// SessionMaxAge limits age of auth cookies, cookies older than SessionRefresh are re-issued on activity
+	SessionMaxAge  = 30 * 24 * time.Hour
+	SessionRefresh = 24 * time.Hour
+	// LegacySessionsUntil is RFC 3339 time auth cookies without issue time are accepted till, always if empty
+	LegacySessionsUntil = ""
+	// CookieSameSite is SameSite attribute of auth cookie: lax, strict or none
+	CookieSameSite = "lax"
+	// TLSCertFile and TLSKeyFile enable HTTPS when both given
+	TLSCertFile = ""
+	TLSKeyFile  = ""
+	// AuthToken is format of issued auth tokens: cookie or jwt, tokens of both formats are accepted
+	AuthToken = "cookie"
+	// JWTAlgorithm signs JWT auth tokens: HS256 with JWTSecret or EdDSA with key of JWTKeyFile
+	JWTAlgorithm = "HS256"
+	JWTSecret    = ""
+	JWTKeyFile   = ""
+	JWTIssuer    = ""
+	// JWTScopes are comma separated scopes granted by issued JWT
+	JWTScopes = ""
+	// JWTTTL is a lifetime of JWT, tokens having less than JWTRefresh left are re-issued
+	JWTTTL     = 30 * 24 * time.Hour
+	JWTRefresh = 7 * 24 * time.Hour
 )
 
 // Parse reads the configuration from the command line flags, environment variables and a configuration file (with priority)
@@ -21,6 +80,49 @@ func Parse() {
 	flag.StringVar(&BaseURL, "b", BaseURL, "base URL for shorten URL response")
 	flag.StringVar(&PersistFile, "f", PersistFile, "file to store shorten URLs")
 	flag.StringVar(&DatabaseDSN, "d", DatabaseDSN, "connection string to database")
+	flag.StringVar(&MirrorDSN, "mirror-dsn", MirrorDSN, "URI of secondary store to mirror writes to (file:///path or postgres://...)")
+	flag.StringVar(&MirrorLog, "mirror-log", MirrorLog, "file to log mirror mismatches to, stderr if empty")
+	flag.DurationVar(&MirrorStatsInterval, "mirror-stats-interval", MirrorStatsInterval, "interval mirror counters are logged at, never if zero")
+	flag.StringVar(&AuditDSN, "audit-dsn", AuditDSN, "audit log location (memory://, file:///path or database connection string), database from -d if empty")
+
+	flag.StringVar(&ComingSoonPage, "coming-soon-page", ComingSoonPage, "HTML template file served for not yet active URLs")
+
+	flag.StringVar(&QRLevel, "qr-level", QRLevel, "default QR code error correction level: L, M, Q or H")
+	flag.IntVar(&QRMargin, "qr-margin", QRMargin, "default QR code margin in modules")
+
+	flag.BoolVar(&PreviewTitles, "preview-titles", PreviewTitles, "fetch destination page titles from public addresses to show on preview page")
+
+	flag.StringVar(&BlocklistFile, "blocklist", BlocklistFile, "file of domains and patterns denied to be shortened, reloaded on SIGHUP")
+
+	flag.StringVar(&AdminToken, "admin-token", AdminToken, "token granting access to admin endpoints via X-Admin-Token header")
+
+	flag.StringVar(&RateShorten, "rate-shorten", RateShorten, "shorten requests limit per client like 100/m, unlimited if empty")
+	flag.StringVar(&RateBatch, "rate-batch", RateBatch, "batch shorten and import requests limit per client like 10/m, unlimited if empty")
+	flag.StringVar(&RateRedirect, "rate-redirect", RateRedirect, "redirect requests limit per client like 50/s, unlimited if empty")
+	flag.StringVar(&RateReport, "rate-report", RateReport, "abuse report requests limit per client like 10/h, unlimited if empty")
+	flag.StringVar(&RateEdit, "rate-edit", RateEdit, "URL edit and transfer requests limit per client like 30/m, unlimited if empty")
+	flag.StringVar(&RateAccount, "rate-account", RateAccount, "sign up, sign in, password and API key requests limit per client like 10/m, unlimited if empty")
+	flag.StringVar(&TrustedProxies, "trusted-proxies", TrustedProxies, "comma separated IPs and CIDRs of proxies trusted to set X-Forwarded-For and X-Real-IP")
+
+	flag.IntVar(&QuotaActive, "quota-active", QuotaActive, "maximum number of not deleted URLs per user, unlimited if zero")
+	flag.IntVar(&QuotaDaily, "quota-daily", QuotaDaily, "maximum number of URLs created per user per UTC day, unlimited if zero")
+
+	flag.StringVar(&AuthKeys, "auth-keys", AuthKeys, "comma separated auth secrets formatted as id:hex-secret, the first one is active")
+	flag.StringVar(&AuthKeysFile, "auth-keys-file", AuthKeysFile, "file of auth secrets formatted as id:hex-secret per line, the first one is active")
+	flag.DurationVar(&SessionMaxAge, "session-max-age", SessionMaxAge, "maximum age of auth cookie, unlimited if zero")
+	flag.DurationVar(&SessionRefresh, "session-refresh", SessionRefresh, "age auth cookie is re-issued at on activity, never if zero")
+	flag.StringVar(&LegacySessionsUntil, "legacy-sessions-until", LegacySessionsUntil, "RFC 3339 time auth cookies without issue time are accepted till, always if empty")
+	flag.StringVar(&CookieSameSite, "cookie-samesite", CookieSameSite, "SameSite attribute of auth cookie: lax, strict or none")
+	flag.StringVar(&TLSCertFile, "tls-cert", TLSCertFile, "TLS certificate file to serve HTTPS with")
+	flag.StringVar(&TLSKeyFile, "tls-key", TLSKeyFile, "TLS private key file to serve HTTPS with")
+	flag.StringVar(&AuthToken, "auth-token", AuthToken, "format of issued auth tokens: cookie or jwt")
+	flag.StringVar(&JWTAlgorithm, "jwt-alg", JWTAlgorithm, "JWT signing algorithm: HS256 or EdDSA")
+	flag.StringVar(&JWTSecret, "jwt-secret", JWTSecret, "HS256 JWT secret of at least 32 bytes")
+	flag.StringVar(&JWTKeyFile, "jwt-key", JWTKeyFile, "PEM file of PKCS #8 Ed25519 private key signing EdDSA JWT")
+	flag.StringVar(&JWTIssuer, "jwt-issuer", JWTIssuer, "issuer of JWT")
+	flag.StringVar(&JWTScopes, "jwt-scopes", JWTScopes, "comma separated scopes granted by issued JWT")
+	flag.DurationVar(&JWTTTL, "jwt-ttl", JWTTTL, "lifetime of issued JWT")
+	flag.DurationVar(&JWTRefresh, "jwt-refresh", JWTRefresh, "remaining lifetime JWT is re-issued at")
 
 	flag.Parse()
 
@@ -36,6 +138,115 @@ func Parse() {
 	if val := os.Getenv("DATABASE_DSN"); val != "" {
 		DatabaseDSN = val
 	}
+	if val := os.Getenv("MIRROR_DSN"); val != "" {
+		MirrorDSN = val
+	}
+	if val := os.Getenv("MIRROR_LOG"); val != "" {
+		MirrorLog = val
+	}
+	if val, err := time.ParseDuration(os.Getenv("MIRROR_STATS_INTERVAL")); err == nil {
+		MirrorStatsInterval = val
+	}
+	if val := os.Getenv("AUDIT_DSN"); val != "" {
+		AuditDSN = val
+	}
+	if val := os.Getenv("COMING_SOON_PAGE"); val != "" {
+		ComingSoonPage = val
+	}
+
+	if val := os.Getenv("BLOCKLIST_FILE"); val != "" {
+		BlocklistFile = val
+	}
+	if val := os.Getenv("ADMIN_TOKEN"); val != "" {
+		AdminToken = val
+	}
+	if val := os.Getenv("RATE_SHORTEN"); val != "" {
+		RateShorten = val
+	}
+	if val := os.Getenv("RATE_BATCH"); val != "" {
+		RateBatch = val
+	}
+	if val := os.Getenv("RATE_REDIRECT"); val != "" {
+		RateRedirect = val
+	}
+	if val := os.Getenv("RATE_REPORT"); val != "" {
+		RateReport = val
+	}
+	if val := os.Getenv("RATE_EDIT"); val != "" {
+		RateEdit = val
+	}
+	if val := os.Getenv("RATE_ACCOUNT"); val != "" {
+		RateAccount = val
+	}
+	if val := os.Getenv("TRUSTED_PROXIES"); val != "" {
+		TrustedProxies = val
+	}
+	if val := os.Getenv("QR_LEVEL"); val != "" {
+		QRLevel = val
+	}
+	if val, err := strconv.Atoi(os.Getenv("QR_MARGIN")); err == nil {
+		QRMargin = val
+	}
+
+	if val, err := strconv.ParseBool(os.Getenv("PREVIEW_TITLES")); err == nil {
+		PreviewTitles = val
+	}
+
+	if val, err := strconv.Atoi(os.Getenv("QUOTA_ACTIVE")); err == nil {
+		QuotaActive = val
+	}
+	if val, err := strconv.Atoi(os.Getenv("QUOTA_DAILY")); err == nil {
+		QuotaDaily = val
+	}
+
+	if val := os.Getenv("AUTH_KEYS"); val != "" {
+		AuthKeys = val
+	}
+	if val := os.Getenv("AUTH_KEYS_FILE"); val != "" {
+		AuthKeysFile = val
+	}
+	if val, err := time.ParseDuration(os.Getenv("SESSION_MAX_AGE")); err == nil {
+		SessionMaxAge = val
+	}
+	if val, err := time.ParseDuration(os.Getenv("SESSION_REFRESH")); err == nil {
+		SessionRefresh = val
+	}
+	if val := os.Getenv("LEGACY_SESSIONS_UNTIL"); val != "" {
+		LegacySessionsUntil = val
+	}
+	if val := os.Getenv("COOKIE_SAMESITE"); val != "" {
+		CookieSameSite = val
+	}
+	if val := os.Getenv("TLS_CERT_FILE"); val != "" {
+		TLSCertFile = val
+	}
+	if val := os.Getenv("TLS_KEY_FILE"); val != "" {
+		TLSKeyFile = val
+	}
+	if val := os.Getenv("AUTH_TOKEN"); val != "" {
+		AuthToken = val
+	}
+	if val := os.Getenv("JWT_ALG"); val != "" {
+		JWTAlgorithm = val
+	}
+	if val := os.Getenv("JWT_SECRET"); val != "" {
+		JWTSecret = val
+	}
+	if val := os.Getenv("JWT_KEY_FILE"); val != "" {
+		JWTKeyFile = val
+	}
+	if val := os.Getenv("JWT_ISSUER"); val != "" {
+		JWTIssuer = val
+	}
+	if val := os.Getenv("JWT_SCOPES"); val != "" {
+		JWTScopes = val
+	}
+	if val, err := time.ParseDuration(os.Getenv("JWT_TTL")); err == nil {
+		JWTTTL = val
+	}
+	if val, err := time.ParseDuration(os.Getenv("JWT_REFRESH")); err == nil {
+		JWTRefresh = val
+	}
 
 	BaseURL = strings.TrimRight(BaseURL, "/")
 }
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// maxURLReports caps number of reports stored per URL, further ones add nothing for moderators
+const maxURLReports = 100
+
+// Takedown describes URL disabled by administrator regardless of its owner
+type Takedown struct {
+	Reason string
+	// Legal takedowns are answered with 451, other ones with 410
+	Legal      bool
+	DisabledAt time.Time
+}
+
+// Report describes visitor complaint about URL
+type Report struct {
+	// ID is an ID of reported URL
+	ID        string
+	Reason    string
+	ClientIP  string
+	CreatedAt time.Time
+}
+
+// AbuseStore interface
+type AbuseStore interface {
+	// SaveReport stores complaint about existing URL. Every client reports URL once
+	// and URL keeps at most maxURLReports reports, ErrConflict is returned for further ones.
+	SaveReport(ctx context.Context, report Report) error
+	// LoadReports returns reports in order of their creation, only reports of URL with given ID if not empty
+	LoadReports(ctx context.Context, id string) (reports []Report, err error)
+	// Disable takes URL down keeping it stored, disabled URL is loaded with its takedown
+	Disable(ctx context.Context, id string, takedown Takedown) error
+	// Enable brings disabled URL back
+	Enable(ctx context.Context, id string) error
+}
+
+// acceptReport reports whether report may be added to stored ones
+// as client has not reported URL yet and URL has not got too many reports
+func acceptReport(reports []Report, report Report) bool {
+	n := 0
+	for _, r := range reports {
+		if r.ID != report.ID {
+			continue
+		}
+		if report.ClientIP != "" && r.ClientIP == report.ClientIP {
+			return false
+		}
+		n++
+	}
+	return n < maxURLReports
+}
+
+// filterReports returns reports of URL with given ID, all reports if it is empty
+func filterReports(reports []Report, id string) []Report {
+	res := make([]Report, 0, len(reports))
+	for _, report := range reports {
+		if id == "" || report.ID == id {
+			res = append(res, report)
+		}
+	}
+	return res
+}
+
+// replaceReports replaces reports of URL with given ID keeping order of other ones
+func replaceReports(reports []Report, id string, with []Report) []Report {
+	res := make([]Report, 0, len(reports)+len(with))
+	for _, report := range reports {
+		if report.ID != id {
+			res = append(res, report)
+		}
+	}
+	for _, report := range with {
+		report.ID = id
+		res = append(res, report)
+	}
+	return res
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisable(t *testing.T) {
+	ctx := context.Background()
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+	path := filepath.Join(t.TempDir(), "store.gob")
+	takedown := Takedown{Reason: "phishing", Legal: true, DisabledAt: time.Now().UTC().Truncate(time.Second)}
+
+	fileStore, err := NewFileStore(path)
+	require.NoError(t, err)
+
+	stores := map[string]AuthStore{
+		"memory": NewInMemory(),
+		"file":   fileStore,
+	}
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			id, err := s.Save(ctx, u)
+			require.NoError(t, err)
+			other, err := s.Save(ctx, u)
+			require.NoError(t, err)
+
+			require.NoError(t, s.SaveReport(ctx, Report{ID: id, Reason: "phishing", ClientIP: "127.0.0.1"}))
+			require.NoError(t, s.SaveReport(ctx, Report{ID: other, Reason: "spam"}))
+			assert.ErrorIs(t, s.SaveReport(ctx, Report{ID: "ololo", Reason: "spam"}), ErrNotFound)
+			// every client reports URL once
+			assert.ErrorIs(t, s.SaveReport(ctx, Report{ID: id, Reason: "spam", ClientIP: "127.0.0.1"}), ErrConflict)
+
+			reports, err := s.LoadReports(ctx, "")
+			require.NoError(t, err)
+			assert.Len(t, reports, 2)
+			reports, err = s.LoadReports(ctx, id)
+			require.NoError(t, err)
+			require.Len(t, reports, 1)
+			assert.Equal(t, "phishing", reports[0].Reason)
+
+			require.NoError(t, s.Disable(ctx, id, takedown))
+			assert.ErrorIs(t, s.Disable(ctx, "ololo", takedown), ErrNotFound)
+
+			rec, err := s.LoadRecord(ctx, id)
+			require.NoError(t, err)
+			require.NotNil(t, rec.Disabled)
+			assert.Equal(t, takedown, *rec.Disabled)
+
+			rec, err = s.LoadRecord(ctx, other)
+			require.NoError(t, err)
+			assert.Nil(t, rec.Disabled)
+
+			// takedown is copied with records
+			copied := NewInMemory()
+			require.NoError(t, s.Records(ctx, func(rec Record) error {
+				return copied.Restore(ctx, rec)
+			}))
+			rec, err = copied.LoadRecord(ctx, id)
+			require.NoError(t, err)
+			assert.Equal(t, &takedown, rec.Disabled)
+		})
+	}
+
+	t.Run("file_reopen", func(t *testing.T) {
+		require.NoError(t, fileStore.Close())
+		reopened, err := NewFileStore(path)
+		require.NoError(t, err)
+		defer reopened.Close()
+
+		rec, err := reopened.LoadRecord(ctx, "0")
+		require.NoError(t, err)
+		assert.Equal(t, &takedown, rec.Disabled)
+
+		reports, err := reopened.LoadReports(ctx, "")
+		require.NoError(t, err)
+		assert.Len(t, reports, 2)
+
+		require.NoError(t, reopened.Enable(ctx, "0"))
+		rec, err = reopened.LoadRecord(ctx, "0")
+		require.NoError(t, err)
+		assert.Nil(t, rec.Disabled)
+	})
+}
+
+func TestAcceptReport(t *testing.T) {
+	var reports []Report
+	for n := 0; n < maxURLReports; n++ {
+		report := Report{ID: "0", ClientIP: fmt.Sprintf("10.0.0.%d", n)}
+		require.True(t, acceptReport(reports, report))
+		reports = append(reports, report)
+	}
+
+	assert.False(t, acceptReport(reports, Report{ID: "0", ClientIP: "192.168.0.1"}))
+	assert.True(t, acceptReport(reports, Report{ID: "1", ClientIP: "10.0.0.1"}))
+}
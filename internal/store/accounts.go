@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Account describes registered user signing in by email and password
+type Account struct {
+	// UserID is uid owning links of account
+	UserID uuid.UUID
+	// Email is unique in lower case
+	Email        string
+	PasswordHash string
+	CreatedAt    time.Time
+	// SessionEpoch is incremented to revoke auth tokens issued before
+	SessionEpoch int64
+}
+
+// AccountStore interface
+type AccountStore interface {
+	// SaveAccount stores new account, ErrConflict is returned if its email or uid is taken
+	SaveAccount(ctx context.Context, account Account) error
+	// LoadAccount returns account by email
+	LoadAccount(ctx context.Context, email string) (account Account, err error)
+	// LoadUserAccount returns account of uid
+	LoadUserAccount(ctx context.Context, uid uuid.UUID) (account Account, err error)
+	// SetPassword replaces password hash of account of uid revoking its sessions
+	SetPassword(ctx context.Context, uid uuid.UUID, passwordHash string) error
+	// RevokeSessions increments session epoch of account of uid
+	RevokeSessions(ctx context.Context, uid uuid.UUID) error
+}
+
+// indexAccounts returns emails of accounts by their uids
+func indexAccounts(accounts map[string]Account) map[string]string {
+	emails := make(map[string]string, len(accounts))
+	for email, account := range accounts {
+		emails[account.UserID.String()] = email
+	}
+	return emails
+}
+
+// accountOf returns account of uid from accounts by email indexed by emails
+func accountOf(accounts map[string]Account, emails map[string]string, uid uuid.UUID) (Account, bool) {
+	email, ok := emails[uid.String()]
+	if !ok {
+		return Account{}, false
+	}
+	account, ok := accounts[email]
+	return account, ok
+}
+
+// putAccount stores account replacing other account of its uid or email
+func putAccount(accounts map[string]Account, emails map[string]string, account Account) {
+	removeAccount(accounts, emails, account.UserID)
+	if other, ok := accounts[account.Email]; ok {
+		delete(emails, other.UserID.String())
+	}
+	accounts[account.Email] = account
+	emails[account.UserID.String()] = account.Email
+}
+
+// removeAccount deletes account of uid
+func removeAccount(accounts map[string]Account, emails map[string]string, uid uuid.UUID) {
+	if email, ok := emails[uid.String()]; ok {
+		delete(accounts, email)
+		delete(emails, uid.String())
+	}
+}
+
+// updateAccount applies update to account of uid, its email must be kept
+func updateAccount(accounts map[string]Account, emails map[string]string, uid uuid.UUID, update func(account *Account)) error {
+	account, ok := accountOf(accounts, emails, uid)
+	if !ok {
+		return ErrNotFound
+	}
+	update(&account)
+	accounts[account.Email] = account
+	return nil
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccounts(t *testing.T) {
+	ctx := context.Background()
+	uid := uuid.Must(uuid.NewV4())
+
+	fileStore, err := NewFileStore(filepath.Join(t.TempDir(), "store.gob"))
+	require.NoError(t, err)
+
+	stores := map[string]AuthStore{
+		"memory": NewInMemory(),
+		"file":   fileStore,
+	}
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.LoadAccount(ctx, "user@example.com")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			account := Account{UserID: uid, Email: "user@example.com", PasswordHash: "hash", CreatedAt: time.Now().UTC()}
+			require.NoError(t, s.SaveAccount(ctx, account))
+
+			// email and user are both unique
+			err = s.SaveAccount(ctx, Account{UserID: uuid.Must(uuid.NewV4()), Email: "user@example.com"})
+			assert.ErrorIs(t, err, ErrConflict)
+			err = s.SaveAccount(ctx, Account{UserID: uid, Email: "other@example.com"})
+			assert.ErrorIs(t, err, ErrConflict)
+
+			got, err := s.LoadAccount(ctx, "user@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, uid, got.UserID)
+
+			require.NoError(t, s.SetPassword(ctx, uid, "new"))
+			got, err = s.LoadUserAccount(ctx, uid)
+			require.NoError(t, err)
+			assert.Equal(t, "new", got.PasswordHash)
+			assert.Equal(t, int64(1), got.SessionEpoch)
+
+			require.NoError(t, s.RevokeSessions(ctx, uid))
+			got, err = s.LoadAccount(ctx, "user@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), got.SessionEpoch)
+			assert.ErrorIs(t, s.RevokeSessions(ctx, uuid.Must(uuid.NewV4())), ErrNotFound)
+
+			assert.ErrorIs(t, s.SetPassword(ctx, uuid.Must(uuid.NewV4()), "new"), ErrNotFound)
+		})
+	}
+}
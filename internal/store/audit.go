@@ -0,0 +1,257 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// audited actions
+const (
+	AuditShorten      = "shorten"
+	AuditBatchShorten = "batch_shorten"
+	AuditDelete       = "delete"
+	AuditEdit         = "edit"
+	AuditRestore      = "restore"
+	AuditTransfer     = "transfer"
+	AuditRules        = "rules"
+	AuditVariants     = "variants"
+	AuditDisable      = "disable"
+	AuditEnable       = "enable"
+	AuditRedirect     = "redirect"
+	AuditSettings     = "settings"
+	AuditKeyCreate    = "key_create"
+	AuditKeyRevoke    = "key_revoke"
+)
+
+var _ AuditSink = (*MemoryAudit)(nil)
+var _ AuditSink = (*FileAudit)(nil)
+var _ AuditSink = (*RDBAudit)(nil)
+
+// AuditEntry describes single state-changing operation
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// UserID is nil for anonymous operations
+	UserID    *uuid.UUID `json:"uid,omitempty"`
+	RequestID string     `json:"request_id,omitempty"`
+	ClientIP  string     `json:"client_ip,omitempty"`
+	Action    string     `json:"action"`
+	ShortID   string     `json:"short_id"`
+	Before    string     `json:"before,omitempty"`
+	After     string     `json:"after,omitempty"`
+}
+
+// AuditSink interface
+type AuditSink interface {
+	io.Closer
+
+	WriteAudit(ctx context.Context, entries ...AuditEntry) error
+	// LoadUserAudit returns user entries in order of their creation
+	LoadUserAudit(ctx context.Context, uid uuid.UUID) (entries []AuditEntry, err error)
+}
+
+// MemoryAudit describe in-memory audit sink
+type MemoryAudit struct {
+	entries []AuditEntry
+	mutex   sync.RWMutex
+}
+
+// NewMemoryAudit create new MemoryAudit instance
+func NewMemoryAudit() *MemoryAudit {
+	return &MemoryAudit{}
+}
+
+// WriteAudit stores entries in memory
+func (m *MemoryAudit) WriteAudit(_ context.Context, entries ...AuditEntry) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.entries = append(m.entries, entries...)
+	return nil
+}
+
+// LoadUserAudit returns user entries from memory
+func (m *MemoryAudit) LoadUserAudit(_ context.Context, uid uuid.UUID) (entries []AuditEntry, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, e := range m.entries {
+		if e.UserID != nil && *e.UserID == uid {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// Close return nil
+func (m *MemoryAudit) Close() error {
+	return nil
+}
+
+// FileAudit describe audit sink appending JSON lines to file
+type FileAudit struct {
+	persist *os.File
+	mutex   sync.Mutex
+}
+
+// NewFileAudit create new FileAudit instance
+func NewFileAudit(filepath string) (*FileAudit, error) {
+	fd, err := os.OpenFile(filepath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file at path %s: %w", filepath, err)
+	}
+	return &FileAudit{persist: fd}, nil
+}
+
+// WriteAudit appends entries to file
+func (f *FileAudit) WriteAudit(_ context.Context, entries ...AuditEntry) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	enc := json.NewEncoder(f.persist)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("cannot write audit entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// LoadUserAudit scans file for user entries
+func (f *FileAudit) LoadUserAudit(_ context.Context, uid uuid.UUID) (entries []AuditEntry, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	fd, err := os.Open(f.persist.Name())
+	if err != nil {
+		return nil, fmt.Errorf("cannot open audit file: %w", err)
+	}
+	defer fd.Close()
+
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("cannot decode audit entry: %w", err)
+		}
+		if e.UserID != nil && *e.UserID == uid {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read audit file: %w", err)
+	}
+	return entries, nil
+}
+
+// Close file closing
+func (f *FileAudit) Close() error {
+	return f.persist.Close()
+}
+
+// RDBAudit describe audit sink storing entries in DB
+type RDBAudit struct {
+	db *sql.DB
+}
+
+// NewRDBAudit return new RDBAudit instance
+func NewRDBAudit(db *sql.DB) *RDBAudit {
+	return &RDBAudit{
+		db: db,
+	}
+}
+
+// Bootstrap creates audit table
+func (r *RDBAudit) Bootstrap(ctx context.Context) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id bigserial PRIMARY KEY,
+			created_at timestamp with time zone NOT NULL,
+			user_id uuid,
+			request_id text,
+			client_ip text,
+			action text NOT NULL,
+			short_id text NOT NULL,
+			before_value text,
+			after_value text
+		);
+
+		CREATE INDEX IF NOT EXISTS audit_log_user_id_idx ON audit_log (user_id, id);
+	`
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("cannot create `audit_log` table: %w", err)
+	}
+	return nil
+}
+
+// WriteAudit inserts entries to DB
+func (r *RDBAudit) WriteAudit(ctx context.Context, entries ...AuditEntry) error {
+	query := `
+		INSERT INTO audit_log
+			(created_at, user_id, request_id, client_ip, action, short_id, before_value, after_value)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, e := range entries {
+		_, err := tx.ExecContext(ctx, query,
+			e.Time, e.UserID, e.RequestID, e.ClientIP, e.Action, e.ShortID, e.Before, e.After)
+		if err != nil {
+			return fmt.Errorf("cannot insert audit entry: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	return nil
+}
+
+// LoadUserAudit returns user entries from DB
+func (r *RDBAudit) LoadUserAudit(ctx context.Context, uid uuid.UUID) (entries []AuditEntry, err error) {
+	query := `
+		SELECT created_at, request_id, client_ip, action, short_id, before_value, after_value
+		FROM audit_log
+		WHERE user_id = $1
+		ORDER BY id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query rows: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e := AuditEntry{UserID: &uid}
+		err := rows.Scan(&e.Time, &e.RequestID, &e.ClientIP, &e.Action, &e.ShortID, &e.Before, &e.After)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan row: %w", err)
+		}
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return entries, nil
+}
+
+// Close end db connection
+func (r *RDBAudit) Close() error {
+	return r.db.Close()
+}
@@ -8,4 +8,8 @@ import (
 var (
 	ErrNotFound = errors.New("not found")
 	ErrConflict = errors.New("conflict")
+	// ErrExhausted means URL click limit has been reached
+	ErrExhausted = errors.New("clicks exhausted")
+	// ErrReadOnly is returned on writes to store opened read-only
+	ErrReadOnly = errors.New("store is read-only")
 )
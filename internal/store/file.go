@@ -5,8 +5,12 @@ import (
 	"encoding/gob"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/gofrs/uuid"
 )
@@ -21,20 +25,64 @@ var _ AuthStore = (*FileStore)(nil)
 type gobStore struct {
 	Hot     map[string]*url.URL
 	UserHot map[string]map[string]*url.URL
+	// Deleted holds owners of deleted URLs in file as gob cannot encode nil map values
+	Deleted map[string]string
+	History map[string][]Version
+	Options map[string]Options
+	Clicks  map[string]int
+	// Variants holds follow counts by variant position
+	Variants map[string]map[int]int
+	Settings map[string]UserSettings
+	Created  map[string]time.Time
+	Disabled map[string]Takedown
+	Reports  []Report
+	Keys     map[string]APIKey
+	Accounts map[string]Account
+	// Transfers holds transfer offers by their IDs
+	Transfers map[string]Transfer
 }
 
 // FileStore describe file store instance
 type FileStore struct {
-	store   *gobStore
-	enc     *gob.Encoder
-	persist *os.File
+	store *gobStore
+	path  string
+	// mode is permissions of file kept on its every rewrite
+	mode     os.FileMode
+	readOnly bool
+	closed   bool
+	// countersChanged is set when click counters changed since the last flush
+	countersChanged bool
+	done            chan struct{}
+	// accountEmails indexes account email of every uid having account
+	accountEmails map[string]string
+	mutex         sync.RWMutex
 }
 
 // NewFileStore create new NewFileStore instance
-func NewFileStore(filepath string) (*FileStore, error) {
-	fd, err := os.OpenFile(filepath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+func NewFileStore(path string) (*FileStore, error) {
+	return openFileStore(path, false)
+}
+
+// OpenFileStoreReadOnly opens existing file store refusing writes,
+// it fails if file is missing or cannot be decoded
+func OpenFileStoreReadOnly(path string) (*FileStore, error) {
+	return openFileStore(path, true)
+}
+
+func openFileStore(path string, readOnly bool) (*FileStore, error) {
+	flag := os.O_RDWR | os.O_CREATE
+	if readOnly {
+		flag = os.O_RDONLY
+	}
+	fd, err := os.OpenFile(path, flag, 0666)
 	if err != nil {
-		return nil, fmt.Errorf("cannot open file at path %s: %w", filepath, err)
+		return nil, fmt.Errorf("cannot open file at path %s: %w", path, err)
+	}
+	defer fd.Close()
+
+	info, err := fd.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("cannot stat file at path %s: %w", path, err)
 	}
 
 	gs := gobStore{
@@ -42,43 +90,144 @@ func NewFileStore(filepath string) (*FileStore, error) {
 		UserHot: make(map[string]map[string]*url.URL),
 	}
 
+	// bad file is replaced on the first write unless it is read only
 	dec := gob.NewDecoder(fd)
-	if err := dec.Decode(&gs); err != nil {
-		// truncate bad file for reuse
-		if err := fd.Truncate(0); err != nil {
-			return nil, fmt.Errorf("cannot truncate broken storage file: %w", err)
+	if err := dec.Decode(&gs); readOnly && err != nil {
+		return nil, fmt.Errorf("cannot decode file at path %s: %w", path, err)
+	} else if err != nil && !errors.Is(err, io.EOF) {
+		gs = gobStore{
+			Hot:     make(map[string]*url.URL),
+			UserHot: make(map[string]map[string]*url.URL),
 		}
 	}
+	if gs.Hot == nil {
+		gs.Hot = make(map[string]*url.URL)
+	}
+	if gs.UserHot == nil {
+		gs.UserHot = make(map[string]map[string]*url.URL)
+	}
+	if gs.History == nil {
+		gs.History = make(map[string][]Version)
+	}
+	if gs.Options == nil {
+		gs.Options = make(map[string]Options)
+	}
+	if gs.Clicks == nil {
+		gs.Clicks = make(map[string]int)
+	}
+	if gs.Variants == nil {
+		gs.Variants = make(map[string]map[int]int)
+	}
+	if gs.Settings == nil {
+		gs.Settings = make(map[string]UserSettings)
+	}
+	if gs.Created == nil {
+		gs.Created = make(map[string]time.Time)
+	}
+	if gs.Disabled == nil {
+		gs.Disabled = make(map[string]Takedown)
+	}
+	if gs.Keys == nil {
+		gs.Keys = make(map[string]APIKey)
+	}
+	if gs.Accounts == nil {
+		gs.Accounts = make(map[string]Account)
+	}
+	if gs.Transfers == nil {
+		gs.Transfers = make(map[string]Transfer)
+	}
+	for id, userID := range gs.Deleted {
+		gs.Hot[id] = nil
+		if userID == "" {
+			continue
+		}
+		if _, ok := gs.UserHot[userID]; !ok {
+			gs.UserHot[userID] = make(map[string]*url.URL)
+		}
+		gs.UserHot[userID][id] = nil
+	}
+	gs.Deleted = nil
 
-	return &FileStore{
-		store:   &gs,
-		enc:     gob.NewEncoder(fd),
-		persist: fd,
-	}, nil
+	f := &FileStore{
+		store:         &gs,
+		path:          path,
+		mode:          info.Mode().Perm(),
+		readOnly:      readOnly,
+		accountEmails: indexAccounts(gs.Accounts),
+		done:          make(chan struct{}),
+	}
+	if !readOnly {
+		go f.flushCounters()
+	}
+	return f, nil
+}
+
+// counterFlushInterval is interval changed click counters are written to file at,
+// counts of the last interval are lost if process crashes
+const counterFlushInterval = 5 * time.Second
+
+// flushCounters writes changed click counters to file every counterFlushInterval till store is closed,
+// failed writes are retried on the next tick
+func (f *FileStore) flushCounters() {
+	ticker := time.NewTicker(counterFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			f.mutex.Lock()
+			if f.countersChanged && !f.closed {
+				_ = f.flush()
+			}
+			f.mutex.Unlock()
+		case <-f.done:
+			return
+		}
+	}
 }
 
 // Save store file
 func (f *FileStore) Save(_ context.Context, u *url.URL) (id string, err error) {
-	id = fmt.Sprintf("%x", len(f.store.Hot))
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	id = f.nextID()
 	f.store.Hot[id] = u
+	f.store.Created[id] = time.Now()
 	return id, f.flush()
 }
 
 // SaveBatch store batch
 func (f *FileStore) SaveBatch(_ context.Context, urls []*url.URL) (ids []string, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	ids, err = f.saveBatch(urls)
+	if err != nil {
+		return nil, err
+	}
+	return ids, f.flush()
+}
+
+// saveBatch stores URLs under new IDs without flushing, caller must hold the lock
+func (f *FileStore) saveBatch(urls []*url.URL) (ids []string, err error) {
 	for _, u := range urls {
-		id := fmt.Sprintf("%x", len(f.store.Hot))
+		id := f.nextID()
 		f.store.Hot[id] = u
+		f.store.Created[id] = time.Now()
 		ids = append(ids, id)
 	}
 	if len(ids) != len(urls) {
 		return nil, errors.New("not all URLs have been saved")
 	}
-	return ids, f.flush()
+	return ids, nil
 }
 
 // Load store from map
 func (f *FileStore) Load(_ context.Context, id string) (u *url.URL, err error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
 	u, ok := f.store.Hot[id]
 	if !ok {
 		return nil, ErrNotFound
@@ -91,20 +240,23 @@ func (f *FileStore) Load(_ context.Context, id string) (u *url.URL, err error) {
 
 // SaveUser store user
 func (f *FileStore) SaveUser(ctx context.Context, uid uuid.UUID, u *url.URL) (id string, err error) {
-	id, err = f.Save(ctx, u)
+	ids, err := f.SaveUserBatch(ctx, uid, []*url.URL{u})
 	if err != nil {
-		return "", fmt.Errorf("cannot save URL to shared store: %w", err)
-	}
-	if _, ok := f.store.UserHot[uid.String()]; !ok {
-		f.store.UserHot[uid.String()] = make(map[string]*url.URL)
+		return "", err
 	}
-	f.store.UserHot[uid.String()][id] = u
-	return id, f.flush()
+	return ids[0], nil
 }
 
 // SaveUserBatch store user batch
 func (f *FileStore) SaveUserBatch(ctx context.Context, uid uuid.UUID, urls []*url.URL) (ids []string, err error) {
-	ids, err = f.SaveBatch(ctx, urls)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	// quota is checked and URLs are saved under the same lock so that concurrent saves cannot exceed it
+	if err := checkQuota(ctx, len(urls), f.usageFunc(uid)); err != nil {
+		return nil, err
+	}
+	ids, err = f.saveBatch(urls)
 	if err != nil {
 		return nil, fmt.Errorf("cannot save URL to shared store: %w", err)
 	}
@@ -118,23 +270,21 @@ func (f *FileStore) SaveUserBatch(ctx context.Context, uid uuid.UUID, urls []*ur
 }
 
 // LoadUser load user
-func (f *FileStore) LoadUser(ctx context.Context, uid uuid.UUID, id string) (u *url.URL, err error) {
-	urls, err := f.LoadUsers(ctx, uid)
-	if err != nil {
-		return nil, fmt.Errorf("cannot load user urls: %w", err)
-	}
-	u, ok := urls[id]
-	if !ok {
-		return nil, ErrNotFound
-	}
-	if u == nil {
-		return nil, ErrDeleted
+func (f *FileStore) LoadUser(_ context.Context, uid uuid.UUID, id string) (u *url.URL, err error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	if _, ok := f.store.UserHot[uid.String()]; !ok {
+		return nil, fmt.Errorf("cannot load user urls: %w", ErrNotFound)
 	}
-	return u, nil
+	return f.userURL(uid, id)
 }
 
 // LoadUsers load users
 func (f *FileStore) LoadUsers(_ context.Context, uid uuid.UUID) (urls map[string]*url.URL, err error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
 	urls, ok := f.store.UserHot[uid.String()]
 	if !ok {
 		return nil, ErrNotFound
@@ -150,6 +300,9 @@ func (f *FileStore) LoadUsers(_ context.Context, uid uuid.UUID) (urls map[string
 
 // DeleteUsers delete users
 func (f *FileStore) DeleteUsers(_ context.Context, uid uuid.UUID, ids ...string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
 	for _, id := range ids {
 		userID := uid.String()
 		if _, ok := f.store.UserHot[userID]; ok {
@@ -160,22 +313,740 @@ func (f *FileStore) DeleteUsers(_ context.Context, uid uuid.UUID, ids ...string)
 	return f.flush()
 }
 
+// TransferUsers moves user URLs to another user in file
+func (f *FileStore) TransferUsers(_ context.Context, from, to uuid.UUID, ids ...string) (moved []string, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.transferUsers(from, to, ids), f.flush()
+}
+
+// transferUsers moves not deleted user URLs to another user
+func (f *FileStore) transferUsers(from, to uuid.UUID, ids []string) (moved []string) {
+	for _, id := range ids {
+		u, err := f.userURL(from, id)
+		if err != nil {
+			continue
+		}
+		if _, ok := f.store.UserHot[to.String()]; !ok {
+			f.store.UserHot[to.String()] = make(map[string]*url.URL)
+		}
+		delete(f.store.UserHot[from.String()], id)
+		f.store.UserHot[to.String()][id] = u
+		moved = append(moved, id)
+	}
+	return moved
+}
+
+// SaveTransfer stores transfer in file
+func (f *FileStore) SaveTransfer(_ context.Context, transfer Transfer) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.store.Transfers[transfer.ID]; ok {
+		return ErrConflict
+	}
+	f.store.Transfers[transfer.ID] = transfer
+	return f.flush()
+}
+
+// LoadTransfer returns transfer from file
+func (f *FileStore) LoadTransfer(_ context.Context, id string) (transfer Transfer, err error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	transfer, ok := f.store.Transfers[id]
+	if !ok {
+		return transfer, ErrNotFound
+	}
+	return transfer, nil
+}
+
+// AcceptTransfer closes transfer and moves its URLs in file
+func (f *FileStore) AcceptTransfer(_ context.Context, id string, to uuid.UUID, acceptedAt time.Time) (moved []string, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	transfer, err := closeTransfer(f.store.Transfers, id, acceptedAt)
+	if err != nil {
+		return nil, err
+	}
+	return f.transferUsers(transfer.From, to, transfer.IDs), f.flush()
+}
+
+// CancelTransfer closes transfer of user in file
+func (f *FileStore) CancelTransfer(_ context.Context, uid uuid.UUID, id string, cancelledAt time.Time) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if transfer, ok := f.store.Transfers[id]; !ok || transfer.From != uid {
+		return ErrNotFound
+	}
+	if _, err := closeTransfer(f.store.Transfers, id, cancelledAt); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+// UpdateUser changes destination of user URL in file
+func (f *FileStore) UpdateUser(_ context.Context, uid uuid.UUID, id string, u *url.URL) (version int, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	current, err := f.userURL(uid, id)
+	if err != nil {
+		return 0, err
+	}
+
+	f.store.History[id] = appendVersion(f.store.History[id], current, u)
+	f.store.Hot[id] = u
+	f.store.UserHot[uid.String()][id] = u
+	return len(f.store.History[id]), f.flush()
+}
+
+// History returns all destinations of user URL from file
+func (f *FileStore) History(_ context.Context, uid uuid.UUID, id string) (versions []Version, err error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	current, err := f.userURL(uid, id)
+	if err != nil {
+		return nil, err
+	}
+	return currentHistory(f.store.History[id], current), nil
+}
+
+// userURL returns current destination of user URL
+func (f *FileStore) userURL(uid uuid.UUID, id string) (*url.URL, error) {
+	u, ok := f.store.UserHot[uid.String()][id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if u == nil {
+		return nil, ErrDeleted
+	}
+	return u, nil
+}
+
+// Records walks over all records in file
+func (f *FileStore) Records(_ context.Context, fn func(rec Record) error) error {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	ids := make([]string, 0, len(f.store.Hot))
+	for id := range f.store.Hot {
+		ids = append(ids, id)
+	}
+	owners := make(map[string]uuid.UUID)
+	for userID, urls := range f.store.UserHot {
+		uid := uuid.FromStringOrNil(userID)
+		for id := range urls {
+			owners[id] = uid
+		}
+	}
+
+	SortIDs(ids)
+	for _, id := range ids {
+		u := f.store.Hot[id]
+
+		rec := Record{
+			ID:            id,
+			URL:           u,
+			Deleted:       u == nil,
+			Options:       f.store.Options[id],
+			Clicks:        f.store.Clicks[id],
+			VariantClicks: copyCounts(f.store.Variants[id]),
+			CreatedAt:     f.store.Created[id],
+			Disabled:      f.takedown(id),
+			History:       copyVersions(f.store.History[id]),
+		}
+		if reports := filterReports(f.store.Reports, id); len(reports) > 0 {
+			rec.Reports = reports
+		}
+		if uid, ok := owners[id]; ok {
+			rec.UserID = &uid
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore saves records to file preserving their IDs
+func (f *FileStore) Restore(_ context.Context, records ...Record) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, rec := range records {
+		u := rec.URL
+		if rec.Deleted {
+			u = nil
+		}
+		f.store.Hot[rec.ID] = u
+		f.setCreated(rec.ID, rec.CreatedAt)
+		f.setOptions(rec.ID, rec.Options)
+		f.setClicks(rec.ID, rec.Clicks)
+		f.setVariantClicks(rec.ID, rec.VariantClicks)
+		f.setDisabled(rec.ID, rec.Disabled)
+		f.setHistory(rec.ID, rec.History)
+		f.store.Reports = replaceReports(f.store.Reports, rec.ID, rec.Reports)
+
+		if rec.UserID == nil {
+			continue
+		}
+		userID := rec.UserID.String()
+		if _, ok := f.store.UserHot[userID]; !ok {
+			f.store.UserHot[userID] = make(map[string]*url.URL)
+		}
+		f.store.UserHot[userID][rec.ID] = u
+	}
+	return f.flush()
+}
+
+// Users walks over users having settings, API keys or account in file
+func (f *FileStore) Users(_ context.Context, fn func(user User) error) error {
+	f.mutex.RLock()
+	users := collectUsers(f.store.Settings, f.store.Keys, f.store.Accounts)
+	f.mutex.RUnlock()
+
+	for _, user := range users {
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreUsers saves users state to file
+func (f *FileStore) RestoreUsers(_ context.Context, users ...User) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, user := range users {
+		restoreUser(f.store.Settings, f.store.Keys, f.store.Accounts, f.accountEmails, user)
+	}
+	return f.flush()
+}
+
+// SaveUserOptions store user URL with options
+func (f *FileStore) SaveUserOptions(ctx context.Context, uid uuid.UUID, u *url.URL, opts Options) (id string, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := checkQuota(ctx, 1, f.usageFunc(uid)); err != nil {
+		return "", err
+	}
+
+	id = f.nextID()
+	f.store.Hot[id] = u
+	f.store.Created[id] = time.Now()
+	if _, ok := f.store.UserHot[uid.String()]; !ok {
+		f.store.UserHot[uid.String()] = make(map[string]*url.URL)
+	}
+	f.store.UserHot[uid.String()][id] = u
+	f.setOptions(id, opts)
+	return id, f.flush()
+}
+
+// SetOptions replaces options of user URL in file
+func (f *FileStore) SetOptions(_ context.Context, uid uuid.UUID, id string, opts Options) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, err := f.userURL(uid, id); err != nil {
+		return err
+	}
+	f.setOptions(id, opts)
+	return f.flush()
+}
+
+// LoadRecord returns URL with its owner and options from file
+func (f *FileStore) LoadRecord(_ context.Context, id string) (rec Record, err error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	u, ok := f.store.Hot[id]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	if u == nil {
+		return Record{}, ErrDeleted
+	}
+
+	rec = Record{
+		ID:            id,
+		URL:           u,
+		Options:       f.store.Options[id],
+		Clicks:        f.store.Clicks[id],
+		VariantClicks: copyCounts(f.store.Variants[id]),
+		CreatedAt:     f.store.Created[id],
+		Disabled:      f.takedown(id),
+	}
+	for userID, urls := range f.store.UserHot {
+		if _, ok := urls[id]; ok {
+			uid := uuid.FromStringOrNil(userID)
+			rec.UserID = &uid
+			break
+		}
+	}
+	return rec, nil
+}
+
+// LoadUserOptions returns options of user URLs from file
+func (f *FileStore) LoadUserOptions(_ context.Context, uid uuid.UUID) (opts map[string]Options, err error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	opts = make(map[string]Options)
+	for id, u := range f.store.UserHot[uid.String()] {
+		if o, ok := f.store.Options[id]; ok && u != nil {
+			opts[id] = o
+		}
+	}
+	return opts, nil
+}
+
+// LoadUserRecords returns user URLs with their metadata from file
+func (f *FileStore) LoadUserRecords(_ context.Context, uid uuid.UUID) (records []Record, err error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	urls, ok := f.store.UserHot[uid.String()]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	for id, u := range urls {
+		records = append(records, Record{
+			ID:        id,
+			URL:       u,
+			UserID:    &uid,
+			Deleted:   u == nil,
+			Options:   f.store.Options[id],
+			Clicks:    f.store.Clicks[id],
+			CreatedAt: f.store.Created[id],
+			Disabled:  f.takedown(id),
+		})
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+// Click counts URL follow in file
+func (f *FileStore) Click(_ context.Context, id string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	u, ok := f.store.Hot[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if u == nil {
+		return ErrDeleted
+	}
+
+	limit := f.store.Options[id].MaxClicks
+	if limit == 0 {
+		return nil
+	}
+	if f.store.Clicks[id] >= limit {
+		return ErrExhausted
+	}
+	f.store.Clicks[id]++
+	// counters are written in background not to hold redirects behind file writes
+	f.countersChanged = true
+	return nil
+}
+
+// CountVariant counts URL variant follow in file
+func (f *FileStore) CountVariant(_ context.Context, id string, variant int) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.store.Hot[id]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := f.store.Variants[id]; !ok {
+		f.store.Variants[id] = make(map[int]int)
+	}
+	f.store.Variants[id][variant]++
+	f.countersChanged = true
+	return nil
+}
+
+// LoadUserSettings returns user settings from file
+func (f *FileStore) LoadUserSettings(_ context.Context, uid uuid.UUID) (settings UserSettings, err error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	return f.store.Settings[uid.String()], nil
+}
+
+// SaveUserSettings stores user settings in file
+func (f *FileStore) SaveUserSettings(_ context.Context, uid uuid.UUID, settings UserSettings) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.store.Settings[uid.String()] = settings
+	return f.flush()
+}
+
+// UserUsage counts user URLs in file
+func (f *FileStore) UserUsage(_ context.Context, uid uuid.UUID, since time.Time) (usage Usage, err error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	return f.usageFunc(uid)(since)
+}
+
+// usageFunc returns function counting user URLs.
+// It must be called under lock.
+func (f *FileStore) usageFunc(uid uuid.UUID) func(since time.Time) (Usage, error) {
+	return func(since time.Time) (usage Usage, err error) {
+		for id, u := range f.store.UserHot[uid.String()] {
+			if u != nil {
+				usage.Active++
+			}
+			if !f.store.Created[id].Before(since) {
+				usage.Created++
+			}
+		}
+		return usage, nil
+	}
+}
+
+// SaveKey stores API key in file
+func (f *FileStore) SaveKey(_ context.Context, key APIKey) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.store.Keys[key.ID]; ok {
+		return ErrConflict
+	}
+	f.store.Keys[key.ID] = key
+	return f.flush()
+}
+
+// LoadKey returns API key from file
+func (f *FileStore) LoadKey(_ context.Context, id string) (key APIKey, err error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	key, ok := f.store.Keys[id]
+	if !ok {
+		return key, ErrNotFound
+	}
+	return key, nil
+}
+
+// LoadUserKeys returns user API keys from file
+func (f *FileStore) LoadUserKeys(_ context.Context, uid uuid.UUID) (keys []APIKey, err error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	return userKeys(f.store.Keys, uid), nil
+}
+
+// RevokeKey revokes user API key in file
+func (f *FileStore) RevokeKey(_ context.Context, uid uuid.UUID, id string, revokedAt time.Time) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := revokeKey(f.store.Keys, uid, id, revokedAt); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+// SaveAccount stores account in file
+func (f *FileStore) SaveAccount(_ context.Context, account Account) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.store.Accounts[account.Email]; ok {
+		return ErrConflict
+	}
+	if _, ok := accountOf(f.store.Accounts, f.accountEmails, account.UserID); ok {
+		return ErrConflict
+	}
+	putAccount(f.store.Accounts, f.accountEmails, account)
+	return f.flush()
+}
+
+// LoadAccount returns account from file
+func (f *FileStore) LoadAccount(_ context.Context, email string) (account Account, err error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	account, ok := f.store.Accounts[email]
+	if !ok {
+		return account, ErrNotFound
+	}
+	return account, nil
+}
+
+// LoadUserAccount returns account of user from file
+func (f *FileStore) LoadUserAccount(_ context.Context, uid uuid.UUID) (account Account, err error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	account, ok := accountOf(f.store.Accounts, f.accountEmails, uid)
+	if !ok {
+		return account, ErrNotFound
+	}
+	return account, nil
+}
+
+// SetPassword replaces password of user account in file
+func (f *FileStore) SetPassword(_ context.Context, uid uuid.UUID, passwordHash string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	err := updateAccount(f.store.Accounts, f.accountEmails, uid, func(account *Account) {
+		account.PasswordHash = passwordHash
+		account.SessionEpoch++
+	})
+	if err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+// RevokeSessions increments session epoch of user account in file
+func (f *FileStore) RevokeSessions(_ context.Context, uid uuid.UUID) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	err := updateAccount(f.store.Accounts, f.accountEmails, uid, func(account *Account) {
+		account.SessionEpoch++
+	})
+	if err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+// SaveReport stores complaint about URL in file
+func (f *FileStore) SaveReport(_ context.Context, report Report) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.store.Hot[report.ID]; !ok {
+		return ErrNotFound
+	}
+	if !acceptReport(f.store.Reports, report) {
+		return ErrConflict
+	}
+	f.store.Reports = append(f.store.Reports, report)
+	return f.flush()
+}
+
+// LoadReports returns complaints about URLs from file
+func (f *FileStore) LoadReports(_ context.Context, id string) (reports []Report, err error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	return filterReports(f.store.Reports, id), nil
+}
+
+// Disable takes URL down in file
+func (f *FileStore) Disable(_ context.Context, id string, takedown Takedown) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	u, ok := f.store.Hot[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if u == nil {
+		return ErrDeleted
+	}
+	f.store.Disabled[id] = takedown
+	return f.flush()
+}
+
+// Enable brings URL back in file
+func (f *FileStore) Enable(_ context.Context, id string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.store.Hot[id]; !ok {
+		return ErrNotFound
+	}
+	delete(f.store.Disabled, id)
+	return f.flush()
+}
+
+// takedown returns copy of URL takedown, nil if URL is not disabled
+func (f *FileStore) takedown(id string) *Takedown {
+	takedown, ok := f.store.Disabled[id]
+	if !ok {
+		return nil
+	}
+	return &takedown
+}
+
+// setDisabled keeps only takedowns of disabled URLs
+func (f *FileStore) setDisabled(id string, takedown *Takedown) {
+	if takedown == nil {
+		delete(f.store.Disabled, id)
+		return
+	}
+	f.store.Disabled[id] = *takedown
+}
+
+// setHistory keeps only histories of updated URLs
+func (f *FileStore) setHistory(id string, history []Version) {
+	if len(history) == 0 {
+		delete(f.store.History, id)
+		return
+	}
+	f.store.History[id] = copyVersions(history)
+}
+
+// setOptions keeps only non-empty options
+func (f *FileStore) setOptions(id string, opts Options) {
+	if opts.IsZero() {
+		delete(f.store.Options, id)
+		return
+	}
+	f.store.Options[id] = opts
+}
+
+// setCreated keeps only known creation times
+func (f *FileStore) setCreated(id string, createdAt time.Time) {
+	if createdAt.IsZero() {
+		delete(f.store.Created, id)
+		return
+	}
+	f.store.Created[id] = createdAt
+}
+
+// setVariantClicks keeps only non-empty variant counters
+func (f *FileStore) setVariantClicks(id string, counts map[int]int) {
+	if len(counts) == 0 {
+		delete(f.store.Variants, id)
+		return
+	}
+	f.store.Variants[id] = copyCounts(counts)
+}
+
+// setClicks keeps only non-zero click counters
+func (f *FileStore) setClicks(id string, clicks int) {
+	if clicks == 0 {
+		delete(f.store.Clicks, id)
+		return
+	}
+	f.store.Clicks[id] = clicks
+}
+
 // Close file closing
 func (f *FileStore) Close() error {
-	if err := f.flush(); err != nil {
-		return fmt.Errorf("cannot flush data to file: %w", err)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	select {
+	case <-f.done:
+	default:
+		close(f.done)
+	}
+	if !f.readOnly {
+		if err := f.flush(); err != nil {
+			return fmt.Errorf("cannot flush data to file: %w", err)
+		}
 	}
-	return f.persist.Close()
+	f.closed = true
+	return nil
 }
 
 // Ping check file
 func (f *FileStore) Ping(_ context.Context) error {
-	if f.persist.Fd() == ^(uintptr(0)) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	if f.closed {
 		return errors.New("underlying file has been closed")
 	}
 	return nil
 }
 
+// flush replaces file with current store snapshot.
+// Snapshot is written to temporary file renamed over the store file
+// so that crash in the middle of writing never leaves the store file broken.
 func (f *FileStore) flush() error {
-	return f.enc.Encode(f.store)
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("cannot create temporary storage file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := gob.NewEncoder(tmp).Encode(f.snapshot()); err != nil {
+		return fmt.Errorf("cannot encode store: %w", err)
+	}
+	if err := tmp.Chmod(f.mode); err != nil {
+		return fmt.Errorf("cannot set permissions of temporary storage file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("cannot sync temporary storage file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot close temporary storage file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("cannot replace storage file: %w", err)
+	}
+	f.countersChanged = false
+	return nil
+}
+
+// snapshot returns copy of store with deleted URLs moved out to Deleted
+func (f *FileStore) snapshot() *gobStore {
+	gs := &gobStore{
+		Hot:       make(map[string]*url.URL, len(f.store.Hot)),
+		UserHot:   make(map[string]map[string]*url.URL, len(f.store.UserHot)),
+		Deleted:   make(map[string]string),
+		History:   f.store.History,
+		Options:   f.store.Options,
+		Clicks:    f.store.Clicks,
+		Variants:  f.store.Variants,
+		Settings:  f.store.Settings,
+		Created:   f.store.Created,
+		Disabled:  f.store.Disabled,
+		Reports:   f.store.Reports,
+		Keys:      f.store.Keys,
+		Accounts:  f.store.Accounts,
+		Transfers: f.store.Transfers,
+	}
+	for id, u := range f.store.Hot {
+		if u == nil {
+			gs.Deleted[id] = ""
+			continue
+		}
+		gs.Hot[id] = u
+	}
+	for userID, urls := range f.store.UserHot {
+		gs.UserHot[userID] = make(map[string]*url.URL, len(urls))
+		for id, u := range urls {
+			if u == nil {
+				gs.Deleted[id] = userID
+				continue
+			}
+			gs.UserHot[userID][id] = u
+		}
+	}
+	return gs
+}
+
+// nextID returns first unused ID starting from the store length
+func (f *FileStore) nextID() string {
+	for n := len(f.store.Hot); ; n++ {
+		id := fmt.Sprintf("%x", n)
+		if _, ok := f.store.Hot[id]; !ok {
+			return id
+		}
+	}
 }
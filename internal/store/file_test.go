@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStoreFlush(t *testing.T) {
+	ctx := context.Background()
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+	uid := uuid.Must(uuid.NewV4())
+	dir := t.TempDir()
+	path := filepath.Join(dir, "store.gob")
+
+	require.NoError(t, os.WriteFile(path, []byte("broken"), 0600))
+
+	s, err := NewFileStore(path)
+	require.NoError(t, err)
+	id, err := s.SaveUserOptions(ctx, uid, u, Options{MaxClicks: 2})
+	require.NoError(t, err)
+	require.NoError(t, s.Click(ctx, id))
+
+	// store file is replaced as a whole leaving no temporary files behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	require.NoError(t, s.Close())
+	assert.Error(t, s.Ping(ctx))
+
+	reopened, err := NewFileStore(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	rec, err := reopened.LoadRecord(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, 1, rec.Clicks)
+	assert.Equal(t, &uid, rec.UserID)
+}
+
+func TestFileStoreCounters(t *testing.T) {
+	ctx := context.Background()
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+	path := filepath.Join(t.TempDir(), "store.gob")
+
+	s, err := NewFileStore(path)
+	require.NoError(t, err)
+	id, err := s.SaveUserOptions(ctx, uuid.Must(uuid.NewV4()), u, Options{MaxClicks: 2})
+	require.NoError(t, err)
+	saved, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// counters are not written on every follow
+	require.NoError(t, s.Click(ctx, id))
+	require.NoError(t, s.CountVariant(ctx, id, 0))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, saved, data)
+
+	require.NoError(t, s.Close())
+	reopened, err := NewFileStore(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	rec, err := reopened.LoadRecord(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, 1, rec.Clicks)
+	assert.Equal(t, map[int]int{0: 1}, rec.VariantClicks)
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// APIKey describes key authenticating programmatic clients as its owner
+type APIKey struct {
+	ID     string
+	UserID uuid.UUID
+	Name   string
+	// Hash is a hash of key secret, the secret itself is never stored
+	Hash      []byte
+	CreatedAt time.Time
+	// RevokedAt is nil for active key
+	RevokedAt *time.Time
+}
+
+// KeyStore interface
+type KeyStore interface {
+	// SaveKey stores new key, ErrConflict is returned if its ID is taken
+	SaveKey(ctx context.Context, key APIKey) error
+	// LoadKey returns key by its ID, revoked keys included
+	LoadKey(ctx context.Context, id string) (key APIKey, err error)
+	// LoadUserKeys returns user keys in order of their creation
+	LoadUserKeys(ctx context.Context, uid uuid.UUID) (keys []APIKey, err error)
+	// RevokeKey revokes user key, ErrNotFound is returned for keys of other users
+	// and ErrDeleted for already revoked ones
+	RevokeKey(ctx context.Context, uid uuid.UUID, id string, revokedAt time.Time) error
+}
+
+// userKeys returns keys of user in order of their creation
+func userKeys(keys map[string]APIKey, uid uuid.UUID) []APIKey {
+	var res []APIKey
+	for _, key := range keys {
+		if key.UserID == uid {
+			res = append(res, key)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].CreatedAt.Equal(res[j].CreatedAt) {
+			return res[i].CreatedAt.Before(res[j].CreatedAt)
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// revokeKey marks user key in map as revoked
+func revokeKey(keys map[string]APIKey, uid uuid.UUID, id string, revokedAt time.Time) error {
+	key, ok := keys[id]
+	if !ok || key.UserID != uid {
+		return ErrNotFound
+	}
+	if key.RevokedAt != nil {
+		return ErrDeleted
+	}
+	key.RevokedAt = &revokedAt
+	keys[id] = key
+	return nil
+}
@@ -5,8 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
-	"strconv"
 	"sync"
+	"time"
 
 	"github.com/gofrs/uuid"
 )
@@ -18,7 +18,22 @@ var _ AuthStore = (*InMemory)(nil)
 type InMemory struct {
 	store     map[string]*url.URL
 	userStore map[string]map[string]*url.URL
-	mutex     sync.RWMutex
+	history   map[string][]Version
+	options   map[string]Options
+	clicks    map[string]int
+	variants  map[string]map[int]int
+	settings  map[string]UserSettings
+	created   map[string]time.Time
+	disabled  map[string]Takedown
+	reports   []Report
+	keys      map[string]APIKey
+	accounts  map[string]Account
+	transfers map[string]Transfer
+	// owners indexes owner uid of every user URL
+	owners map[string]string
+	// accountEmails indexes account email of every uid having account
+	accountEmails map[string]string
+	mutex         sync.RWMutex
 }
 
 // NewInMemory create new InMemory instance
@@ -26,7 +41,20 @@ func NewInMemory() *InMemory {
 	return &InMemory{
 		store:     make(map[string]*url.URL),
 		userStore: make(map[string]map[string]*url.URL),
-		mutex:     sync.RWMutex{},
+		history:   make(map[string][]Version),
+		options:   make(map[string]Options),
+		clicks:    make(map[string]int),
+		variants:  make(map[string]map[int]int),
+		settings:  make(map[string]UserSettings),
+		created:   make(map[string]time.Time),
+		disabled:  make(map[string]Takedown),
+		keys:      make(map[string]APIKey),
+		accounts:  make(map[string]Account),
+		transfers: make(map[string]Transfer),
+		owners:    make(map[string]string),
+
+		accountEmails: make(map[string]string),
+		mutex:         sync.RWMutex{},
 	}
 }
 
@@ -36,9 +64,10 @@ func (m *InMemory) Save(_ context.Context, u *url.URL) (id string, err error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	id = strconv.Itoa(len(m.store))
+	id = m.nextID()
 
 	m.store[id] = u
+	m.created[id] = time.Now()
 	return id, nil
 }
 
@@ -47,9 +76,15 @@ func (m *InMemory) SaveBatch(_ context.Context, urls []*url.URL) (ids []string,
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	return m.saveBatch(urls)
+}
+
+// saveBatch stores URLs under new IDs, caller must hold the lock
+func (m *InMemory) saveBatch(urls []*url.URL) (ids []string, err error) {
 	for _, u := range urls {
-		id := fmt.Sprintf("%x", len(m.store))
+		id := m.nextID()
 		m.store[id] = u
+		m.created[id] = time.Now()
 		ids = append(ids, id)
 	}
 	if len(ids) != len(urls) {
@@ -75,18 +110,18 @@ func (m *InMemory) Load(_ context.Context, id string) (u *url.URL, err error) {
 
 // SaveUser store in memory user
 func (m *InMemory) SaveUser(ctx context.Context, uid uuid.UUID, u *url.URL) (id string, err error) {
-	id, err = m.Save(ctx, u)
-
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	if err := checkQuota(ctx, 1, m.usageFunc(uid)); err != nil {
+		return "", err
+	}
+	ids, err := m.saveBatch([]*url.URL{u})
 	if err != nil {
 		return "", fmt.Errorf("cannot save URL to shared store: %w", err)
 	}
-	if _, ok := m.userStore[uid.String()]; !ok {
-		m.userStore[uid.String()] = make(map[string]*url.URL)
-	}
-	m.userStore[uid.String()][id] = u
+	id = ids[0]
+	m.setUserURL(uid.String(), id, u)
 	return id, nil
 }
 
@@ -95,15 +130,18 @@ func (m *InMemory) SaveUserBatch(ctx context.Context, uid uuid.UUID, urls []*url
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	ids, err = m.SaveBatch(ctx, urls)
+	// whole batch is refused if it does not fit
+	if err := checkQuota(ctx, len(urls), m.usageFunc(uid)); err != nil {
+		return nil, err
+	}
+
+	// save shared and user URLs under the same lock so readers never see URLs without owner
+	ids, err = m.saveBatch(urls)
 	if err != nil {
 		return nil, fmt.Errorf("cannot save URLs to shared store: %w", err)
 	}
-	if _, ok := m.userStore[uid.String()]; !ok {
-		m.userStore[uid.String()] = make(map[string]*url.URL)
-	}
 	for i, id := range ids {
-		m.userStore[uid.String()][id] = urls[i]
+		m.setUserURL(uid.String(), id, urls[i])
 	}
 	return ids, nil
 }
@@ -161,6 +199,622 @@ func (m *InMemory) DeleteUsers(_ context.Context, uid uuid.UUID, ids ...string)
 	return nil
 }
 
+// TransferUsers moves user URLs to another user in store
+func (m *InMemory) TransferUsers(_ context.Context, from, to uuid.UUID, ids ...string) (moved []string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.transferUsers(from, to, ids), nil
+}
+
+// transferUsers moves not deleted user URLs to another user.
+// Must be called under lock.
+func (m *InMemory) transferUsers(from, to uuid.UUID, ids []string) (moved []string) {
+	for _, id := range ids {
+		u, err := m.userURL(from, id)
+		if err != nil {
+			continue
+		}
+		delete(m.userStore[from.String()], id)
+		m.setUserURL(to.String(), id, u)
+		moved = append(moved, id)
+	}
+	return moved
+}
+
+// SaveTransfer stores transfer in memory
+func (m *InMemory) SaveTransfer(_ context.Context, transfer Transfer) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.transfers[transfer.ID]; ok {
+		return ErrConflict
+	}
+	m.transfers[transfer.ID] = transfer
+	return nil
+}
+
+// LoadTransfer returns transfer from memory
+func (m *InMemory) LoadTransfer(_ context.Context, id string) (transfer Transfer, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	transfer, ok := m.transfers[id]
+	if !ok {
+		return transfer, ErrNotFound
+	}
+	return transfer, nil
+}
+
+// AcceptTransfer closes transfer and moves its URLs in memory
+func (m *InMemory) AcceptTransfer(_ context.Context, id string, to uuid.UUID, acceptedAt time.Time) (moved []string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	transfer, err := closeTransfer(m.transfers, id, acceptedAt)
+	if err != nil {
+		return nil, err
+	}
+	return m.transferUsers(transfer.From, to, transfer.IDs), nil
+}
+
+// CancelTransfer closes transfer of user in memory
+func (m *InMemory) CancelTransfer(_ context.Context, uid uuid.UUID, id string, cancelledAt time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if transfer, ok := m.transfers[id]; !ok || transfer.From != uid {
+		return ErrNotFound
+	}
+	_, err := closeTransfer(m.transfers, id, cancelledAt)
+	return err
+}
+
+// UpdateUser changes destination of user URL in store
+func (m *InMemory) UpdateUser(_ context.Context, uid uuid.UUID, id string, u *url.URL) (version int, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	current, err := m.userURL(uid, id)
+	if err != nil {
+		return 0, err
+	}
+
+	m.history[id] = appendVersion(m.history[id], current, u)
+	m.store[id] = u
+	m.userStore[uid.String()][id] = u
+	return len(m.history[id]), nil
+}
+
+// History returns all destinations of user URL from store
+func (m *InMemory) History(_ context.Context, uid uuid.UUID, id string) (versions []Version, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	current, err := m.userURL(uid, id)
+	if err != nil {
+		return nil, err
+	}
+	return currentHistory(m.history[id], current), nil
+}
+
+// userURL returns current destination of user URL.
+// Must be called under lock.
+func (m *InMemory) userURL(uid uuid.UUID, id string) (*url.URL, error) {
+	u, ok := m.userStore[uid.String()][id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if u == nil {
+		return nil, ErrDeleted
+	}
+	return u, nil
+}
+
+// Records walks over all records in store
+func (m *InMemory) Records(_ context.Context, fn func(rec Record) error) error {
+	m.mutex.RLock()
+	ids := make([]string, 0, len(m.store))
+	for id := range m.store {
+		ids = append(ids, id)
+	}
+	m.mutex.RUnlock()
+
+	SortIDs(ids)
+	for _, id := range ids {
+		m.mutex.RLock()
+		u, ok := m.store[id]
+		rec := Record{
+			ID:            id,
+			URL:           u,
+			Deleted:       u == nil,
+			Options:       m.options[id],
+			Clicks:        m.clicks[id],
+			VariantClicks: copyCounts(m.variants[id]),
+			CreatedAt:     m.created[id],
+			Disabled:      m.takedown(id),
+			History:       copyVersions(m.history[id]),
+		}
+		if reports := filterReports(m.reports, id); len(reports) > 0 {
+			rec.Reports = reports
+		}
+		userID, owned := m.owners[id]
+		m.mutex.RUnlock()
+		if !ok {
+			continue
+		}
+
+		if owned {
+			uid := uuid.FromStringOrNil(userID)
+			rec.UserID = &uid
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore saves records to store preserving their IDs
+func (m *InMemory) Restore(_ context.Context, records ...Record) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, rec := range records {
+		u := rec.URL
+		if rec.Deleted {
+			u = nil
+		}
+		m.store[rec.ID] = u
+		m.setCreated(rec.ID, rec.CreatedAt)
+		m.setOptions(rec.ID, rec.Options)
+		m.setClicks(rec.ID, rec.Clicks)
+		m.setVariantClicks(rec.ID, rec.VariantClicks)
+		m.setDisabled(rec.ID, rec.Disabled)
+		m.setHistory(rec.ID, rec.History)
+		m.reports = replaceReports(m.reports, rec.ID, rec.Reports)
+
+		if rec.UserID == nil {
+			continue
+		}
+		m.setUserURL(rec.UserID.String(), rec.ID, u)
+	}
+	return nil
+}
+
+// Users walks over users having settings, API keys or account in store
+func (m *InMemory) Users(_ context.Context, fn func(user User) error) error {
+	m.mutex.RLock()
+	users := collectUsers(m.settings, m.keys, m.accounts)
+	m.mutex.RUnlock()
+
+	for _, user := range users {
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreUsers saves users state to store
+func (m *InMemory) RestoreUsers(_ context.Context, users ...User) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, user := range users {
+		restoreUser(m.settings, m.keys, m.accounts, m.accountEmails, user)
+	}
+	return nil
+}
+
+// SaveUserOptions store in memory user URL with options
+func (m *InMemory) SaveUserOptions(ctx context.Context, uid uuid.UUID, u *url.URL, opts Options) (id string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := checkQuota(ctx, 1, m.usageFunc(uid)); err != nil {
+		return "", err
+	}
+
+	id = m.nextID()
+	m.store[id] = u
+	m.created[id] = time.Now()
+	m.setUserURL(uid.String(), id, u)
+	m.setOptions(id, opts)
+	return id, nil
+}
+
+// SetOptions replaces options of user URL in memory
+func (m *InMemory) SetOptions(_ context.Context, uid uuid.UUID, id string, opts Options) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, err := m.userURL(uid, id); err != nil {
+		return err
+	}
+	m.setOptions(id, opts)
+	return nil
+}
+
+// LoadRecord returns URL with its owner and options from memory
+func (m *InMemory) LoadRecord(_ context.Context, id string) (rec Record, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	u, ok := m.store[id]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	if u == nil {
+		return Record{}, ErrDeleted
+	}
+
+	rec = Record{
+		ID:            id,
+		URL:           u,
+		Options:       m.options[id],
+		Clicks:        m.clicks[id],
+		VariantClicks: copyCounts(m.variants[id]),
+		CreatedAt:     m.created[id],
+		Disabled:      m.takedown(id),
+	}
+	if userID, ok := m.owners[id]; ok {
+		uid := uuid.FromStringOrNil(userID)
+		rec.UserID = &uid
+	}
+	return rec, nil
+}
+
+// LoadUserOptions returns options of user URLs from memory
+func (m *InMemory) LoadUserOptions(_ context.Context, uid uuid.UUID) (opts map[string]Options, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	opts = make(map[string]Options)
+	for id, u := range m.userStore[uid.String()] {
+		if o, ok := m.options[id]; ok && u != nil {
+			opts[id] = o
+		}
+	}
+	return opts, nil
+}
+
+// LoadUserRecords returns user URLs with their metadata from memory
+func (m *InMemory) LoadUserRecords(_ context.Context, uid uuid.UUID) (records []Record, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	urls, ok := m.userStore[uid.String()]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	for id, u := range urls {
+		records = append(records, Record{
+			ID:        id,
+			URL:       u,
+			UserID:    &uid,
+			Deleted:   u == nil,
+			Options:   m.options[id],
+			Clicks:    m.clicks[id],
+			CreatedAt: m.created[id],
+			Disabled:  m.takedown(id),
+		})
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+// Click counts URL follow in memory
+func (m *InMemory) Click(_ context.Context, id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	u, ok := m.store[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if u == nil {
+		return ErrDeleted
+	}
+
+	limit := m.options[id].MaxClicks
+	if limit == 0 {
+		return nil
+	}
+	if m.clicks[id] >= limit {
+		return ErrExhausted
+	}
+	m.clicks[id]++
+	return nil
+}
+
+// CountVariant counts URL variant follow in memory
+func (m *InMemory) CountVariant(_ context.Context, id string, variant int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.store[id]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := m.variants[id]; !ok {
+		m.variants[id] = make(map[int]int)
+	}
+	m.variants[id][variant]++
+	return nil
+}
+
+// LoadUserSettings returns user settings from memory
+func (m *InMemory) LoadUserSettings(_ context.Context, uid uuid.UUID) (settings UserSettings, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.settings[uid.String()], nil
+}
+
+// SaveUserSettings stores user settings in memory
+func (m *InMemory) SaveUserSettings(_ context.Context, uid uuid.UUID, settings UserSettings) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.settings[uid.String()] = settings
+	return nil
+}
+
+// UserUsage counts user URLs in memory
+func (m *InMemory) UserUsage(_ context.Context, uid uuid.UUID, since time.Time) (usage Usage, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.usageFunc(uid)(since)
+}
+
+// usageFunc returns function counting user URLs.
+// It must be called under lock.
+func (m *InMemory) usageFunc(uid uuid.UUID) func(since time.Time) (Usage, error) {
+	return func(since time.Time) (usage Usage, err error) {
+		for id, u := range m.userStore[uid.String()] {
+			if u != nil {
+				usage.Active++
+			}
+			if !m.created[id].Before(since) {
+				usage.Created++
+			}
+		}
+		return usage, nil
+	}
+}
+
+// SaveKey stores API key in memory
+func (m *InMemory) SaveKey(_ context.Context, key APIKey) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.keys[key.ID]; ok {
+		return ErrConflict
+	}
+	m.keys[key.ID] = key
+	return nil
+}
+
+// LoadKey returns API key from memory
+func (m *InMemory) LoadKey(_ context.Context, id string) (key APIKey, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	key, ok := m.keys[id]
+	if !ok {
+		return key, ErrNotFound
+	}
+	return key, nil
+}
+
+// LoadUserKeys returns user API keys from memory
+func (m *InMemory) LoadUserKeys(_ context.Context, uid uuid.UUID) (keys []APIKey, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return userKeys(m.keys, uid), nil
+}
+
+// RevokeKey revokes user API key in memory
+func (m *InMemory) RevokeKey(_ context.Context, uid uuid.UUID, id string, revokedAt time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return revokeKey(m.keys, uid, id, revokedAt)
+}
+
+// SaveAccount stores account in memory
+func (m *InMemory) SaveAccount(_ context.Context, account Account) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.accounts[account.Email]; ok {
+		return ErrConflict
+	}
+	if _, ok := accountOf(m.accounts, m.accountEmails, account.UserID); ok {
+		return ErrConflict
+	}
+	putAccount(m.accounts, m.accountEmails, account)
+	return nil
+}
+
+// LoadAccount returns account from memory
+func (m *InMemory) LoadAccount(_ context.Context, email string) (account Account, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	account, ok := m.accounts[email]
+	if !ok {
+		return account, ErrNotFound
+	}
+	return account, nil
+}
+
+// LoadUserAccount returns account of user from memory
+func (m *InMemory) LoadUserAccount(_ context.Context, uid uuid.UUID) (account Account, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	account, ok := accountOf(m.accounts, m.accountEmails, uid)
+	if !ok {
+		return account, ErrNotFound
+	}
+	return account, nil
+}
+
+// SetPassword replaces password of user account in memory
+func (m *InMemory) SetPassword(_ context.Context, uid uuid.UUID, passwordHash string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return updateAccount(m.accounts, m.accountEmails, uid, func(account *Account) {
+		account.PasswordHash = passwordHash
+		account.SessionEpoch++
+	})
+}
+
+// RevokeSessions increments session epoch of user account in memory
+func (m *InMemory) RevokeSessions(_ context.Context, uid uuid.UUID) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return updateAccount(m.accounts, m.accountEmails, uid, func(account *Account) {
+		account.SessionEpoch++
+	})
+}
+
+// SaveReport stores complaint about URL in memory
+func (m *InMemory) SaveReport(_ context.Context, report Report) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.store[report.ID]; !ok {
+		return ErrNotFound
+	}
+	if !acceptReport(m.reports, report) {
+		return ErrConflict
+	}
+	m.reports = append(m.reports, report)
+	return nil
+}
+
+// LoadReports returns complaints about URLs from memory
+func (m *InMemory) LoadReports(_ context.Context, id string) (reports []Report, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return filterReports(m.reports, id), nil
+}
+
+// Disable takes URL down in memory
+func (m *InMemory) Disable(_ context.Context, id string, takedown Takedown) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	u, ok := m.store[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if u == nil {
+		return ErrDeleted
+	}
+	m.disabled[id] = takedown
+	return nil
+}
+
+// Enable brings URL back in memory
+func (m *InMemory) Enable(_ context.Context, id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.store[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.disabled, id)
+	return nil
+}
+
+// takedown returns copy of URL takedown, nil if URL is not disabled.
+// Must be called under lock.
+func (m *InMemory) takedown(id string) *Takedown {
+	takedown, ok := m.disabled[id]
+	if !ok {
+		return nil
+	}
+	return &takedown
+}
+
+// setDisabled keeps only takedowns of disabled URLs.
+// Must be called under lock.
+func (m *InMemory) setDisabled(id string, takedown *Takedown) {
+	if takedown == nil {
+		delete(m.disabled, id)
+		return
+	}
+	m.disabled[id] = *takedown
+}
+
+// setUserURL stores user URL and indexes its owner.
+// Must be called under lock.
+func (m *InMemory) setUserURL(userID, id string, u *url.URL) {
+	if _, ok := m.userStore[userID]; !ok {
+		m.userStore[userID] = make(map[string]*url.URL)
+	}
+	m.userStore[userID][id] = u
+	m.owners[id] = userID
+}
+
+// setHistory keeps only histories of updated URLs.
+// Must be called under lock.
+func (m *InMemory) setHistory(id string, history []Version) {
+	if len(history) == 0 {
+		delete(m.history, id)
+		return
+	}
+	m.history[id] = copyVersions(history)
+}
+
+// setOptions keeps only non-empty options.
+// Must be called under lock.
+func (m *InMemory) setOptions(id string, opts Options) {
+	if opts.IsZero() {
+		delete(m.options, id)
+		return
+	}
+	m.options[id] = opts
+}
+
+// setCreated keeps only known creation times.
+// Must be called under lock.
+func (m *InMemory) setCreated(id string, createdAt time.Time) {
+	if createdAt.IsZero() {
+		delete(m.created, id)
+		return
+	}
+	m.created[id] = createdAt
+}
+
+// setVariantClicks keeps only non-empty variant counters.
+// Must be called under lock.
+func (m *InMemory) setVariantClicks(id string, counts map[int]int) {
+	if len(counts) == 0 {
+		delete(m.variants, id)
+		return
+	}
+	m.variants[id] = copyCounts(counts)
+}
+
+// setClicks keeps only non-zero click counters.
+// Must be called under lock.
+func (m *InMemory) setClicks(id string, clicks int) {
+	if clicks == 0 {
+		delete(m.clicks, id)
+		return
+	}
+	m.clicks[id] = clicks
+}
+
 // Close return nil
 func (m *InMemory) Close() error {
 	return nil
@@ -170,3 +824,14 @@ func (m *InMemory) Close() error {
 func (m *InMemory) Ping(_ context.Context) error {
 	return nil
 }
+
+// nextID returns first unused ID starting from the store length.
+// Must be called under lock.
+func (m *InMemory) nextID() string {
+	for n := len(m.store); ; n++ {
+		id := fmt.Sprintf("%x", n)
+		if _, ok := m.store[id]; !ok {
+			return id
+		}
+	}
+}
@@ -0,0 +1,642 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+var _ AuthStore = (*Mirror)(nil)
+
+// MirrorStats describes mirror counters
+type MirrorStats struct {
+	// Writes is a number of writes replicated to secondary store
+	Writes int64
+	// WriteFailures is a number of writes failed on secondary store
+	WriteFailures int64
+	// Mismatches is a number of reads which results differ between stores
+	Mismatches int64
+	// SkippedChecks is a number of reads not compared as too many comparisons were running
+	SkippedChecks int64
+}
+
+const (
+	// maxMirrorChecks limits reads compared with secondary store at once
+	maxMirrorChecks = 64
+	// mirrorCheckTimeout limits secondary read of comparison
+	mirrorCheckTimeout = 5 * time.Second
+)
+
+// MirrorOption configures Mirror
+type MirrorOption func(m *Mirror)
+
+// WithStatsLog logs mirror counters every interval
+func WithStatsLog(interval time.Duration) MirrorOption {
+	return func(m *Mirror) {
+		m.statsInterval = interval
+	}
+}
+
+// Mirror writes data to both primary and secondary stores and reads from primary.
+// Secondary store failures never fail requests and are only logged and counted.
+// Reads are compared with secondary store in background.
+type Mirror struct {
+	// counters go first to stay 64-bit aligned for atomic operations
+	writes        int64
+	writeFailures int64
+	mismatches    int64
+	skippedChecks int64
+
+	primary   AuthStore
+	secondary AuthStore
+	log       *log.Logger
+
+	// checks holds slots of running comparisons
+	checks        chan struct{}
+	running       sync.WaitGroup
+	statsInterval time.Duration
+	done          chan struct{}
+}
+
+// NewMirror return new Mirror instance
+func NewMirror(primary, secondary AuthStore, logger *log.Logger, opts ...MirrorOption) *Mirror {
+	m := &Mirror{
+		primary:   primary,
+		secondary: secondary,
+		log:       logger,
+		checks:    make(chan struct{}, maxMirrorChecks),
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.statsInterval > 0 {
+		go m.logStats()
+	}
+	return m
+}
+
+// Stats returns current mirror counters
+func (m *Mirror) Stats() MirrorStats {
+	return MirrorStats{
+		Writes:        atomic.LoadInt64(&m.writes),
+		WriteFailures: atomic.LoadInt64(&m.writeFailures),
+		Mismatches:    atomic.LoadInt64(&m.mismatches),
+		SkippedChecks: atomic.LoadInt64(&m.skippedChecks),
+	}
+}
+
+// logStats logs counters every statsInterval till mirror is closed
+func (m *Mirror) logStats() {
+	ticker := time.NewTicker(m.statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.printStats("stats")
+		case <-m.done:
+			return
+		}
+	}
+}
+
+func (m *Mirror) printStats(prefix string) {
+	stats := m.Stats()
+	m.log.Printf("%s: %d writes, %d write failures, %d mismatches, %d skipped checks",
+		prefix, stats.Writes, stats.WriteFailures, stats.Mismatches, stats.SkippedChecks)
+}
+
+// Save store URL in both stores
+func (m *Mirror) Save(ctx context.Context, u *url.URL) (id string, err error) {
+	id, err = m.primary.Save(ctx, u)
+	if err != nil {
+		// conflicting record has been mirrored on its creation
+		return id, err
+	}
+	m.restore(ctx, "save", m.records(ctx, Record{ID: id, URL: u})...)
+	return id, nil
+}
+
+// SaveBatch store batch in both stores
+func (m *Mirror) SaveBatch(ctx context.Context, urls []*url.URL) (ids []string, err error) {
+	ids, err = m.primary.SaveBatch(ctx, urls)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(ids))
+	for i, id := range ids {
+		records = append(records, Record{ID: id, URL: urls[i]})
+	}
+	m.restore(ctx, "save_batch", m.records(ctx, records...)...)
+	return ids, nil
+}
+
+// Load URL from primary store
+func (m *Mirror) Load(ctx context.Context, id string) (u *url.URL, err error) {
+	u, err = m.primary.Load(ctx, id)
+	pu, perr := u, err
+	m.check(func(ctx context.Context) {
+		su, serr := m.secondary.Load(ctx, id)
+		m.compare("load", id, pu, perr, su, serr)
+	})
+	return u, err
+}
+
+// SaveUser store user URL in both stores
+func (m *Mirror) SaveUser(ctx context.Context, uid uuid.UUID, u *url.URL) (id string, err error) {
+	id, err = m.primary.SaveUser(ctx, uid, u)
+	if err != nil {
+		return id, err
+	}
+	m.restore(ctx, "save_user", m.records(ctx, Record{ID: id, URL: u, UserID: &uid})...)
+	return id, nil
+}
+
+// SaveUserBatch store user batch in both stores
+func (m *Mirror) SaveUserBatch(ctx context.Context, uid uuid.UUID, urls []*url.URL) (ids []string, err error) {
+	ids, err = m.primary.SaveUserBatch(ctx, uid, urls)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(ids))
+	for i, id := range ids {
+		records = append(records, Record{ID: id, URL: urls[i], UserID: &uid})
+	}
+	m.restore(ctx, "save_user_batch", m.records(ctx, records...)...)
+	return ids, nil
+}
+
+// LoadUser load user URL from primary store
+func (m *Mirror) LoadUser(ctx context.Context, uid uuid.UUID, id string) (u *url.URL, err error) {
+	u, err = m.primary.LoadUser(ctx, uid, id)
+	pu, perr := u, err
+	m.check(func(ctx context.Context) {
+		su, serr := m.secondary.LoadUser(ctx, uid, id)
+		m.compare("load_user", id, pu, perr, su, serr)
+	})
+	return u, err
+}
+
+// LoadUsers load user URLs from primary store
+func (m *Mirror) LoadUsers(ctx context.Context, uid uuid.UUID) (urls map[string]*url.URL, err error) {
+	urls, err = m.primary.LoadUsers(ctx, uid)
+	purls, perr := urls, err
+	m.check(func(ctx context.Context) {
+		surls, serr := m.secondary.LoadUsers(ctx, uid)
+		if perr != nil || serr != nil {
+			if !sameError(perr, serr) {
+				m.mismatch("load_users", uid.String(), fmt.Sprint(perr), fmt.Sprint(serr))
+			}
+			return
+		}
+
+		for id, u := range purls {
+			m.compare("load_users", id, u, nil, surls[id], nil)
+		}
+		for id, su := range surls {
+			if _, ok := purls[id]; !ok {
+				m.compare("load_users", id, nil, ErrNotFound, su, nil)
+			}
+		}
+	})
+	return urls, err
+}
+
+// DeleteUsers delete user URLs in both stores
+func (m *Mirror) DeleteUsers(ctx context.Context, uid uuid.UUID, ids ...string) error {
+	if err := m.primary.DeleteUsers(ctx, uid, ids...); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if err := m.secondary.DeleteUsers(ctx, uid, ids...); err != nil {
+		m.writeFailure("delete_users", err)
+	}
+	return nil
+}
+
+// TransferUsers moves user URLs to another user in both stores
+func (m *Mirror) TransferUsers(ctx context.Context, from, to uuid.UUID, ids ...string) (moved []string, err error) {
+	moved, err = m.primary.TransferUsers(ctx, from, to, ids...)
+	if err != nil || len(moved) == 0 {
+		return moved, err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if _, err := m.secondary.TransferUsers(ctx, from, to, moved...); err != nil {
+		m.writeFailure("transfer_users", err)
+	}
+	return moved, nil
+}
+
+// SaveTransfer stores transfer in both stores
+func (m *Mirror) SaveTransfer(ctx context.Context, transfer Transfer) error {
+	if err := m.primary.SaveTransfer(ctx, transfer); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if err := m.secondary.SaveTransfer(ctx, transfer); err != nil {
+		m.writeFailure("save_transfer", err)
+	}
+	return nil
+}
+
+// LoadTransfer returns transfer from primary store
+func (m *Mirror) LoadTransfer(ctx context.Context, id string) (transfer Transfer, err error) {
+	return m.primary.LoadTransfer(ctx, id)
+}
+
+// AcceptTransfer closes transfer and moves its URLs in both stores
+func (m *Mirror) AcceptTransfer(ctx context.Context, id string, to uuid.UUID, acceptedAt time.Time) (moved []string, err error) {
+	moved, err = m.primary.AcceptTransfer(ctx, id, to, acceptedAt)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if _, err := m.secondary.AcceptTransfer(ctx, id, to, acceptedAt); err != nil {
+		m.writeFailure("accept_transfer", err)
+	}
+	return moved, nil
+}
+
+// CancelTransfer closes transfer of user in both stores
+func (m *Mirror) CancelTransfer(ctx context.Context, uid uuid.UUID, id string, cancelledAt time.Time) error {
+	if err := m.primary.CancelTransfer(ctx, uid, id, cancelledAt); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if err := m.secondary.CancelTransfer(ctx, uid, id, cancelledAt); err != nil {
+		m.writeFailure("cancel_transfer", err)
+	}
+	return nil
+}
+
+// UpdateUser changes destination of user URL in both stores
+func (m *Mirror) UpdateUser(ctx context.Context, uid uuid.UUID, id string, u *url.URL) (version int, err error) {
+	version, err = m.primary.UpdateUser(ctx, uid, id, u)
+	if err != nil {
+		return 0, err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if _, err := m.secondary.UpdateUser(ctx, uid, id, u); err != nil {
+		m.writeFailure("update_user", err)
+	}
+	return version, nil
+}
+
+// History returns URL history from primary store
+func (m *Mirror) History(ctx context.Context, uid uuid.UUID, id string) (versions []Version, err error) {
+	return m.primary.History(ctx, uid, id)
+}
+
+// Records walks over records of primary store
+func (m *Mirror) Records(ctx context.Context, fn func(rec Record) error) error {
+	return m.primary.Records(ctx, fn)
+}
+
+// Users walks over users of primary store
+func (m *Mirror) Users(ctx context.Context, fn func(user User) error) error {
+	return m.primary.Users(ctx, fn)
+}
+
+// RestoreUsers saves users state to both stores
+func (m *Mirror) RestoreUsers(ctx context.Context, users ...User) error {
+	if err := m.primary.RestoreUsers(ctx, users...); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if err := m.secondary.RestoreUsers(ctx, users...); err != nil {
+		m.writeFailure("restore_users", err)
+	}
+	return nil
+}
+
+// Restore saves records to both stores
+func (m *Mirror) Restore(ctx context.Context, records ...Record) error {
+	if err := m.primary.Restore(ctx, records...); err != nil {
+		return err
+	}
+	m.restore(ctx, "restore", records...)
+	return nil
+}
+
+// SaveUserOptions store user URL with options in both stores
+func (m *Mirror) SaveUserOptions(ctx context.Context, uid uuid.UUID, u *url.URL, opts Options) (id string, err error) {
+	id, err = m.primary.SaveUserOptions(ctx, uid, u, opts)
+	if err != nil {
+		return id, err
+	}
+	m.restore(ctx, "save_user_options", m.records(ctx, Record{ID: id, URL: u, UserID: &uid, Options: opts})...)
+	return id, nil
+}
+
+// SetOptions replaces options of user URL in both stores
+func (m *Mirror) SetOptions(ctx context.Context, uid uuid.UUID, id string, opts Options) error {
+	if err := m.primary.SetOptions(ctx, uid, id, opts); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if err := m.secondary.SetOptions(ctx, uid, id, opts); err != nil {
+		m.writeFailure("set_options", err)
+	}
+	return nil
+}
+
+// LoadRecord load record from primary store
+func (m *Mirror) LoadRecord(ctx context.Context, id string) (rec Record, err error) {
+	rec, err = m.primary.LoadRecord(ctx, id)
+	pu, perr := rec.URL, err
+	m.check(func(ctx context.Context) {
+		srec, serr := m.secondary.LoadRecord(ctx, id)
+		m.compare("load_record", id, pu, perr, srec.URL, serr)
+	})
+	return rec, err
+}
+
+// LoadUserOptions returns options of user URLs from primary store
+func (m *Mirror) LoadUserOptions(ctx context.Context, uid uuid.UUID) (opts map[string]Options, err error) {
+	return m.primary.LoadUserOptions(ctx, uid)
+}
+
+// LoadUserRecords returns user URLs with their metadata from primary store
+func (m *Mirror) LoadUserRecords(ctx context.Context, uid uuid.UUID) (records []Record, err error) {
+	return m.primary.LoadUserRecords(ctx, uid)
+}
+
+// Click counts URL follow in both stores
+func (m *Mirror) Click(ctx context.Context, id string) error {
+	if err := m.primary.Click(ctx, id); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if err := m.secondary.Click(ctx, id); err != nil {
+		m.writeFailure("click", err)
+	}
+	return nil
+}
+
+// CountVariant counts URL variant follow in both stores
+func (m *Mirror) CountVariant(ctx context.Context, id string, variant int) error {
+	if err := m.primary.CountVariant(ctx, id, variant); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if err := m.secondary.CountVariant(ctx, id, variant); err != nil {
+		m.writeFailure("count_variant", err)
+	}
+	return nil
+}
+
+// LoadUserSettings returns user settings from primary store
+func (m *Mirror) LoadUserSettings(ctx context.Context, uid uuid.UUID) (settings UserSettings, err error) {
+	return m.primary.LoadUserSettings(ctx, uid)
+}
+
+// SaveUserSettings stores user settings in both stores
+func (m *Mirror) SaveUserSettings(ctx context.Context, uid uuid.UUID, settings UserSettings) error {
+	if err := m.primary.SaveUserSettings(ctx, uid, settings); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if err := m.secondary.SaveUserSettings(ctx, uid, settings); err != nil {
+		m.writeFailure("save_user_settings", err)
+	}
+	return nil
+}
+
+// UserUsage counts user URLs in primary store
+func (m *Mirror) UserUsage(ctx context.Context, uid uuid.UUID, since time.Time) (usage Usage, err error) {
+	return m.primary.UserUsage(ctx, uid, since)
+}
+
+// SaveKey stores API key in both stores
+func (m *Mirror) SaveKey(ctx context.Context, key APIKey) error {
+	if err := m.primary.SaveKey(ctx, key); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if err := m.secondary.SaveKey(ctx, key); err != nil {
+		m.writeFailure("save_key", err)
+	}
+	return nil
+}
+
+// LoadKey returns API key from primary store
+func (m *Mirror) LoadKey(ctx context.Context, id string) (key APIKey, err error) {
+	return m.primary.LoadKey(ctx, id)
+}
+
+// LoadUserKeys returns user API keys from primary store
+func (m *Mirror) LoadUserKeys(ctx context.Context, uid uuid.UUID) (keys []APIKey, err error) {
+	return m.primary.LoadUserKeys(ctx, uid)
+}
+
+// RevokeKey revokes user API key in both stores
+func (m *Mirror) RevokeKey(ctx context.Context, uid uuid.UUID, id string, revokedAt time.Time) error {
+	if err := m.primary.RevokeKey(ctx, uid, id, revokedAt); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if err := m.secondary.RevokeKey(ctx, uid, id, revokedAt); err != nil {
+		m.writeFailure("revoke_key", err)
+	}
+	return nil
+}
+
+// SaveAccount stores account in both stores
+func (m *Mirror) SaveAccount(ctx context.Context, account Account) error {
+	if err := m.primary.SaveAccount(ctx, account); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if err := m.secondary.SaveAccount(ctx, account); err != nil {
+		m.writeFailure("save_account", err)
+	}
+	return nil
+}
+
+// LoadAccount returns account from primary store
+func (m *Mirror) LoadAccount(ctx context.Context, email string) (account Account, err error) {
+	return m.primary.LoadAccount(ctx, email)
+}
+
+// LoadUserAccount returns account of user from primary store
+func (m *Mirror) LoadUserAccount(ctx context.Context, uid uuid.UUID) (account Account, err error) {
+	return m.primary.LoadUserAccount(ctx, uid)
+}
+
+// SetPassword replaces password of user account in both stores
+func (m *Mirror) SetPassword(ctx context.Context, uid uuid.UUID, passwordHash string) error {
+	if err := m.primary.SetPassword(ctx, uid, passwordHash); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if err := m.secondary.SetPassword(ctx, uid, passwordHash); err != nil {
+		m.writeFailure("set_password", err)
+	}
+	return nil
+}
+
+// RevokeSessions increments session epoch of user account in both stores
+func (m *Mirror) RevokeSessions(ctx context.Context, uid uuid.UUID) error {
+	if err := m.primary.RevokeSessions(ctx, uid); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if err := m.secondary.RevokeSessions(ctx, uid); err != nil {
+		m.writeFailure("revoke_sessions", err)
+	}
+	return nil
+}
+
+// SaveReport stores complaint about URL in both stores
+func (m *Mirror) SaveReport(ctx context.Context, report Report) error {
+	if err := m.primary.SaveReport(ctx, report); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if err := m.secondary.SaveReport(ctx, report); err != nil {
+		m.writeFailure("save_report", err)
+	}
+	return nil
+}
+
+// LoadReports returns complaints about URLs from primary store
+func (m *Mirror) LoadReports(ctx context.Context, id string) (reports []Report, err error) {
+	return m.primary.LoadReports(ctx, id)
+}
+
+// Disable takes URL down in both stores
+func (m *Mirror) Disable(ctx context.Context, id string, takedown Takedown) error {
+	if err := m.primary.Disable(ctx, id, takedown); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if err := m.secondary.Disable(ctx, id, takedown); err != nil {
+		m.writeFailure("disable", err)
+	}
+	return nil
+}
+
+// Enable brings URL back in both stores
+func (m *Mirror) Enable(ctx context.Context, id string) error {
+	if err := m.primary.Enable(ctx, id); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if err := m.secondary.Enable(ctx, id); err != nil {
+		m.writeFailure("enable", err)
+	}
+	return nil
+}
+
+// Ping checks primary store and logs secondary store failures
+func (m *Mirror) Ping(ctx context.Context) error {
+	if err := m.secondary.Ping(ctx); err != nil {
+		m.log.Printf("secondary store ping failed: %s", err)
+	}
+	return m.primary.Ping(ctx)
+}
+
+// Close waits for running comparisons and closes both stores
+func (m *Mirror) Close() error {
+	close(m.done)
+	m.running.Wait()
+	m.printStats("closing mirror")
+
+	perr := m.primary.Close()
+	serr := m.secondary.Close()
+	if perr != nil {
+		return perr
+	}
+	return serr
+}
+
+// restore replicates records written to primary store into secondary one
+func (m *Mirror) restore(ctx context.Context, op string, records ...Record) {
+	if len(records) == 0 {
+		return
+	}
+	atomic.AddInt64(&m.writes, 1)
+	if err := m.secondary.Restore(ctx, records...); err != nil {
+		m.writeFailure(op, err)
+	}
+}
+
+// records loads records written to primary store to replicate them with creation time and counters,
+// records failed to load are replicated as given
+func (m *Mirror) records(ctx context.Context, records ...Record) []Record {
+	res := make([]Record, 0, len(records))
+	for _, rec := range records {
+		loaded, err := m.primary.LoadRecord(ctx, rec.ID)
+		if err != nil {
+			m.log.Printf("cannot load record %s to mirror: %s", rec.ID, err)
+			res = append(res, rec)
+			continue
+		}
+		res = append(res, loaded)
+	}
+	return res
+}
+
+// check runs comparison of read with secondary store in background,
+// it is skipped if too many comparisons are running
+func (m *Mirror) check(compare func(ctx context.Context)) {
+	select {
+	case m.checks <- struct{}{}:
+	default:
+		atomic.AddInt64(&m.skippedChecks, 1)
+		return
+	}
+
+	m.running.Add(1)
+	go func() {
+		defer func() {
+			<-m.checks
+			m.running.Done()
+		}()
+		// request may be over before comparison
+		ctx, cancel := context.WithTimeout(context.Background(), mirrorCheckTimeout)
+		defer cancel()
+		compare(ctx)
+	}()
+}
+
+func (m *Mirror) writeFailure(op string, err error) {
+	atomic.AddInt64(&m.writeFailures, 1)
+	m.log.Printf("secondary write failed: op=%s: %s", op, err)
+}
+
+// compare records mismatch if stores resolve the same ID differently
+func (m *Mirror) compare(op, id string, u *url.URL, err error, su *url.URL, serr error) {
+	if err != nil || serr != nil {
+		if !sameError(err, serr) {
+			m.mismatch(op, id, fmt.Sprint(err), fmt.Sprint(serr))
+		}
+		return
+	}
+	if u.String() != su.String() {
+		m.mismatch(op, id, u.String(), su.String())
+	}
+}
+
+func (m *Mirror) mismatch(op, key, primary, secondary string) {
+	atomic.AddInt64(&m.mismatches, 1)
+	m.log.Printf("mismatch: op=%s key=%s primary=%q secondary=%q", op, key, primary, secondary)
+}
+
+// sameError reports whether both errors mean the same store state
+func sameError(err, serr error) bool {
+	for _, target := range []error{ErrNotFound, ErrDeleted} {
+		if errors.Is(err, target) || errors.Is(serr, target) {
+			return errors.Is(err, target) && errors.Is(serr, target)
+		}
+	}
+	return (err == nil) == (serr == nil)
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/url"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirror(t *testing.T) {
+	ctx := context.Background()
+	uid := uuid.Must(uuid.NewV4())
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+
+	primary := NewInMemory()
+	secondary := NewInMemory()
+
+	buf := bytes.NewBuffer(nil)
+	m := NewMirror(primary, secondary, log.New(buf, "", 0))
+
+	id, err := m.SaveUser(ctx, uid, u)
+	require.NoError(t, err)
+
+	su, err := secondary.LoadUser(ctx, uid, id)
+	require.NoError(t, err)
+	assert.Equal(t, u.String(), su.String())
+
+	// records are mirrored with their creation time
+	prec, err := primary.LoadRecord(ctx, id)
+	require.NoError(t, err)
+	srec, err := secondary.LoadRecord(ctx, id)
+	require.NoError(t, err)
+	assert.False(t, srec.CreatedAt.IsZero())
+	assert.Equal(t, prec.CreatedAt, srec.CreatedAt)
+
+	require.NoError(t, m.DeleteUsers(ctx, uid, id))
+	_, err = secondary.Load(ctx, id)
+	assert.ErrorIs(t, err, ErrDeleted)
+
+	// write bypassing mirror to make stores diverge
+	pid, err := primary.Save(ctx, u)
+	require.NoError(t, err)
+
+	lu, err := m.Load(ctx, pid)
+	require.NoError(t, err)
+	assert.Equal(t, u.String(), lu.String())
+
+	// reads are compared in background
+	m.running.Wait()
+	assert.Equal(t, MirrorStats{Writes: 2, Mismatches: 1}, m.Stats())
+	assert.Contains(t, buf.String(), "mismatch: op=load key="+pid)
+}
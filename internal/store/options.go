@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Options describes optional per-URL behaviour
+type Options struct {
+	// PasswordHash is a bcrypt hash of password required to follow URL
+	PasswordHash string `json:"password_hash,omitempty"`
+	// MaxClicks limits number of URL follows, zero means no limit
+	MaxClicks int `json:"max_clicks,omitempty"`
+	// ActiveFrom postpones URL activation, nil means active at once
+	ActiveFrom *time.Time `json:"active_from,omitempty"`
+	// Rules are checked in order to pick destination, URL itself is a fallback
+	Rules []Rule `json:"rules,omitempty"`
+	// Variants split follows between weighted destinations
+	Variants []Variant `json:"variants,omitempty"`
+	// StickyVariants keeps returning visitors on the same variant
+	StickyVariants bool `json:"sticky_variants,omitempty"`
+	// Passthrough appends request path suffix and query to destination
+	Passthrough bool `json:"passthrough,omitempty"`
+	// Template fills {name} placeholders of destination from request query
+	Template bool `json:"template,omitempty"`
+	// RedirectStatus is one of 301, 302, 307 or 308, zero means owner default
+	RedirectStatus int `json:"redirect_status,omitempty"`
+	// Interstitial shows preview page to every visitor instead of redirecting
+	Interstitial bool `json:"interstitial,omitempty"`
+}
+
+// Variant describes weighted destination of URL
+type Variant struct {
+	Target string `json:"target"`
+	Weight int    `json:"weight"`
+}
+
+// Rule describes conditional destination of URL.
+// Rule matches when all its non-empty conditions match.
+type Rule struct {
+	// Languages match Accept-Language tags, "en" matches "en-US" too
+	Languages []string `json:"languages,omitempty"`
+	// Devices match client device class: ios, android, mobile or desktop
+	Devices []string    `json:"devices,omitempty"`
+	Time    *TimeWindow `json:"time,omitempty"`
+	Target  string      `json:"target"`
+}
+
+// TimeWindow describes daily period of time, it spans midnight if From is after To
+type TimeWindow struct {
+	// From and To are formatted as 15:04
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Location is IANA time zone name, UTC if empty
+	Location string `json:"location,omitempty"`
+}
+
+// IsZero reports whether no options set
+func (o Options) IsZero() bool {
+	return o.PasswordHash == "" &&
+		o.MaxClicks == 0 &&
+		o.ActiveFrom == nil &&
+		len(o.Rules) == 0 &&
+		len(o.Variants) == 0 &&
+		!o.StickyVariants &&
+		!o.Passthrough &&
+		!o.Template &&
+		o.RedirectStatus == 0 &&
+		!o.Interstitial
+}
+
+// copyCounts returns copy of variant counters, nil for empty ones
+func copyCounts(counts map[int]int) map[int]int {
+	if len(counts) == 0 {
+		return nil
+	}
+	res := make(map[int]int, len(counts))
+	for k, v := range counts {
+		res[k] = v
+	}
+	return res
+}
+
+// Pending reports whether URL is not active yet at given time
+func (o Options) Pending(now time.Time) bool {
+	return o.ActiveFrom != nil && now.Before(*o.ActiveFrom)
+}
+
+// OptionsStore interface
+type OptionsStore interface {
+	// SaveUserOptions saves new user URL with options.
+	// URLs with options are never deduplicated.
+	SaveUserOptions(ctx context.Context, uid uuid.UUID, url *url.URL, opts Options) (id string, err error)
+	// SetOptions replaces options of user URL
+	SetOptions(ctx context.Context, uid uuid.UUID, id string, opts Options) error
+	// LoadRecord returns URL with its owner and options
+	LoadRecord(ctx context.Context, id string) (rec Record, err error)
+	// LoadUserOptions returns options of not deleted user URLs having them
+	LoadUserOptions(ctx context.Context, uid uuid.UUID) (opts map[string]Options, err error)
+	// LoadUserRecords returns user URLs with their options and creation time in order of their IDs,
+	// deleted ones included
+	LoadUserRecords(ctx context.Context, uid uuid.UUID) (records []Record, err error)
+	// Click atomically counts URL follow against its click limit.
+	// Returns ErrExhausted once limit has been reached.
+	Click(ctx context.Context, id string) error
+	// CountVariant counts URL follow to variant with given position
+	CountVariant(ctx context.Context, id string, variant int) error
+}
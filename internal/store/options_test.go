@@ -0,0 +1,140 @@
+package store
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClick(t *testing.T) {
+	ctx := context.Background()
+	uid := uuid.Must(uuid.NewV4())
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+
+	fileStore, err := NewFileStore(filepath.Join(t.TempDir(), "store.gob"))
+	require.NoError(t, err)
+	defer fileStore.Close()
+
+	stores := map[string]AuthStore{
+		"memory": NewInMemory(),
+		"file":   fileStore,
+	}
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			unlimited, err := s.SaveUser(ctx, uid, u)
+			require.NoError(t, err)
+			limited, err := s.SaveUserOptions(ctx, uid, u, Options{MaxClicks: 3})
+			require.NoError(t, err)
+
+			// concurrent follows never exceed limit
+			var ok int64
+			var wg sync.WaitGroup
+			for j := 0; j < 20; j++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					err := s.Click(ctx, limited)
+					if err == nil {
+						atomic.AddInt64(&ok, 1)
+						return
+					}
+					assert.ErrorIs(t, err, ErrExhausted)
+				}()
+			}
+			wg.Wait()
+			assert.Equal(t, int64(3), ok)
+
+			rec, err := s.LoadRecord(ctx, limited)
+			require.NoError(t, err)
+			assert.Equal(t, 3, rec.Clicks)
+
+			assert.NoError(t, s.Click(ctx, unlimited))
+			assert.ErrorIs(t, s.Click(ctx, "ololo"), ErrNotFound)
+		})
+	}
+}
+
+func TestUpdateUserOptions(t *testing.T) {
+	ctx := context.Background()
+	owner := uuid.Must(uuid.NewV4())
+	other := uuid.Must(uuid.NewV4())
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+	edited, _ := url.Parse("https://yandex.ru/")
+
+	fileStore, err := NewFileStore(filepath.Join(t.TempDir(), "store.gob"))
+	require.NoError(t, err)
+	defer fileStore.Close()
+
+	stores := map[string]AuthStore{
+		"memory": NewInMemory(),
+		"file":   fileStore,
+	}
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			protected, err := s.SaveUserOptions(ctx, owner, u, Options{PasswordHash: "hash"})
+			require.NoError(t, err)
+			_, err = s.UpdateUser(ctx, owner, protected, edited)
+			require.NoError(t, err)
+
+			// edited link with options is never given out to plain shortens of its URL
+			id, err := s.SaveUser(ctx, other, edited)
+			require.NoError(t, err)
+			assert.NotEqual(t, protected, id)
+
+			rec, err := s.LoadRecord(ctx, protected)
+			require.NoError(t, err)
+			assert.Equal(t, edited, rec.URL)
+			assert.Equal(t, "hash", rec.Options.PasswordHash)
+		})
+	}
+}
+
+func TestLoadUserRecords(t *testing.T) {
+	ctx := context.Background()
+	uid := uuid.Must(uuid.NewV4())
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+	other, _ := url.Parse("https://yandex.ru/")
+
+	fileStore, err := NewFileStore(filepath.Join(t.TempDir(), "store.gob"))
+	require.NoError(t, err)
+	defer fileStore.Close()
+
+	stores := map[string]AuthStore{
+		"memory": NewInMemory(),
+		"file":   fileStore,
+	}
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.LoadUserRecords(ctx, uid)
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			plain, err := s.SaveUser(ctx, uid, u)
+			require.NoError(t, err)
+			protected, err := s.SaveUserOptions(ctx, uid, other, Options{MaxClicks: 3})
+			require.NoError(t, err)
+			require.NoError(t, s.DeleteUsers(ctx, uid, plain))
+
+			records, err := s.LoadUserRecords(ctx, uid)
+			require.NoError(t, err)
+			require.Len(t, records, 2)
+
+			assert.Equal(t, plain, records[0].ID)
+			assert.True(t, records[0].Deleted)
+			assert.Equal(t, protected, records[1].ID)
+			assert.Equal(t, other, records[1].URL)
+			assert.Equal(t, &uid, records[1].UserID)
+			assert.Equal(t, 3, records[1].Options.MaxClicks)
+			assert.False(t, records[1].CreatedAt.IsZero())
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Usage describes amount of URLs owned by user
+type Usage struct {
+	// Active is a number of not deleted user URLs
+	Active int
+	// Created is a number of user URLs created since given time, deleted ones included
+	Created int
+}
+
+// UsageStore interface
+type UsageStore interface {
+	// UserUsage counts URLs of user, zero usage is returned for unknown user
+	UserUsage(ctx context.Context, uid uuid.UUID, since time.Time) (usage Usage, err error)
+}
+
+// kinds of user quota
+const (
+	QuotaActive = "active"
+	QuotaDaily  = "daily"
+)
+
+// Quota limits URLs saved for user, zero limit means no limit
+type Quota struct {
+	// Active limits number of not deleted URLs
+	Active int
+	// Daily limits number of URLs created since Since
+	Daily int
+	Since time.Time
+}
+
+// QuotaError is returned when URLs are refused to be saved as user has run out of quota
+type QuotaError struct {
+	Kind      string
+	Limit     int
+	Used      int
+	Requested int
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s quota exceeded: %d of %d URLs used, %d more requested", e.Kind, e.Used, e.Limit, e.Requested)
+}
+
+var ctxQuotaKey = struct{ name string }{"quota"}
+
+// QuotaContext returns context limiting URLs saved for user.
+// Stores check quota when saving user URLs so that concurrent requests cannot exceed it together.
+func QuotaContext(parent context.Context, quota Quota) context.Context {
+	return context.WithValue(parent, ctxQuotaKey, quota)
+}
+
+// checkQuota returns QuotaError if user may not save n more URLs under quota of context.
+// Usage is counted only if quota is set, caller must hold lock or transaction preventing concurrent saves.
+func checkQuota(ctx context.Context, n int, usage func(since time.Time) (Usage, error)) error {
+	quota, _ := ctx.Value(ctxQuotaKey).(Quota)
+	if quota.Active <= 0 && quota.Daily <= 0 {
+		return nil
+	}
+
+	used, err := usage(quota.Since)
+	if err != nil {
+		return fmt.Errorf("cannot count user URLs: %w", err)
+	}
+	if quota.Active > 0 && used.Active+n > quota.Active {
+		return &QuotaError{Kind: QuotaActive, Limit: quota.Active, Used: used.Active, Requested: n}
+	}
+	if quota.Daily > 0 && used.Created+n > quota.Daily {
+		return &QuotaError{Kind: QuotaDaily, Limit: quota.Daily, Used: used.Created, Requested: n}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserUsage(t *testing.T) {
+	ctx := context.Background()
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+	uid := uuid.Must(uuid.NewV4())
+
+	fileStore, err := NewFileStore(filepath.Join(t.TempDir(), "store.gob"))
+	require.NoError(t, err)
+
+	stores := map[string]AuthStore{
+		"memory": NewInMemory(),
+		"file":   fileStore,
+	}
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			usage, err := s.UserUsage(ctx, uid, time.Time{})
+			require.NoError(t, err)
+			assert.Equal(t, Usage{}, usage)
+
+			ids, err := s.SaveUserBatch(ctx, uid, []*url.URL{u, u, u})
+			require.NoError(t, err)
+			_, err = s.Save(ctx, u)
+			require.NoError(t, err)
+			require.NoError(t, s.DeleteUsers(ctx, uid, ids[0]))
+
+			usage, err = s.UserUsage(ctx, uid, time.Now().Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Equal(t, Usage{Active: 2, Created: 3}, usage)
+
+			usage, err = s.UserUsage(ctx, uid, time.Now().Add(time.Hour))
+			require.NoError(t, err)
+			assert.Equal(t, Usage{Active: 2, Created: 0}, usage)
+		})
+	}
+}
+
+func TestQuota(t *testing.T) {
+	u, _ := url.Parse("https://praktikum.yandex.ru/")
+	uid := uuid.Must(uuid.NewV4())
+	ctx := QuotaContext(context.Background(), Quota{Active: 5})
+
+	fileStore, err := NewFileStore(filepath.Join(t.TempDir(), "store.gob"))
+	require.NoError(t, err)
+
+	stores := map[string]AuthStore{
+		"memory": NewInMemory(),
+		"file":   fileStore,
+	}
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			// concurrent saves never exceed quota together
+			var wg sync.WaitGroup
+			for n := 0; n < 10; n++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, _ = s.SaveUser(ctx, uid, u)
+				}()
+			}
+			wg.Wait()
+
+			usage, err := s.UserUsage(ctx, uid, time.Time{})
+			require.NoError(t, err)
+			assert.Equal(t, 5, usage.Active)
+
+			_, err = s.SaveUserBatch(ctx, uid, []*url.URL{u})
+			var exceeded *QuotaError
+			require.ErrorAs(t, err, &exceeded)
+			assert.Equal(t, QuotaError{Kind: QuotaActive, Limit: 5, Used: 5, Requested: 1}, *exceeded)
+
+			_, err = s.SaveUserOptions(ctx, uid, u, Options{MaxClicks: 1})
+			assert.ErrorAs(t, err, &exceeded)
+
+			// saves without quota are not limited
+			_, err = s.SaveUser(context.Background(), uid, u)
+			assert.NoError(t, err)
+		})
+	}
+}
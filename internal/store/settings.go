@@ -0,0 +1,20 @@
+package store
+
+import (
+	"context"
+
+	"github.com/gofrs/uuid"
+)
+
+// UserSettings describes user defaults applied to all user URLs
+type UserSettings struct {
+	// RedirectStatus is used for user URLs without own status, zero means server default
+	RedirectStatus int `json:"redirect_status,omitempty"`
+}
+
+// SettingsStore interface
+type SettingsStore interface {
+	// LoadUserSettings returns zero settings for user who never saved them
+	LoadUserSettings(ctx context.Context, uid uuid.UUID) (settings UserSettings, err error)
+	SaveUserSettings(ctx context.Context, uid uuid.UUID, settings UserSettings) error
+}
@@ -3,9 +3,11 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -38,8 +40,81 @@ func (r *RDB) Bootstrap(ctx context.Context) error {
 		    deleted_at timestamp without time zone
 		);
 
+		-- IDs restored from other stores are not necessarily numeric
+		DO $$
+		BEGIN
+			IF (SELECT data_type FROM information_schema.columns WHERE table_name = 'urls' AND column_name = 'id') <> 'text' THEN
+				ALTER TABLE urls ALTER COLUMN id TYPE text;
+			END IF;
+		END $$;
+
+		-- restored duplicates of existing URLs are kept out of unique index
+		ALTER TABLE urls ADD COLUMN IF NOT EXISTS duplicate boolean NOT NULL DEFAULT false;
+		-- URLs with options are marked as duplicates to never be returned for plain shortening
+		ALTER TABLE urls ADD COLUMN IF NOT EXISTS options jsonb;
+		ALTER TABLE urls ADD COLUMN IF NOT EXISTS clicks integer NOT NULL DEFAULT 0;
+		ALTER TABLE urls ADD COLUMN IF NOT EXISTS variant_clicks jsonb NOT NULL DEFAULT '{}';
+		-- creation time of URLs saved before the column appeared is unknown
+		ALTER TABLE urls ADD COLUMN IF NOT EXISTS created_at timestamp with time zone;
+		ALTER TABLE urls ALTER COLUMN created_at SET DEFAULT NOW();
+		-- URLs taken down by administrator
+		ALTER TABLE urls ADD COLUMN IF NOT EXISTS disabled_at timestamp with time zone;
+		ALTER TABLE urls ADD COLUMN IF NOT EXISTS disabled_reason text;
+		ALTER TABLE urls ADD COLUMN IF NOT EXISTS disabled_legal boolean NOT NULL DEFAULT false;
+
 		CREATE INDEX IF NOT EXISTS user_id_idx ON urls (user_id);
-		CREATE UNIQUE INDEX IF NOT EXISTS original_url_idx ON urls (original_url) WHERE deleted_at IS NULL;
+		DROP INDEX IF EXISTS original_url_idx;
+		CREATE UNIQUE INDEX IF NOT EXISTS original_url_uniq_idx ON urls (original_url) WHERE deleted_at IS NULL AND NOT duplicate;
+
+		CREATE TABLE IF NOT EXISTS user_settings (
+			user_id uuid PRIMARY KEY,
+			settings jsonb NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS url_reports (
+			id serial PRIMARY KEY,
+			url_id text NOT NULL,
+			reason text NOT NULL,
+			client_ip text NOT NULL DEFAULT '',
+			created_at timestamp with time zone NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS url_reports_url_id_idx ON url_reports (url_id);
+
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id text PRIMARY KEY,
+			user_id uuid NOT NULL,
+			name text NOT NULL DEFAULT '',
+			hash bytea NOT NULL,
+			created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+			revoked_at timestamp with time zone
+		);
+		CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
+
+		CREATE TABLE IF NOT EXISTS accounts (
+			user_id uuid PRIMARY KEY,
+			email text NOT NULL UNIQUE,
+			password_hash text NOT NULL,
+			created_at timestamp with time zone NOT NULL DEFAULT NOW()
+		);
+		ALTER TABLE accounts ADD COLUMN IF NOT EXISTS session_epoch bigint NOT NULL DEFAULT 0;
+
+		CREATE TABLE IF NOT EXISTS transfers (
+			id text PRIMARY KEY,
+			from_user_id uuid NOT NULL,
+			to_user_id uuid,
+			url_ids text[] NOT NULL,
+			created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+			expires_at timestamp with time zone NOT NULL,
+			closed_at timestamp with time zone
+		);
+
+		CREATE TABLE IF NOT EXISTS url_history (
+			url_id text NOT NULL,
+			version integer NOT NULL,
+			original_url text NOT NULL,
+			created_at timestamp without time zone,
+			PRIMARY KEY (url_id, version)
+		);
 	`
 
 	tx, err := r.db.BeginTx(ctx, nil)
@@ -66,21 +141,19 @@ func (r *RDB) Save(ctx context.Context, url *url.URL) (id string, err error) {
 		    (original_url)
 		VALUES
 		    ($1)
-		ON CONFLICT (original_url) WHERE deleted_at IS NULL
+		ON CONFLICT (original_url) WHERE deleted_at IS NULL AND NOT duplicate
 		DO UPDATE SET updated_at = NOW()
 		RETURNING
 		    id,
 		    updated_at
 	`
 
-	var lid int64
 	var updatedAt *time.Time
-	err = r.db.QueryRowContext(ctx, query, url.String()).Scan(&lid, &updatedAt)
+	err = r.db.QueryRowContext(ctx, query, url.String()).Scan(&id, &updatedAt)
 	if err != nil {
 		return "", fmt.Errorf("cannot fetch conflict url: %w", err)
 	}
 
-	id = fmt.Sprint(lid)
 	if updatedAt != nil && !updatedAt.IsZero() {
 		err = ErrConflict
 	}
@@ -104,7 +177,7 @@ func (r *RDB) SaveBatch(ctx context.Context, urls []*url.URL) (ids []string, err
 		INSERT INTO urls
 			(original_url)
 		VALUES ` + insertValues + `
-		ON CONFLICT (original_url) WHERE deleted_at IS NULL
+		ON CONFLICT (original_url) WHERE deleted_at IS NULL AND NOT duplicate
 		DO UPDATE SET updated_at = NOW()
 		RETURNING id
 	`
@@ -116,11 +189,11 @@ func (r *RDB) SaveBatch(ctx context.Context, urls []*url.URL) (ids []string, err
 	defer rows.Close()
 
 	for rows.Next() {
-		var id int64
+		var id string
 		if err := rows.Scan(&id); err != nil {
 			return nil, fmt.Errorf("error scanning row: %w", err)
 		}
-		ids = append(ids, fmt.Sprint(id))
+		ids = append(ids, id)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -143,7 +216,7 @@ func (r *RDB) Load(ctx context.Context, id string) (url *url.URL, err error) {
 	err = r.db.QueryRowContext(ctx, query, id).Scan(&rawURL, &deletedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+			return nil, ErrNotFound
 		}
 		return nil, fmt.Errorf("cannot scan row: %w", err)
 	}
@@ -161,25 +234,26 @@ func (r *RDB) SaveUser(ctx context.Context, uid uuid.UUID, url *url.URL) (id str
 		    (original_url, user_id)
 		VALUES
 		    ($1, $2)
-		ON CONFLICT (original_url) WHERE deleted_at IS NULL
+		ON CONFLICT (original_url) WHERE deleted_at IS NULL AND NOT duplicate
 		DO UPDATE SET updated_at = NOW()
 		RETURNING
 		    id,
 		    updated_at
 	`
 
-	var lid int64
-	var updatedAt *time.Time
-	err = r.db.QueryRowContext(ctx, query, url.String(), uid).Scan(&lid, &updatedAt)
-	if err != nil {
-		return "", fmt.Errorf("cannot fetch conflict url: %w", err)
-	}
+	err = r.saveUser(ctx, uid, 1, func(q queryer) error {
+		var updatedAt *time.Time
+		err := q.QueryRowContext(ctx, query, url.String(), uid).Scan(&id, &updatedAt)
+		if err != nil {
+			return fmt.Errorf("cannot fetch conflict url: %w", err)
+		}
 
-	id = fmt.Sprint(lid)
-	if updatedAt != nil && !updatedAt.IsZero() {
-		err = ErrConflict
-	}
-	return
+		if updatedAt != nil && !updatedAt.IsZero() {
+			return ErrConflict
+		}
+		return nil
+	})
+	return id, err
 }
 
 // SaveUserBatch store user batch
@@ -199,29 +273,69 @@ func (r *RDB) SaveUserBatch(ctx context.Context, uid uuid.UUID, urls []*url.URL)
 
 	query := `INSERT INTO urls (original_url, user_id) VALUES ` + insertValues + ` RETURNING id;`
 
-	rows, err := r.db.QueryContext(ctx, query, args...)
+	err = r.saveUser(ctx, uid, len(urls), func(q queryer) error {
+		rows, err := q.QueryContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("query error: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				return fmt.Errorf("error scanning row: %w", err)
+			}
+			ids = append(ids, id)
+		}
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("cursor error: %w", err)
+		}
+
+		if len(ids) != len(urls) {
+			return errors.New("not all URLs have been saved")
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("query error: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
+	return ids, nil
+}
 
-	for rows.Next() {
-		var id int64
-		if err := rows.Scan(&id); err != nil {
-			return nil, fmt.Errorf("error scanning row: %w", err)
-		}
-		ids = append(ids, fmt.Sprint(id))
+// saveUser runs save of n user URLs checking quota of context first.
+// Without quota save runs as is, otherwise in transaction holding advisory lock of user
+// so that concurrent saves of user are counted one by one.
+// ErrConflict returned by save is passed through keeping saved data.
+func (r *RDB) saveUser(ctx context.Context, uid uuid.UUID, n int, save func(q queryer) error) error {
+	if quota, _ := ctx.Value(ctxQuotaKey).(Quota); quota.Active <= 0 && quota.Daily <= 0 {
+		return save(r.db)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("cursor error: %w", err)
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot start transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	if len(ids) != len(urls) {
-		return nil, errors.New("not all URLs have been saved")
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, uid.String()); err != nil {
+		return fmt.Errorf("cannot lock user: %w", err)
+	}
+	err = checkQuota(ctx, n, func(since time.Time) (Usage, error) {
+		return userUsage(ctx, tx, uid, since)
+	})
+	if err != nil {
+		return err
 	}
 
-	return ids, nil
+	saveErr := save(tx)
+	if saveErr != nil && !errors.Is(saveErr, ErrConflict) {
+		return saveErr
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	return saveErr
 }
 
 // LoadUser load user
@@ -233,7 +347,7 @@ func (r *RDB) LoadUser(ctx context.Context, uid uuid.UUID, id string) (url *url.
 	err = r.db.QueryRowContext(ctx, query, id, uid).Scan(&rawURL, &deletedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+			return nil, ErrNotFound
 		}
 		return nil, fmt.Errorf("cannot scan row: %w", err)
 	}
@@ -256,7 +370,7 @@ func (r *RDB) LoadUsers(ctx context.Context, uid uuid.UUID) (urls map[string]*ur
 
 	res := make(map[string]*url.URL)
 	for rows.Next() {
-		var id int64
+		var id string
 		var rawURL string
 
 		if err := rows.Scan(&id, &rawURL); err != nil {
@@ -267,7 +381,7 @@ func (r *RDB) LoadUsers(ctx context.Context, uid uuid.UUID) (urls map[string]*ur
 			return nil, fmt.Errorf("cannot parse URL: %w", err)
 		}
 
-		res[fmt.Sprint(id)] = u
+		res[id] = u
 	}
 
 	if err := rows.Err(); err != nil {
@@ -289,6 +403,1368 @@ func (r *RDB) DeleteUsers(ctx context.Context, uid uuid.UUID, ids ...string) err
 	return err
 }
 
+// TransferUsers moves user URLs to another user in DB
+func (r *RDB) TransferUsers(ctx context.Context, from, to uuid.UUID, ids ...string) (moved []string, err error) {
+	return transferUsers(ctx, r.db, from, to, ids)
+}
+
+// queryer is implemented by both sql.DB and sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// transferUsers moves not deleted user URLs to another user
+func transferUsers(ctx context.Context, q queryer, from, to uuid.UUID, ids []string) (moved []string, err error) {
+	arr := new(pgtype.VarcharArray)
+	if err := arr.Set(ids); err != nil {
+		return nil, fmt.Errorf("cannot set ids to pg variable: %w", err)
+	}
+
+	query := `UPDATE urls SET user_id = $1 WHERE user_id = $2 AND id = ANY($3) AND deleted_at IS NULL RETURNING id;`
+
+	rows, err := q.QueryContext(ctx, query, to, from, arr)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		moved = append(moved, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+	return moved, nil
+}
+
+// SaveTransfer stores transfer in DB
+func (r *RDB) SaveTransfer(ctx context.Context, transfer Transfer) error {
+	arr := new(pgtype.VarcharArray)
+	if err := arr.Set(transfer.IDs); err != nil {
+		return fmt.Errorf("cannot set ids to pg variable: %w", err)
+	}
+
+	query := `
+		INSERT INTO transfers
+			(id, from_user_id, to_user_id, url_ids, created_at, expires_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO NOTHING
+	`
+	res, err := r.db.ExecContext(ctx, query,
+		transfer.ID, transfer.From, transfer.To, arr, transfer.CreatedAt, transfer.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("cannot save transfer: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot get affected rows: %w", err)
+	}
+	if n == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// LoadTransfer returns transfer from DB
+func (r *RDB) LoadTransfer(ctx context.Context, id string) (transfer Transfer, err error) {
+	query := `
+		SELECT id, from_user_id, to_user_id, url_ids, created_at, expires_at, closed_at
+		FROM transfers
+		WHERE id = $1
+	`
+	return scanTransfer(r.db.QueryRowContext(ctx, query, id))
+}
+
+// AcceptTransfer closes transfer and moves its URLs in DB
+func (r *RDB) AcceptTransfer(ctx context.Context, id string, to uuid.UUID, acceptedAt time.Time) (moved []string, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id, from_user_id, to_user_id, url_ids, created_at, expires_at, closed_at
+		FROM transfers
+		WHERE id = $1
+		FOR UPDATE
+	`
+	transfer, err := scanTransfer(tx.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, err
+	}
+	if transfer.ClosedAt != nil {
+		return nil, ErrDeleted
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE transfers SET closed_at = $2 WHERE id = $1`, id, acceptedAt); err != nil {
+		return nil, fmt.Errorf("cannot close transfer: %w", err)
+	}
+	if moved, err = transferUsers(ctx, tx, transfer.From, to, transfer.IDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	return moved, nil
+}
+
+// CancelTransfer closes transfer of user in DB
+func (r *RDB) CancelTransfer(ctx context.Context, uid uuid.UUID, id string, cancelledAt time.Time) error {
+	query := `UPDATE transfers SET closed_at = $3 WHERE id = $1 AND from_user_id = $2 AND closed_at IS NULL`
+	res, err := r.db.ExecContext(ctx, query, id, uid, cancelledAt)
+	if err != nil {
+		return fmt.Errorf("cannot cancel transfer: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot get affected rows: %w", err)
+	}
+	if n == 0 {
+		// tell missing transfer from closed one
+		transfer, err := r.LoadTransfer(ctx, id)
+		if err != nil {
+			return err
+		}
+		if transfer.From != uid {
+			return ErrNotFound
+		}
+		return ErrDeleted
+	}
+	return nil
+}
+
+// scanTransfer reads transfer from row
+func scanTransfer(row rowScanner) (transfer Transfer, err error) {
+	var to uuid.NullUUID
+	var ids pgtype.VarcharArray
+	var closedAt sql.NullTime
+
+	err = row.Scan(&transfer.ID, &transfer.From, &to, &ids, &transfer.CreatedAt, &transfer.ExpiresAt, &closedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return transfer, ErrNotFound
+	}
+	if err != nil {
+		return transfer, fmt.Errorf("cannot scan row: %w", err)
+	}
+	if err := ids.AssignTo(&transfer.IDs); err != nil {
+		return transfer, fmt.Errorf("cannot decode URL IDs: %w", err)
+	}
+	if to.Valid {
+		transfer.To = &to.UUID
+	}
+	if closedAt.Valid {
+		transfer.ClosedAt = &closedAt.Time
+	}
+	return transfer, nil
+}
+
+// UpdateUser changes destination of user URL in DB
+func (r *RDB) UpdateUser(ctx context.Context, uid uuid.UUID, id string, u *url.URL) (version int, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("cannot start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current string
+	var deletedAt *time.Time
+	query := `SELECT original_url, deleted_at FROM urls WHERE id = $1 AND user_id = $2 FOR UPDATE;`
+	err = tx.QueryRowContext(ctx, query, id, uid).Scan(&current, &deletedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, fmt.Errorf("cannot scan row: %w", err)
+	}
+	if deletedAt != nil {
+		return 0, ErrDeleted
+	}
+
+	// keep current destination as the first version
+	query = `
+		INSERT INTO url_history
+			(url_id, version, original_url)
+		VALUES
+			($1, 1, $2)
+		ON CONFLICT (url_id, version) DO NOTHING
+	`
+	if _, err = tx.ExecContext(ctx, query, id, current); err != nil {
+		return 0, fmt.Errorf("cannot save first version: %w", err)
+	}
+
+	query = `
+		INSERT INTO url_history
+			(url_id, version, original_url, created_at)
+		SELECT $1, MAX(version) + 1, $2, NOW()
+		FROM url_history
+		WHERE url_id = $1
+		RETURNING version
+	`
+	if err = tx.QueryRowContext(ctx, query, id, u.String()).Scan(&version); err != nil {
+		return 0, fmt.Errorf("cannot save new version: %w", err)
+	}
+
+	// URL may already be shortened in another record, links with options are never deduplicated to
+	query = `
+		UPDATE urls
+		SET
+			original_url = $2,
+			duplicate = options IS NOT NULL OR EXISTS (
+				SELECT 1 FROM urls WHERE original_url = $2 AND deleted_at IS NULL AND NOT duplicate AND id <> $1
+			)
+		WHERE id = $1
+	`
+	if _, err = tx.ExecContext(ctx, query, id, u.String()); err != nil {
+		return 0, fmt.Errorf("cannot update URL: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	return version, nil
+}
+
+// History returns all destinations of user URL from DB
+func (r *RDB) History(ctx context.Context, uid uuid.UUID, id string) (versions []Version, err error) {
+	current, err := r.LoadUser(ctx, uid, id)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT version, original_url, created_at FROM url_history WHERE url_id = $1 ORDER BY version;`
+
+	rows, err := r.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query rows: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v Version
+		var rawURL string
+		var createdAt *time.Time
+
+		if err := rows.Scan(&v.Number, &rawURL, &createdAt); err != nil {
+			return nil, fmt.Errorf("cannot scan row: %w", err)
+		}
+		if v.URL, err = url.Parse(rawURL); err != nil {
+			return nil, fmt.Errorf("cannot parse URL: %w", err)
+		}
+		if createdAt != nil {
+			v.CreatedAt = *createdAt
+		}
+		versions = append(versions, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return currentHistory(versions, current), nil
+}
+
+// Records walks over all rows in DB
+func (r *RDB) Records(ctx context.Context, fn func(rec Record) error) error {
+	query := `
+		SELECT
+			id, original_url, user_id, deleted_at, options, clicks, variant_clicks, created_at,
+			disabled_at, disabled_reason, disabled_legal,
+			(
+				SELECT json_agg(json_build_object(
+					'number', version,
+					'url', original_url,
+					'created_at', (extract(epoch FROM created_at) * 1000000)::bigint
+				) ORDER BY version)
+				FROM url_history
+				WHERE url_id = urls.id
+			),
+			(
+				SELECT json_agg(json_build_object(
+					'reason', reason,
+					'client_ip', client_ip,
+					'created_at', (extract(epoch FROM created_at) * 1000000)::bigint
+				) ORDER BY id)
+				FROM url_reports
+				WHERE url_id = urls.id
+			)
+		FROM urls
+		ORDER BY length(id), id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("cannot query rows: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rec Record
+		var rawURL sql.NullString
+		var userID uuid.NullUUID
+		var deletedAt *time.Time
+		var rawOptions sql.NullString
+		var rawVariantClicks string
+		var createdAt *time.Time
+		var disabledAt *time.Time
+		var disabledReason sql.NullString
+		var disabledLegal bool
+		var rawHistory, rawReports sql.NullString
+
+		err := rows.Scan(&rec.ID, &rawURL, &userID, &deletedAt, &rawOptions, &rec.Clicks, &rawVariantClicks, &createdAt,
+			&disabledAt, &disabledReason, &disabledLegal, &rawHistory, &rawReports)
+		if err != nil {
+			return fmt.Errorf("cannot scan row: %w", err)
+		}
+		if rec.History, err = decodeHistory(rawHistory); err != nil {
+			return err
+		}
+		if rec.Reports, err = decodeReports(rec.ID, rawReports); err != nil {
+			return err
+		}
+		rec.Disabled = scanTakedown(disabledAt, disabledReason, disabledLegal)
+		if createdAt != nil {
+			rec.CreatedAt = *createdAt
+		}
+		if rec.VariantClicks, err = decodeVariantClicks(rawVariantClicks); err != nil {
+			return err
+		}
+		if rec.Options, err = decodeOptions(rawOptions); err != nil {
+			return err
+		}
+		if rawURL.Valid {
+			rec.URL, err = url.Parse(rawURL.String)
+			if err != nil {
+				return fmt.Errorf("cannot parse URL: %w", err)
+			}
+		}
+		if userID.Valid {
+			rec.UserID = &userID.UUID
+		}
+		rec.Deleted = deletedAt != nil
+
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows error: %w", err)
+	}
+	return nil
+}
+
+// Restore saves records to DB preserving their IDs
+func (r *RDB) Restore(ctx context.Context, records ...Record) error {
+	query := `
+		INSERT INTO urls
+			(id, original_url, user_id, deleted_at, options, clicks, variant_clicks, created_at,
+			disabled_at, disabled_reason, disabled_legal, duplicate)
+		VALUES
+			($1, $2, $3, CASE WHEN $4 THEN NOW() END, $5::jsonb, $6, $7::jsonb, $8,
+			$9, $10, $11, $5::jsonb IS NOT NULL OR NOT $4 AND EXISTS (
+				SELECT 1 FROM urls WHERE original_url = $2 AND deleted_at IS NULL AND NOT duplicate AND id <> $1
+			))
+		ON CONFLICT (id)
+		DO UPDATE SET
+			original_url = EXCLUDED.original_url,
+			user_id = EXCLUDED.user_id,
+			deleted_at = EXCLUDED.deleted_at,
+			options = EXCLUDED.options,
+			clicks = EXCLUDED.clicks,
+			variant_clicks = EXCLUDED.variant_clicks,
+			created_at = EXCLUDED.created_at,
+			disabled_at = EXCLUDED.disabled_at,
+			disabled_reason = EXCLUDED.disabled_reason,
+			disabled_legal = EXCLUDED.disabled_legal,
+			duplicate = EXCLUDED.duplicate
+	`
+	// move sequence past restored numeric IDs to keep new IDs unique
+	seqQuery := `
+		SELECT setval(pg_get_serial_sequence('urls', 'id'), MAX(id::bigint))
+		FROM urls
+		WHERE id ~ '^[0-9]{1,18}$'
+	`
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, rec := range records {
+		var rawURL *string
+		if rec.URL != nil {
+			s := rec.URL.String()
+			rawURL = &s
+		}
+		rawOptions, err := encodeOptions(rec.Options)
+		if err != nil {
+			return err
+		}
+		rawVariantClicks, err := json.Marshal(rec.VariantClicks)
+		if err != nil {
+			return fmt.Errorf("cannot encode variant clicks: %w", err)
+		}
+		if rec.VariantClicks == nil {
+			rawVariantClicks = []byte("{}")
+		}
+		var createdAt *time.Time
+		if !rec.CreatedAt.IsZero() {
+			createdAt = &rec.CreatedAt
+		}
+		var disabledAt *time.Time
+		var disabledReason *string
+		var disabledLegal bool
+		if rec.Disabled != nil {
+			disabledAt = &rec.Disabled.DisabledAt
+			disabledReason = &rec.Disabled.Reason
+			disabledLegal = rec.Disabled.Legal
+		}
+		_, err = tx.ExecContext(ctx, query,
+			rec.ID, rawURL, rec.UserID, rec.Deleted, rawOptions, rec.Clicks, string(rawVariantClicks), createdAt,
+			disabledAt, disabledReason, disabledLegal)
+		if err != nil {
+			return fmt.Errorf("cannot restore record %s: %w", rec.ID, err)
+		}
+		if err := restoreHistory(ctx, tx, rec.ID, rec.History); err != nil {
+			return err
+		}
+		if err := restoreReports(ctx, tx, rec.ID, rec.Reports); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, seqQuery); err != nil {
+		return fmt.Errorf("cannot update id sequence: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	return nil
+}
+
+// restoreHistory replaces history of URL in DB
+func restoreHistory(ctx context.Context, tx *sql.Tx, id string, history []Version) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM url_history WHERE url_id = $1`, id); err != nil {
+		return fmt.Errorf("cannot clear history of record %s: %w", id, err)
+	}
+
+	query := `
+		INSERT INTO url_history
+			(url_id, version, original_url, created_at)
+		VALUES
+			($1, $2, $3, $4)
+	`
+	for _, v := range history {
+		var createdAt *time.Time
+		if !v.CreatedAt.IsZero() {
+			createdAt = &v.CreatedAt
+		}
+		if _, err := tx.ExecContext(ctx, query, id, v.Number, v.URL.String(), createdAt); err != nil {
+			return fmt.Errorf("cannot restore version %d of record %s: %w", v.Number, id, err)
+		}
+	}
+	return nil
+}
+
+// restoreReports replaces complaints about URL in DB
+func restoreReports(ctx context.Context, tx *sql.Tx, id string, reports []Report) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM url_reports WHERE url_id = $1`, id); err != nil {
+		return fmt.Errorf("cannot clear reports of record %s: %w", id, err)
+	}
+
+	query := `
+		INSERT INTO url_reports
+			(url_id, reason, client_ip, created_at)
+		VALUES
+			($1, $2, $3, $4)
+	`
+	for _, report := range reports {
+		if _, err := tx.ExecContext(ctx, query, id, report.Reason, report.ClientIP, report.CreatedAt); err != nil {
+			return fmt.Errorf("cannot restore report of record %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// Users walks over users having settings, API keys or account in DB
+func (r *RDB) Users(ctx context.Context, fn func(user User) error) error {
+	query := `
+		SELECT user_id FROM user_settings
+		UNION SELECT user_id FROM api_keys
+		UNION SELECT user_id FROM accounts
+		ORDER BY user_id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("cannot query rows: %w", err)
+	}
+	defer rows.Close()
+
+	// users are loaded once all uids are read to not hold two connections at once
+	var uids []uuid.UUID
+	for rows.Next() {
+		var uid uuid.UUID
+		if err := rows.Scan(&uid); err != nil {
+			return fmt.Errorf("cannot scan row: %w", err)
+		}
+		uids = append(uids, uid)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows error: %w", err)
+	}
+	rows.Close()
+
+	for _, uid := range uids {
+		user := User{ID: uid}
+		if user.Settings, err = r.LoadUserSettings(ctx, uid); err != nil {
+			return err
+		}
+		if user.Keys, err = r.LoadUserKeys(ctx, uid); err != nil {
+			return err
+		}
+		account, err := r.LoadUserAccount(ctx, uid)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if err == nil {
+			user.Account = &account
+		}
+		if user.IsZero() {
+			continue
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreUsers saves users state to DB
+func (r *RDB) RestoreUsers(ctx context.Context, users ...User) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, user := range users {
+		if err := restoreUserTx(ctx, tx, user); err != nil {
+			return fmt.Errorf("cannot restore user %s: %w", user.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	return nil
+}
+
+// restoreUserTx replaces settings, API keys and account of user in DB
+func restoreUserTx(ctx context.Context, tx *sql.Tx, user User) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_settings WHERE user_id = $1`, user.ID); err != nil {
+		return fmt.Errorf("cannot clear settings: %w", err)
+	}
+	if user.Settings != (UserSettings{}) {
+		raw, err := json.Marshal(user.Settings)
+		if err != nil {
+			return fmt.Errorf("cannot encode settings: %w", err)
+		}
+		query := `INSERT INTO user_settings (user_id, settings) VALUES ($1, $2::jsonb)`
+		if _, err := tx.ExecContext(ctx, query, user.ID, string(raw)); err != nil {
+			return fmt.Errorf("cannot save settings: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM api_keys WHERE user_id = $1`, user.ID); err != nil {
+		return fmt.Errorf("cannot clear API keys: %w", err)
+	}
+	query := `
+		INSERT INTO api_keys
+			(id, user_id, name, hash, created_at, revoked_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id)
+		DO UPDATE SET
+			user_id = EXCLUDED.user_id,
+			name = EXCLUDED.name,
+			hash = EXCLUDED.hash,
+			created_at = EXCLUDED.created_at,
+			revoked_at = EXCLUDED.revoked_at
+	`
+	for _, key := range user.Keys {
+		if _, err := tx.ExecContext(ctx, query, key.ID, user.ID, key.Name, key.Hash, key.CreatedAt, key.RevokedAt); err != nil {
+			return fmt.Errorf("cannot save API key %s: %w", key.ID, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM accounts WHERE user_id = $1`, user.ID); err != nil {
+		return fmt.Errorf("cannot clear account: %w", err)
+	}
+	if user.Account == nil {
+		return nil
+	}
+	query = `
+		INSERT INTO accounts
+			(user_id, email, password_hash, created_at, session_epoch)
+		VALUES
+			($1, $2, $3, $4, $5)
+		ON CONFLICT (email)
+		DO UPDATE SET
+			user_id = EXCLUDED.user_id,
+			password_hash = EXCLUDED.password_hash,
+			created_at = EXCLUDED.created_at,
+			session_epoch = EXCLUDED.session_epoch
+	`
+	_, err := tx.ExecContext(ctx, query, user.ID, user.Account.Email, user.Account.PasswordHash, user.Account.CreatedAt, user.Account.SessionEpoch)
+	if err != nil {
+		return fmt.Errorf("cannot save account: %w", err)
+	}
+	return nil
+}
+
+// SaveUserOptions store user URL with options bypassing deduplication
+func (r *RDB) SaveUserOptions(ctx context.Context, uid uuid.UUID, url *url.URL, opts Options) (id string, err error) {
+	rawOptions, err := encodeOptions(opts)
+	if err != nil {
+		return "", err
+	}
+
+	query := `
+		INSERT INTO urls
+			(original_url, user_id, options, duplicate)
+		VALUES
+			($1, $2, $3::jsonb, true)
+		RETURNING id
+	`
+	err = r.saveUser(ctx, uid, 1, func(q queryer) error {
+		if err := q.QueryRowContext(ctx, query, url.String(), uid, rawOptions).Scan(&id); err != nil {
+			return fmt.Errorf("cannot insert url: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// SetOptions replaces options of user URL in DB
+func (r *RDB) SetOptions(ctx context.Context, uid uuid.UUID, id string, opts Options) error {
+	rawOptions, err := encodeOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	// once URL got options it stays out of deduplication
+	query := `
+		UPDATE urls
+		SET
+			options = $3::jsonb,
+			duplicate = duplicate OR $3::jsonb IS NOT NULL
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+	`
+	res, err := r.db.ExecContext(ctx, query, id, uid, rawOptions)
+	if err != nil {
+		return fmt.Errorf("cannot update options: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot get affected rows: %w", err)
+	}
+	if n == 0 {
+		// tell missing URL from deleted one
+		_, err := r.LoadUser(ctx, uid, id)
+		if err == nil {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// LoadRecord returns URL with its owner and options from DB
+func (r *RDB) LoadRecord(ctx context.Context, id string) (rec Record, err error) {
+	var rawURL string
+	var userID uuid.NullUUID
+	var deletedAt *time.Time
+	var rawOptions sql.NullString
+	var clicks int
+	var rawVariantClicks string
+	var createdAt *time.Time
+	var disabledAt *time.Time
+	var disabledReason sql.NullString
+	var disabledLegal bool
+	query := `
+		SELECT
+			original_url, user_id, deleted_at, options, clicks, variant_clicks, created_at,
+			disabled_at, disabled_reason, disabled_legal
+		FROM urls
+		WHERE id = $1
+	`
+
+	err = r.db.QueryRowContext(ctx, query, id).
+		Scan(&rawURL, &userID, &deletedAt, &rawOptions, &clicks, &rawVariantClicks, &createdAt,
+			&disabledAt, &disabledReason, &disabledLegal)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Record{}, ErrNotFound
+		}
+		return Record{}, fmt.Errorf("cannot scan row: %w", err)
+	}
+	if deletedAt != nil {
+		return Record{}, ErrDeleted
+	}
+
+	rec = Record{
+		ID:       id,
+		Clicks:   clicks,
+		Disabled: scanTakedown(disabledAt, disabledReason, disabledLegal),
+	}
+	if createdAt != nil {
+		rec.CreatedAt = *createdAt
+	}
+	if rec.URL, err = url.Parse(rawURL); err != nil {
+		return Record{}, fmt.Errorf("cannot parse URL: %w", err)
+	}
+	if userID.Valid {
+		rec.UserID = &userID.UUID
+	}
+	if rec.Options, err = decodeOptions(rawOptions); err != nil {
+		return Record{}, err
+	}
+	if rec.VariantClicks, err = decodeVariantClicks(rawVariantClicks); err != nil {
+		return Record{}, err
+	}
+	return rec, nil
+}
+
+// LoadUserOptions returns options of user URLs from DB
+func (r *RDB) LoadUserOptions(ctx context.Context, uid uuid.UUID) (opts map[string]Options, err error) {
+	query := `SELECT id, options FROM urls WHERE user_id = $1 AND deleted_at IS NULL AND options IS NOT NULL;`
+
+	rows, err := r.db.QueryContext(ctx, query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query rows: %w", err)
+	}
+	defer rows.Close()
+
+	opts = make(map[string]Options)
+	for rows.Next() {
+		var id string
+		var rawOptions sql.NullString
+
+		if err := rows.Scan(&id, &rawOptions); err != nil {
+			return nil, fmt.Errorf("cannot scan row: %w", err)
+		}
+		if opts[id], err = decodeOptions(rawOptions); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return opts, nil
+}
+
+// LoadUserRecords returns user URLs with their metadata from DB
+func (r *RDB) LoadUserRecords(ctx context.Context, uid uuid.UUID) (records []Record, err error) {
+	query := `
+		SELECT id, original_url, deleted_at, options, clicks, created_at, disabled_at, disabled_reason, disabled_legal
+		FROM urls
+		WHERE user_id = $1
+		ORDER BY length(id), id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query rows: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rec := Record{UserID: &uid}
+		var rawURL sql.NullString
+		var deletedAt *time.Time
+		var rawOptions sql.NullString
+		var createdAt *time.Time
+		var disabledAt *time.Time
+		var disabledReason sql.NullString
+		var disabledLegal bool
+
+		err := rows.Scan(&rec.ID, &rawURL, &deletedAt, &rawOptions, &rec.Clicks, &createdAt,
+			&disabledAt, &disabledReason, &disabledLegal)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan row: %w", err)
+		}
+		if rawURL.Valid {
+			if rec.URL, err = url.Parse(rawURL.String); err != nil {
+				return nil, fmt.Errorf("cannot parse URL: %w", err)
+			}
+		}
+		if rec.Options, err = decodeOptions(rawOptions); err != nil {
+			return nil, err
+		}
+		if createdAt != nil {
+			rec.CreatedAt = *createdAt
+		}
+		rec.Deleted = deletedAt != nil
+		rec.Disabled = scanTakedown(disabledAt, disabledReason, disabledLegal)
+		records = append(records, rec)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound
+	}
+	return records, nil
+}
+
+// Click counts URL follow in DB
+func (r *RDB) Click(ctx context.Context, id string) error {
+	// single conditional update keeps concurrent follows from exceeding limit
+	query := `
+		UPDATE urls
+		SET clicks = clicks + 1
+		WHERE id = $1
+			AND deleted_at IS NULL
+			AND (options->>'max_clicks')::integer > 0
+			AND clicks < (options->>'max_clicks')::integer
+		RETURNING clicks
+	`
+
+	var clicks int
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&clicks)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("cannot count click: %w", err)
+	}
+
+	// tell unlimited URL from exhausted one
+	rec, err := r.LoadRecord(ctx, id)
+	if err != nil {
+		return err
+	}
+	if rec.Options.MaxClicks > 0 {
+		return ErrExhausted
+	}
+	return nil
+}
+
+// CountVariant counts URL variant follow in DB
+func (r *RDB) CountVariant(ctx context.Context, id string, variant int) error {
+	query := `
+		UPDATE urls
+		SET variant_clicks = jsonb_set(
+			variant_clicks,
+			ARRAY[$2::text],
+			to_jsonb(COALESCE((variant_clicks->>$2::text)::integer, 0) + 1)
+		)
+		WHERE id = $1
+	`
+	res, err := r.db.ExecContext(ctx, query, id, strconv.Itoa(variant))
+	if err != nil {
+		return fmt.Errorf("cannot count variant click: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot get affected rows: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// LoadUserSettings returns user settings from DB
+func (r *RDB) LoadUserSettings(ctx context.Context, uid uuid.UUID) (settings UserSettings, err error) {
+	var raw string
+	query := `SELECT settings FROM user_settings WHERE user_id = $1;`
+
+	err = r.db.QueryRowContext(ctx, query, uid).Scan(&raw)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return settings, nil
+		}
+		return settings, fmt.Errorf("cannot scan row: %w", err)
+	}
+	if err := json.Unmarshal([]byte(raw), &settings); err != nil {
+		return settings, fmt.Errorf("cannot decode settings: %w", err)
+	}
+	return settings, nil
+}
+
+// SaveUserSettings stores user settings in DB
+func (r *RDB) SaveUserSettings(ctx context.Context, uid uuid.UUID, settings UserSettings) error {
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("cannot encode settings: %w", err)
+	}
+
+	query := `
+		INSERT INTO user_settings
+			(user_id, settings)
+		VALUES
+			($1, $2::jsonb)
+		ON CONFLICT (user_id)
+		DO UPDATE SET settings = EXCLUDED.settings
+	`
+	if _, err := r.db.ExecContext(ctx, query, uid, string(raw)); err != nil {
+		return fmt.Errorf("cannot save settings: %w", err)
+	}
+	return nil
+}
+
+// UserUsage counts user URLs in DB
+func (r *RDB) UserUsage(ctx context.Context, uid uuid.UUID, since time.Time) (usage Usage, err error) {
+	return userUsage(ctx, r.db, uid, since)
+}
+
+// userUsage counts user URLs
+func userUsage(ctx context.Context, q queryer, uid uuid.UUID, since time.Time) (usage Usage, err error) {
+	query := `
+		SELECT
+			COUNT(*) FILTER (WHERE deleted_at IS NULL),
+			COUNT(*) FILTER (WHERE created_at >= $2)
+		FROM urls
+		WHERE user_id = $1
+	`
+
+	err = q.QueryRowContext(ctx, query, uid, since).Scan(&usage.Active, &usage.Created)
+	if err != nil {
+		return usage, fmt.Errorf("cannot scan row: %w", err)
+	}
+	return usage, nil
+}
+
+// SaveKey stores API key in DB
+func (r *RDB) SaveKey(ctx context.Context, key APIKey) error {
+	query := `
+		INSERT INTO api_keys
+			(id, user_id, name, hash, created_at)
+		VALUES
+			($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO NOTHING
+	`
+	res, err := r.db.ExecContext(ctx, query, key.ID, key.UserID, key.Name, key.Hash, key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("cannot save API key: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot get affected rows: %w", err)
+	}
+	if n == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// LoadKey returns API key from DB
+func (r *RDB) LoadKey(ctx context.Context, id string) (key APIKey, err error) {
+	query := `SELECT id, user_id, name, hash, created_at, revoked_at FROM api_keys WHERE id = $1`
+
+	key, err = scanKey(r.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, ErrNotFound
+	}
+	if err != nil {
+		return key, fmt.Errorf("cannot scan row: %w", err)
+	}
+	return key, nil
+}
+
+// LoadUserKeys returns user API keys from DB
+func (r *RDB) LoadUserKeys(ctx context.Context, uid uuid.UUID) (keys []APIKey, err error) {
+	query := `
+		SELECT id, user_id, name, hash, created_at, revoked_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query rows: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan row: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeKey revokes user API key in DB
+func (r *RDB) RevokeKey(ctx context.Context, uid uuid.UUID, id string, revokedAt time.Time) error {
+	query := `
+		UPDATE api_keys
+		SET revoked_at = $3
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+	res, err := r.db.ExecContext(ctx, query, id, uid, revokedAt)
+	if err != nil {
+		return fmt.Errorf("cannot revoke API key: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot get affected rows: %w", err)
+	}
+	if n == 0 {
+		// tell missing key from revoked one
+		key, err := r.LoadKey(ctx, id)
+		if err != nil {
+			return err
+		}
+		if key.UserID != uid {
+			return ErrNotFound
+		}
+		return ErrDeleted
+	}
+	return nil
+}
+
+// rowScanner is implemented by both sql.Row and sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanKey reads API key from row
+func scanKey(row rowScanner) (key APIKey, err error) {
+	var revokedAt sql.NullTime
+	err = row.Scan(&key.ID, &key.UserID, &key.Name, &key.Hash, &key.CreatedAt, &revokedAt)
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, err
+}
+
+// SaveAccount stores account in DB
+func (r *RDB) SaveAccount(ctx context.Context, account Account) error {
+	query := `
+		INSERT INTO accounts
+			(user_id, email, password_hash, created_at, session_epoch)
+		VALUES
+			($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING
+	`
+	res, err := r.db.ExecContext(ctx, query, account.UserID, account.Email, account.PasswordHash, account.CreatedAt, account.SessionEpoch)
+	if err != nil {
+		return fmt.Errorf("cannot save account: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot get affected rows: %w", err)
+	}
+	if n == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// LoadAccount returns account from DB
+func (r *RDB) LoadAccount(ctx context.Context, email string) (account Account, err error) {
+	query := `SELECT user_id, email, password_hash, created_at, session_epoch FROM accounts WHERE email = $1`
+	return r.loadAccount(ctx, query, email)
+}
+
+// LoadUserAccount returns account of user from DB
+func (r *RDB) LoadUserAccount(ctx context.Context, uid uuid.UUID) (account Account, err error) {
+	query := `SELECT user_id, email, password_hash, created_at, session_epoch FROM accounts WHERE user_id = $1`
+	return r.loadAccount(ctx, query, uid)
+}
+
+func (r *RDB) loadAccount(ctx context.Context, query string, arg interface{}) (account Account, err error) {
+	err = r.db.QueryRowContext(ctx, query, arg).Scan(&account.UserID, &account.Email, &account.PasswordHash, &account.CreatedAt, &account.SessionEpoch)
+	if errors.Is(err, sql.ErrNoRows) {
+		return account, ErrNotFound
+	}
+	if err != nil {
+		return account, fmt.Errorf("cannot scan row: %w", err)
+	}
+	return account, nil
+}
+
+// SetPassword replaces password of user account in DB
+func (r *RDB) SetPassword(ctx context.Context, uid uuid.UUID, passwordHash string) error {
+	query := `UPDATE accounts SET password_hash = $2, session_epoch = session_epoch + 1 WHERE user_id = $1`
+	res, err := r.db.ExecContext(ctx, query, uid, passwordHash)
+	if err != nil {
+		return fmt.Errorf("cannot set password: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot get affected rows: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RevokeSessions increments session epoch of user account in DB
+func (r *RDB) RevokeSessions(ctx context.Context, uid uuid.UUID) error {
+	query := `UPDATE accounts SET session_epoch = session_epoch + 1 WHERE user_id = $1`
+	res, err := r.db.ExecContext(ctx, query, uid)
+	if err != nil {
+		return fmt.Errorf("cannot revoke sessions: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot get affected rows: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SaveReport stores complaint about URL in DB
+func (r *RDB) SaveReport(ctx context.Context, report Report) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// lock URL row so that concurrent reports of it are counted one by one
+	var id string
+	err = tx.QueryRowContext(ctx, `SELECT id FROM urls WHERE id = $1 FOR UPDATE`, report.ID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("cannot lock record: %w", err)
+	}
+
+	var total, own int
+	query := `
+		SELECT count(*), count(*) FILTER (WHERE client_ip <> '' AND client_ip = $2)
+		FROM url_reports
+		WHERE url_id = $1
+	`
+	if err := tx.QueryRowContext(ctx, query, report.ID, report.ClientIP).Scan(&total, &own); err != nil {
+		return fmt.Errorf("cannot count reports: %w", err)
+	}
+	if own > 0 || total >= maxURLReports {
+		return ErrConflict
+	}
+
+	query = `
+		INSERT INTO url_reports
+			(url_id, reason, client_ip, created_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	if _, err := tx.ExecContext(ctx, query, report.ID, report.Reason, report.ClientIP, report.CreatedAt); err != nil {
+		return fmt.Errorf("cannot insert report: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	return nil
+}
+
+// LoadReports returns complaints about URLs from DB
+func (r *RDB) LoadReports(ctx context.Context, id string) (reports []Report, err error) {
+	query := `
+		SELECT url_id, reason, client_ip, created_at
+		FROM url_reports
+		WHERE $1 = '' OR url_id = $1
+		ORDER BY id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query rows: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var report Report
+		if err := rows.Scan(&report.ID, &report.Reason, &report.ClientIP, &report.CreatedAt); err != nil {
+			return nil, fmt.Errorf("cannot scan row: %w", err)
+		}
+		reports = append(reports, report)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return reports, nil
+}
+
+// Disable takes URL down in DB
+func (r *RDB) Disable(ctx context.Context, id string, takedown Takedown) error {
+	query := `
+		UPDATE urls
+		SET disabled_at = $2, disabled_reason = $3, disabled_legal = $4
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+	res, err := r.db.ExecContext(ctx, query, id, takedown.DisabledAt, takedown.Reason, takedown.Legal)
+	if err != nil {
+		return fmt.Errorf("cannot disable url: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot get affected rows: %w", err)
+	}
+	if n == 0 {
+		// tell missing URL from deleted one
+		if _, err := r.LoadRecord(ctx, id); err != nil {
+			return err
+		}
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Enable brings URL back in DB
+func (r *RDB) Enable(ctx context.Context, id string) error {
+	query := `
+		UPDATE urls
+		SET disabled_at = NULL, disabled_reason = NULL, disabled_legal = false
+		WHERE id = $1
+	`
+	res, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("cannot enable url: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot get affected rows: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// scanTakedown returns takedown of disabled URL row, nil if URL is not disabled
+func scanTakedown(disabledAt *time.Time, reason sql.NullString, legal bool) *Takedown {
+	if disabledAt == nil {
+		return nil
+	}
+	return &Takedown{
+		Reason:     reason.String,
+		Legal:      legal,
+		DisabledAt: *disabledAt,
+	}
+}
+
+// encodeOptions returns JSON of options or nil for empty ones
+func encodeOptions(opts Options) (*string, error) {
+	if opts.IsZero() {
+		return nil, nil
+	}
+	b, err := json.Marshal(opts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode options: %w", err)
+	}
+	s := string(b)
+	return &s, nil
+}
+
+// decodeVariantClicks parses variant clicks column value
+func decodeVariantClicks(raw string) (counts map[int]int, err error) {
+	if err := json.Unmarshal([]byte(raw), &counts); err != nil {
+		return nil, fmt.Errorf("cannot decode variant clicks: %w", err)
+	}
+	return copyCounts(counts), nil
+}
+
+// decodeOptions parses options column value
+func decodeOptions(raw sql.NullString) (opts Options, err error) {
+	if !raw.Valid {
+		return opts, nil
+	}
+	if err := json.Unmarshal([]byte(raw.String), &opts); err != nil {
+		return opts, fmt.Errorf("cannot decode options: %w", err)
+	}
+	return opts, nil
+}
+
+// jsonVersion is a version of URL history aggregated to JSON by DB
+type jsonVersion struct {
+	Number int    `json:"number"`
+	URL    string `json:"url"`
+	// CreatedAt is a number of microseconds since epoch, null for the first version
+	CreatedAt *int64 `json:"created_at"`
+}
+
+// decodeHistory reads URL history aggregated to JSON, nil is returned for URL never updated
+func decodeHistory(raw sql.NullString) (history []Version, err error) {
+	if !raw.Valid {
+		return nil, nil
+	}
+	var versions []jsonVersion
+	if err := json.Unmarshal([]byte(raw.String), &versions); err != nil {
+		return nil, fmt.Errorf("cannot decode history: %w", err)
+	}
+	for _, jv := range versions {
+		v := Version{Number: jv.Number}
+		if v.URL, err = url.Parse(jv.URL); err != nil {
+			return nil, fmt.Errorf("cannot parse URL: %w", err)
+		}
+		if jv.CreatedAt != nil {
+			v.CreatedAt = time.Unix(0, *jv.CreatedAt*int64(time.Microsecond)).UTC()
+		}
+		history = append(history, v)
+	}
+	return history, nil
+}
+
+// jsonReport is a complaint about URL aggregated to JSON by DB
+type jsonReport struct {
+	Reason   string `json:"reason"`
+	ClientIP string `json:"client_ip"`
+	// CreatedAt is a number of microseconds since epoch
+	CreatedAt int64 `json:"created_at"`
+}
+
+// decodeReports reads complaints about URL aggregated to JSON
+func decodeReports(id string, raw sql.NullString) (reports []Report, err error) {
+	if !raw.Valid {
+		return nil, nil
+	}
+	var jsonReports []jsonReport
+	if err := json.Unmarshal([]byte(raw.String), &jsonReports); err != nil {
+		return nil, fmt.Errorf("cannot decode reports: %w", err)
+	}
+	for _, jr := range jsonReports {
+		reports = append(reports, Report{
+			ID:        id,
+			Reason:    jr.Reason,
+			ClientIP:  jr.ClientIP,
+			CreatedAt: time.Unix(0, jr.CreatedAt*int64(time.Microsecond)),
+		})
+	}
+	return reports, nil
+}
+
 // Ping check db connection
 func (r *RDB) Ping(ctx context.Context) error {
 	return r.db.PingContext(ctx)
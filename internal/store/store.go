@@ -5,6 +5,8 @@ import (
 	"errors"
 	"io"
 	"net/url"
+	"sort"
+	"time"
 
 	"github.com/gofrs/uuid"
 )
@@ -29,13 +31,204 @@ type BatchStore interface {
 	SaveBatch(ctx context.Context, urls []*url.URL) (ids []string, err error)
 }
 
+// Record describes stored URL with its ownership and deletion state
+type Record struct {
+	ID      string
+	URL     *url.URL
+	UserID  *uuid.UUID
+	Deleted bool
+	Options Options
+	// Clicks is a number of follows counted against click limit
+	Clicks int
+	// VariantClicks are follow counts by variant position
+	VariantClicks map[int]int
+	// CreatedAt is zero if creation time is unknown
+	CreatedAt time.Time
+	// Disabled is not nil if URL has been taken down by administrator
+	Disabled *Takedown
+	// History holds destinations of updated URL, it is empty if URL has never been updated
+	History []Version
+	// Reports are complaints about URL in order of their creation
+	Reports []Report
+}
+
+// User describes user state kept apart from user URLs
+type User struct {
+	ID       uuid.UUID
+	Settings UserSettings
+	// Keys are user API keys in order of their creation, revoked ones included
+	Keys []APIKey
+	// Account is nil for anonymous user
+	Account *Account
+}
+
+// IsZero reports whether user has no state worth storing
+func (u User) IsZero() bool {
+	return u.Settings == (UserSettings{}) && len(u.Keys) == 0 && u.Account == nil
+}
+
+// RecordStore interface
+type RecordStore interface {
+	// Records calls fn for every stored record in order of their IDs
+	Records(ctx context.Context, fn func(rec Record) error) error
+	// Restore saves records as is preserving their IDs
+	Restore(ctx context.Context, records ...Record) error
+	// Users calls fn for every user having settings, API keys or account in order of their uids
+	Users(ctx context.Context, fn func(user User) error) error
+	// RestoreUsers saves users as is replacing their settings, API keys and account
+	RestoreUsers(ctx context.Context, users ...User) error
+}
+
+// Version describes single destination of URL in its history
+type Version struct {
+	Number int
+	URL    *url.URL
+	// CreatedAt is zero for the first version
+	CreatedAt time.Time
+}
+
+// HistoryStore interface
+type HistoryStore interface {
+	// UpdateUser changes destination of user URL keeping previous ones in history
+	UpdateUser(ctx context.Context, uid uuid.UUID, id string, url *url.URL) (version int, err error)
+	// History returns all destinations of user URL starting from the first one
+	History(ctx context.Context, uid uuid.UUID, id string) (versions []Version, err error)
+}
+
 // AuthStore interface
 type AuthStore interface {
 	BatchStore
+	RecordStore
+	HistoryStore
+	OptionsStore
+	SettingsStore
+	AbuseStore
+	UsageStore
+	KeyStore
+	AccountStore
+	TransferStore
 
 	SaveUser(ctx context.Context, uid uuid.UUID, url *url.URL) (id string, err error)
 	SaveUserBatch(ctx context.Context, uid uuid.UUID, urls []*url.URL) (ids []string, err error)
 	LoadUser(ctx context.Context, uid uuid.UUID, id string) (url *url.URL, err error)
 	LoadUsers(ctx context.Context, uid uuid.UUID) (urls map[string]*url.URL, err error)
 	DeleteUsers(ctx context.Context, uid uuid.UUID, ids ...string) error
+	// TransferUsers atomically moves not deleted URLs of one user to another one
+	TransferUsers(ctx context.Context, from, to uuid.UUID, ids ...string) (moved []string, err error)
+}
+
+// LessID reports whether ID a has been issued before ID b
+func LessID(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// SortIDs sorts IDs in order of their issue
+func SortIDs(ids []string) {
+	sort.Slice(ids, func(i, j int) bool {
+		return LessID(ids[i], ids[j])
+	})
+}
+
+// sortRecords sorts records in order of their IDs issue
+func sortRecords(records []Record) {
+	sort.Slice(records, func(i, j int) bool {
+		return LessID(records[i].ID, records[j].ID)
+	})
+}
+
+// appendVersion adds new destination to URL history
+// keeping current destination as the first version
+func appendVersion(history []Version, current, u *url.URL) []Version {
+	if len(history) == 0 {
+		history = append(history, Version{Number: 1, URL: current})
+	}
+	return append(history, Version{
+		Number:    len(history) + 1,
+		URL:       u,
+		CreatedAt: time.Now(),
+	})
+}
+
+// copyVersions returns copy of URL history, nil if it is empty
+func copyVersions(history []Version) []Version {
+	if len(history) == 0 {
+		return nil
+	}
+	res := make([]Version, len(history))
+	copy(res, history)
+	return res
+}
+
+// currentHistory returns history of URL which has never been updated
+func currentHistory(history []Version, current *url.URL) []Version {
+	if len(history) == 0 {
+		return []Version{{Number: 1, URL: current}}
+	}
+	res := make([]Version, len(history))
+	copy(res, history)
+	return res
+}
+
+// collectUsers returns users having settings, API keys or account in order of their uids
+func collectUsers(settings map[string]UserSettings, keys map[string]APIKey, accounts map[string]Account) []User {
+	users := make(map[uuid.UUID]*User)
+	user := func(uid uuid.UUID) *User {
+		if _, ok := users[uid]; !ok {
+			users[uid] = &User{ID: uid}
+		}
+		return users[uid]
+	}
+
+	for userID, s := range settings {
+		if s != (UserSettings{}) {
+			user(uuid.FromStringOrNil(userID)).Settings = s
+		}
+	}
+	for _, key := range keys {
+		user(key.UserID)
+	}
+	for _, account := range accounts {
+		account := account
+		user(account.UserID).Account = &account
+	}
+
+	res := make([]User, 0, len(users))
+	for uid, u := range users {
+		u.Keys = userKeys(keys, uid)
+		res = append(res, *u)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID.String() < res[j].ID.String()
+	})
+	return res
+}
+
+// restoreUser replaces settings, API keys and account of user in maps, emails index accounts by uid
+func restoreUser(settings map[string]UserSettings, keys map[string]APIKey, accounts map[string]Account, emails map[string]string, user User) {
+	userID := user.ID.String()
+	if user.Settings == (UserSettings{}) {
+		delete(settings, userID)
+	} else {
+		settings[userID] = user.Settings
+	}
+
+	for id, key := range keys {
+		if key.UserID == user.ID {
+			delete(keys, id)
+		}
+	}
+	for _, key := range user.Keys {
+		key.UserID = user.ID
+		keys[key.ID] = key
+	}
+
+	removeAccount(accounts, emails, user.ID)
+	if user.Account != nil {
+		account := *user.Account
+		account.UserID = user.ID
+		putAccount(accounts, emails, account)
+	}
 }
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Transfer describes offer of user URLs to another user
+type Transfer struct {
+	ID   string
+	From uuid.UUID
+	// To is the only user allowed to accept transfer, anyone can accept it if nil
+	To        *uuid.UUID
+	IDs       []string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// ClosedAt is nil until transfer is accepted or cancelled
+	ClosedAt *time.Time
+}
+
+// TransferStore interface
+type TransferStore interface {
+	// SaveTransfer stores new transfer, ErrConflict is returned if its ID is taken
+	SaveTransfer(ctx context.Context, transfer Transfer) error
+	// LoadTransfer returns transfer by its ID, closed ones included
+	LoadTransfer(ctx context.Context, id string) (transfer Transfer, err error)
+	// AcceptTransfer closes pending transfer and moves its URLs to given user at once,
+	// ErrDeleted is returned if transfer has already been closed
+	AcceptTransfer(ctx context.Context, id string, to uuid.UUID, acceptedAt time.Time) (moved []string, err error)
+	// CancelTransfer closes pending transfer of user, ErrNotFound is returned for transfers of other users
+	// and ErrDeleted for already closed ones
+	CancelTransfer(ctx context.Context, uid uuid.UUID, id string, cancelledAt time.Time) error
+}
+
+// closeTransfer marks pending transfer in map as closed
+func closeTransfer(transfers map[string]Transfer, id string, closedAt time.Time) (Transfer, error) {
+	transfer, ok := transfers[id]
+	if !ok {
+		return transfer, ErrNotFound
+	}
+	if transfer.ClosedAt != nil {
+		return transfer, ErrDeleted
+	}
+	transfer.ClosedAt = &closedAt
+	transfers[id] = transfer
+	return transfer, nil
+}
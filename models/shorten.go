@@ -1,20 +1,50 @@
 // Package models describes main entities.
 package models
 
+import (
+	"time"
+)
+
 // ShortenRequest describes request fields
 type ShortenRequest struct {
 	URL string `json:"url"`
+	// Password protects short URL from being followed without it
+	Password string `json:"password,omitempty"`
+	// MaxClicks limits number of short URL follows
+	MaxClicks int `json:"max_clicks,omitempty"`
+	// ActiveFrom postpones short URL activation
+	ActiveFrom *time.Time `json:"active_from,omitempty"`
+	// Rules pick conditional destinations of short URL
+	Rules []RedirectRule `json:"rules,omitempty"`
+	// Variants split follows of short URL between weighted destinations
+	Variants       []RedirectVariant `json:"variants,omitempty"`
+	StickyVariants bool              `json:"sticky_variants,omitempty"`
+	// Passthrough appends path suffix and query of request to destination
+	Passthrough bool `json:"passthrough,omitempty"`
+	// Template fills {name} placeholders of destination from request query
+	Template bool `json:"template,omitempty"`
+	// RedirectStatus is one of 301, 302, 307 or 308, user default if empty
+	RedirectStatus int `json:"redirect_status,omitempty"`
+	// Interstitial shows preview page to every visitor instead of redirecting
+	Interstitial bool `json:"interstitial,omitempty"`
+	// QR asks to return QR code of short URL in response
+	QR bool `json:"qr,omitempty"`
 }
 
 // ShortenResponse describes response fields
 type ShortenResponse struct {
 	Result string `json:"result"`
+	// QR is PNG data URI of short URL QR code if requested
+	QR string `json:"qr,omitempty"`
 }
 
 // URLResponse describes URL response fields
 type URLResponse struct {
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	ActiveFrom  *time.Time `json:"active_from,omitempty"`
+	// Pending is true until URL becomes active
+	Pending bool `json:"pending,omitempty"`
 }
 
 // BatchShortenRequest describes request fields when we save batch
@@ -28,3 +58,207 @@ type BatchShortenResponse struct {
 	CorrelationID string `json:"correlation_id"`
 	ShortURL      string `json:"short_url"`
 }
+
+// ExportURL describes single exported user URL
+type ExportURL struct {
+	ID          string `json:"id"`
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+	// CreatedAt is empty if creation time is unknown
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	// Deleted URLs are exported as well, they are skipped on import
+	Deleted bool           `json:"deleted,omitempty"`
+	Options *ExportOptions `json:"options,omitempty"`
+}
+
+// ExportOptions describes options of exported URL, password itself is never exported
+type ExportOptions struct {
+	PasswordProtected bool              `json:"password_protected,omitempty"`
+	MaxClicks         int               `json:"max_clicks,omitempty"`
+	ActiveFrom        *time.Time        `json:"active_from,omitempty"`
+	Rules             []RedirectRule    `json:"rules,omitempty"`
+	Variants          []RedirectVariant `json:"variants,omitempty"`
+	StickyVariants    bool              `json:"sticky_variants,omitempty"`
+	Passthrough       bool              `json:"passthrough,omitempty"`
+	Template          bool              `json:"template,omitempty"`
+	RedirectStatus    int               `json:"redirect_status,omitempty"`
+	Interstitial      bool              `json:"interstitial,omitempty"`
+}
+
+// ImportResult describes import result of a single row
+type ImportResult struct {
+	Row         int    `json:"row"`
+	OriginalURL string `json:"original_url"`
+	ShortURL    string `json:"short_url,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// UpdateURLRequest describes request fields when we change URL destination
+type UpdateURLRequest struct {
+	URL string `json:"url"`
+}
+
+// RollbackURLRequest describes request fields when we return URL to previous destination
+type RollbackURLRequest struct {
+	Version int `json:"version"`
+}
+
+// UpdateURLResponse describes response fields when URL destination changed
+type UpdateURLResponse struct {
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+	Version     int    `json:"version"`
+}
+
+// URLVersionResponse describes single destination in URL history
+type URLVersionResponse struct {
+	Version     int        `json:"version"`
+	OriginalURL string     `json:"original_url"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+}
+
+// AuditEntryResponse describes single user operation
+type AuditEntryResponse struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	Action    string    `json:"action"`
+	ShortURL  string    `json:"short_url,omitempty"`
+	Before    string    `json:"before,omitempty"`
+	After     string    `json:"after,omitempty"`
+}
+
+// TransferTokenResponse describes response fields when URLs transfer is offered
+type TransferTokenResponse struct {
+	// ID identifies transfer to cancel it
+	ID        string    `json:"id"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TransferAcceptRequest describes request fields when URLs transfer is accepted
+type TransferAcceptRequest struct {
+	Token string `json:"token"`
+}
+
+// RedirectRule describes conditional destination of short URL
+type RedirectRule struct {
+	Languages []string    `json:"languages,omitempty"`
+	Devices   []string    `json:"devices,omitempty"`
+	Time      *TimeWindow `json:"time,omitempty"`
+	Target    string      `json:"target"`
+}
+
+// TimeWindow describes daily period of time
+type TimeWindow struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Location string `json:"location,omitempty"`
+}
+
+// RedirectVariant describes weighted destination of short URL
+type RedirectVariant struct {
+	Target string `json:"target"`
+	Weight int    `json:"weight"`
+}
+
+// VariantsRequest describes request fields when URL variants are replaced
+type VariantsRequest struct {
+	Variants []RedirectVariant `json:"variants"`
+	Sticky   bool              `json:"sticky"`
+}
+
+// VariantsResponse describes URL variants with their follow counts
+type VariantsResponse struct {
+	Variants []VariantStatsResponse `json:"variants"`
+	Sticky   bool                   `json:"sticky"`
+}
+
+// VariantStatsResponse describes single URL variant with its follow count
+type VariantStatsResponse struct {
+	Target string `json:"target"`
+	Weight int    `json:"weight"`
+	Clicks int    `json:"clicks"`
+}
+
+// RedirectStatusRequest describes request fields when URL redirect status is changed
+type RedirectStatusRequest struct {
+	// RedirectStatus is one of 301, 302, 307 or 308, zero resets to user default
+	RedirectStatus int `json:"redirect_status"`
+}
+
+// ReportRequest describes request fields when visitor reports malicious URL
+type ReportRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ReportResponse describes single complaint about URL
+type ReportResponse struct {
+	ShortURL  string    `json:"short_url"`
+	Reason    string    `json:"reason"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DisableRequest describes request fields when administrator takes URL down
+type DisableRequest struct {
+	Reason string `json:"reason"`
+	// Legal takedowns are answered with 451 instead of 410
+	Legal bool `json:"legal"`
+}
+
+// UserSettings describes user defaults
+type UserSettings struct {
+	// RedirectStatus is one of 301, 302, 307 or 308, zero resets to server default
+	RedirectStatus int `json:"redirect_status"`
+}
+
+// QuotaResponse describes user quota usage
+type QuotaResponse struct {
+	// Active counts not deleted URLs
+	Active QuotaUsage `json:"active"`
+	// Daily counts URLs created since UTC midnight until ResetAt
+	Daily   QuotaUsage `json:"daily"`
+	ResetAt time.Time  `json:"reset_at"`
+}
+
+// QuotaUsage describes used amount of single quota
+type QuotaUsage struct {
+	Used int `json:"used"`
+	// Limit is zero if usage is not limited
+	Limit int `json:"limit"`
+}
+
+// CreateKeyRequest describes request fields when API key is issued
+type CreateKeyRequest struct {
+	Name string `json:"name"`
+}
+
+// KeyResponse describes API key of user
+type KeyResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// Key is returned only once when key is issued
+	Key       string     `json:"key,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// AccountRequest describes request fields when user registers or signs in
+type AccountRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// AccountResponse describes account of user
+type AccountResponse struct {
+	Email string `json:"email"`
+	// Merged is a number of anonymous user links moved to account on sign in
+	Merged int `json:"merged,omitempty"`
+}
+
+// ChangePasswordRequest describes request fields when account password is changed
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}